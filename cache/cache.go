@@ -0,0 +1,276 @@
+// Package cache stores the discovery results of services on disk, so unchanged services need not be analysed again
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/natsanalyzer"
+)
+
+// formatVersion is part of every key, and is to be incremented whenever the format of an Entry changes
+const formatVersion = "5"
+
+// Entry holds the discovery results of a single service
+type Entry struct {
+	ClientTargets         []*callanalyzer.CallTarget
+	ServerTargets         []*callanalyzer.CallTarget
+	InternalClientTargets []*callanalyzer.CallTarget
+	PackageCount          int
+	Consumers             []*natsanalyzer.NatsCall
+	Producers             []*natsanalyzer.NatsCall
+	Annotations           map[callanalyzer.Position]string
+	Diagnostics           []diagnostics.Diagnostic
+}
+
+// Cache is a directory holding an Entry per key
+type Cache struct {
+	dir string
+}
+
+// DirEnvVariable is the environment variable that overrides the default cache directory
+const DirEnvVariable = "NETDEP_CACHE_DIR"
+
+// DefaultDir returns the default cache directory: the value of DirEnvVariable if it is set,
+// or else netdep inside the user cache directory (e.g. ~/.cache/netdep)
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(DirEnvVariable); dir != "" {
+		return dir, nil
+	}
+
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(userCacheDir, "netdep"), nil
+}
+
+// New creates a Cache that stores its entries in dir
+func New(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Dir returns the directory of the cache
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// entryPath returns the path of the file that holds the entry of the key
+func (c *Cache) entryPath(key string) string {
+	return filepath.Join(c.dir, key+".gob")
+}
+
+// Load reads the entry of the key. Returns false if there is no (readable) entry for the key.
+func (c *Cache) Load(key string) (*Entry, bool) {
+	file, err := os.Open(c.entryPath(key))
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	entry := &Entry{}
+	if err := gob.NewDecoder(file).Decode(entry); err != nil {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// Store writes the entry of the key. The entry is written to a temporary file first,
+// so that concurrent runs never read a partially written entry.
+func (c *Cache) Store(key string, entry *Entry) error {
+	const dirPerm = 0o700
+	if err := os.MkdirAll(c.dir, dirPerm); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	err = gob.NewEncoder(file).Encode(entry)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), c.entryPath(key))
+}
+
+// Clean removes all entries from the cache
+func (c *Cache) Clean() error {
+	err := os.RemoveAll(c.dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("the cache cannot be removed: %w", err)
+	}
+
+	return nil
+}
+
+// KeyInputs are the inputs that determine the discovery results of a service
+type KeyInputs struct {
+	ServiceName     string
+	ServiceDir      string
+	ProjectDir      string
+	ServiceCallsDir string
+	EnvFile         string
+	Environment     map[string]string // Environment holds the environment variables of the service, which may come from other files
+	Flags           map[string]string // Flags holds the values of the command-line flags of the service
+	SharedSources   string            // SharedSources is the hash of the project sources outside the services, see HashSharedSources
+	Fingerprint     string            // Fingerprint describes the configuration of the analysis, see AnalyserConfig.Fingerprint
+}
+
+// Key computes the key of a service: a hash of the Go files of the service and the servicecalls package,
+// the go.mod and go.sum files of the project and the service, the environment file and variables, the flags, the shared sources and the fingerprint.
+// Files are labelled with their path relative to the project directory, so the key does not change when the project is
+// moved (e.g. into a git worktree), but does when a service is moved within the project, which changes its file names.
+func Key(inputs KeyInputs) (string, error) {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "version %s\nservice %s\nshared %s\nconfig %s\n",
+		formatVersion, inputs.ServiceName, inputs.SharedSources, inputs.Fingerprint)
+
+	hashValues(hash, "env", inputs.Environment)
+	hashValues(hash, "flag", inputs.Flags)
+
+	// files maps a label, which does not depend on the location of the project, to the path of a file
+	type labelledFile struct{ label, path string }
+	files := make([]labelledFile, 0)
+
+	for _, dir := range []string{inputs.ServiceDir, inputs.ServiceCallsDir} {
+		if dir == "" {
+			continue
+		}
+
+		goFiles, err := findGoFiles(dir)
+		if err != nil {
+			return "", err
+		}
+
+		for _, goFile := range goFiles {
+			files = append(files, labelledFile{label: relativeLabel(inputs.ProjectDir, goFile), path: goFile})
+		}
+	}
+
+	for _, name := range []string{"go.mod", "go.sum"} {
+		for _, path := range []string{filepath.Join(inputs.ProjectDir, name), filepath.Join(inputs.ServiceDir, name)} {
+			files = append(files, labelledFile{label: relativeLabel(inputs.ProjectDir, path), path: path})
+		}
+	}
+
+	if inputs.EnvFile != "" {
+		files = append(files, labelledFile{label: relativeLabel(inputs.ProjectDir, inputs.EnvFile), path: inputs.EnvFile})
+	}
+
+	for _, file := range files {
+		if err := hashFile(hash, file.label, file.path); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashValues writes the values to the hash in the order of their names, so the hash does not depend on the order of the map
+func hashValues(hash io.Writer, label string, values map[string]string) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(hash, "%s %q %q\n", label, name, values[name])
+	}
+}
+
+// relativeLabel returns the path of the file relative to the directory, or the path itself if that is not possible
+func relativeLabel(dir, path string) string {
+	if relativePath, err := filepath.Rel(dir, path); err == nil {
+		return filepath.ToSlash(relativePath)
+	}
+	return path
+}
+
+// HashSharedSources hashes the Go files of the project outside the directories holding the services,
+// such as shared libraries, as changes to these can change the discovery results of any service
+func HashSharedSources(projectDir string, serviceDirs ...string) (string, error) {
+	goFiles, err := findGoFiles(projectDir, serviceDirs...)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, file := range goFiles {
+		if err := hashFile(hash, relativeLabel(projectDir, file), file); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// findGoFiles returns the sorted paths of all .go files in the directory and its subdirectories,
+// skipping hidden directories and the excluded directories
+func findGoFiles(dir string, excludedDirs ...string) ([]string, error) {
+	goFiles := make([]string, 0)
+
+	isExcluded := make(map[string]bool)
+	for _, excludedDir := range excludedDirs {
+		isExcluded[filepath.Clean(excludedDir)] = true
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() && path != dir && (strings.HasPrefix(entry.Name(), ".") || isExcluded[path]) {
+			return filepath.SkipDir
+		}
+
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") {
+			goFiles = append(goFiles, path)
+		}
+
+		return nil
+	})
+
+	sort.Strings(goFiles)
+
+	return goFiles, err
+}
+
+// hashFile writes the label, size and content of the file to the hash. Files that do not exist are hashed as such.
+func hashFile(hash io.Writer, label, path string) error {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		_, _ = fmt.Fprintf(hash, "missing %s\n", label)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(hash, "file %s %d\n", label, len(content))
+	_, err = hash.Write(content)
+
+	return err
+}
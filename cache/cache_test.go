@@ -0,0 +1,133 @@
+// Package cache stores the discovery results of services on disk, so unchanged services need not be analysed again
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
+)
+
+// writeFile writes a file, creating its parent directories
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestStoreAndLoad(t *testing.T) {
+	cache := New(filepath.Join(t.TempDir(), "netdep"))
+
+	_, ok := cache.Load("key")
+	assert.False(t, ok)
+
+	entry := &Entry{
+		ClientTargets: []*callanalyzer.CallTarget{{RequestLocation: "http://b:80/", IsResolved: true, ServiceName: "a"}},
+		PackageCount:  1,
+		Annotations:   map[callanalyzer.Position]string{{Filename: "a/main.go", Line: 3}: "client targetSvc=b"},
+	}
+	assert.Nil(t, cache.Store("key", entry))
+
+	loaded, ok := cache.Load("key")
+	assert.True(t, ok)
+	assert.Equal(t, entry.ClientTargets, loaded.ClientTargets)
+	assert.Equal(t, entry.Annotations, loaded.Annotations)
+	assert.Equal(t, 1, loaded.PackageCount)
+
+	assert.Nil(t, cache.Clean())
+	_, ok = cache.Load("key")
+	assert.False(t, ok)
+	// cleaning a cache that does not exist is not an error
+	assert.Nil(t, cache.Clean())
+}
+
+func TestKeyChangesWithSources(t *testing.T) {
+	projectDir := t.TempDir()
+	serviceDir := filepath.Join(projectDir, "svc", "a")
+	writeFile(t, filepath.Join(projectDir, "go.mod"), "module example")
+	writeFile(t, filepath.Join(serviceDir, "main.go"), "package main")
+
+	inputs := KeyInputs{ServiceName: "a", ServiceDir: serviceDir, ProjectDir: projectDir, Fingerprint: "config"}
+
+	key, err := Key(inputs)
+	assert.Nil(t, err)
+
+	sameKey, err := Key(inputs)
+	assert.Nil(t, err)
+	assert.Equal(t, key, sameKey)
+
+	writeFile(t, filepath.Join(serviceDir, "main.go"), "package main // changed")
+	changedKey, err := Key(inputs)
+	assert.Nil(t, err)
+	assert.NotEqual(t, key, changedKey)
+
+	inputs.Fingerprint = "other config"
+	otherConfigKey, err := Key(inputs)
+	assert.Nil(t, err)
+	assert.NotEqual(t, changedKey, otherConfigKey)
+
+	inputs.Environment = map[string]string{"USERS_URL": "http://users:8080"}
+	environmentKey, err := Key(inputs)
+	assert.Nil(t, err)
+	assert.NotEqual(t, otherConfigKey, environmentKey)
+
+	inputs.Flags = map[string]string{"users-url": "http://users:8080"}
+	flagsKey, err := Key(inputs)
+	assert.Nil(t, err)
+	assert.NotEqual(t, environmentKey, flagsKey)
+}
+
+func TestHashSharedSources(t *testing.T) {
+	projectDir := t.TempDir()
+	servicesDir := filepath.Join(projectDir, "svc")
+	writeFile(t, filepath.Join(projectDir, "pkg", "lib.go"), "package pkg")
+	writeFile(t, filepath.Join(servicesDir, "a", "main.go"), "package main")
+
+	hash, err := HashSharedSources(projectDir, servicesDir)
+	assert.Nil(t, err)
+
+	// changes to the services do not change the shared sources
+	writeFile(t, filepath.Join(servicesDir, "a", "main.go"), "package main // changed")
+	sameHash, err := HashSharedSources(projectDir, servicesDir)
+	assert.Nil(t, err)
+	assert.Equal(t, hash, sameHash)
+
+	writeFile(t, filepath.Join(projectDir, "pkg", "lib.go"), "package pkg // changed")
+	changedHash, err := HashSharedSources(projectDir, servicesDir)
+	assert.Nil(t, err)
+	assert.NotEqual(t, hash, changedHash)
+}
+
+func TestKeyIndependentOfLocation(t *testing.T) {
+	keys := make([]string, 0)
+
+	for _, projectDir := range []string{t.TempDir(), t.TempDir()} {
+		serviceDir := filepath.Join(projectDir, "svc", "a")
+		writeFile(t, filepath.Join(serviceDir, "main.go"), "package main")
+
+		key, err := Key(KeyInputs{ServiceName: "a", ServiceDir: serviceDir, ProjectDir: projectDir})
+		assert.Nil(t, err)
+		keys = append(keys, key)
+	}
+
+	assert.Equal(t, keys[0], keys[1])
+}
+
+func TestKeyChangesWhenServiceIsMoved(t *testing.T) {
+	projectDir := t.TempDir()
+	keys := make([]string, 0)
+
+	for _, serviceDir := range []string{filepath.Join(projectDir, "svc", "a"), filepath.Join(projectDir, "services", "a")} {
+		writeFile(t, filepath.Join(serviceDir, "main.go"), "package main")
+
+		key, err := Key(KeyInputs{ServiceName: "a", ServiceDir: serviceDir, ProjectDir: projectDir})
+		assert.Nil(t, err)
+		keys = append(keys, key)
+	}
+
+	assert.NotEqual(t, keys[0], keys[1])
+}
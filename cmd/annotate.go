@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+
+	"lab.weave.nl/internships/tud-2022/netDep/netdep"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+)
+
+// AnnotateCmd returns a cobra command that analyses the project and inserts an annotation skeleton
+// above each call and endpoint of which the target could not be resolved
+func AnnotateCmd() *cobra.Command {
+	var (
+		config      RunConfig
+		dryRun      bool
+		interactive bool
+		noColor     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "annotate",
+		Short: "Insert annotations above the calls that could not be resolved",
+		Long: `Analyses the project and inserts a "//netdep:client ..." or "//netdep:endpoint ..." annotation above each call
+and endpoint of which the target could not be resolved. The annotation is filled with the part of the URL that was
+resolved and the service that the call most likely targets, which should be checked and completed.
+Only the annotation lines are added, the rest of the source is left as it is.`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.loadConfigFile(cmd)
+			if err != nil {
+				return err
+			}
+
+			color.NoColor = noColor // colourful terminal output
+
+			err = config.prepare("")
+			if err != nil {
+				return err
+			}
+
+			result, err := discoverAllCalls(cmd.Context(), config)
+			if err != nil {
+				return err
+			}
+
+			sites, problems := netdep.AnnotationSites(result)
+			output.PrintDiagnostics(problems)
+
+			if interactive {
+				sites, err = selectSites(cmd.InOrStdin(), cmd.OutOrStdout(), sites)
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(sites) == 0 {
+				color.HiGreen("Successfully analysed, there are no calls to annotate")
+				return nil
+			}
+
+			return annotateFiles(cmd.OutOrStdout(), config.ProjectDir, sites, dryRun)
+		},
+	}
+
+	bindAnalysisFlags(cmd, &config)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the changes as a unified diff instead of writing them")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "ask whether to insert each annotation")
+	cmd.Flags().BoolVarP(&noColor, "no-color", "n", false, "disable colourful terminal output")
+	return cmd
+}
+
+// selectSites asks for each site whether its annotation should be inserted, and returns the selected sites.
+// The answer "a" selects the remaining sites and "q" (or the end of the input) skips them.
+func selectSites(in io.Reader, out io.Writer, sites []netdep.AnnotationSite) ([]netdep.AnnotationSite, error) {
+	selected := make([]netdep.AnnotationSite, 0)
+	reader := bufio.NewReader(in)
+
+	for i, site := range sites {
+		_, err := fmt.Fprintf(out, "%s\t%s\n\t+ %s\nInsert this annotation? [y]es, [n]o, [a]ll, [q]uit: ", site.Position, site.Code, site.Annotation)
+		if err != nil {
+			return nil, err
+		}
+
+		answer, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			selected = append(selected, site)
+		case "a", "all":
+			return append(selected, sites[i:]...), nil
+		case "q", "quit":
+			return selected, nil
+		default:
+			if err == io.EOF {
+				return selected, nil
+			}
+		}
+	}
+
+	return selected, nil
+}
+
+// annotateFiles inserts the annotations of the sites into their files, or prints the changes as a unified diff
+func annotateFiles(out io.Writer, projectDir string, sites []netdep.AnnotationSite, dryRun bool) error {
+	files := make([]string, 0)
+	sitesByFile := make(map[string][]netdep.AnnotationSite)
+	for _, site := range sites {
+		if _, ok := sitesByFile[site.File]; !ok {
+			files = append(files, site.File)
+		}
+		sitesByFile[site.File] = append(sitesByFile[site.File], site)
+	}
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		annotated := netdep.InsertAnnotations(source, sitesByFile[file])
+
+		if dryRun {
+			name := file
+			if relative, err := filepath.Rel(projectDir, file); err == nil && !strings.HasPrefix(relative, "..") {
+				name = filepath.ToSlash(relative)
+			}
+
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        splitLines(string(source)),
+				B:        splitLines(string(annotated)),
+				FromFile: "a/" + name,
+				ToFile:   "b/" + name,
+				Context:  3, //nolint:gomnd
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprint(out, diff)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = os.WriteFile(file, annotated, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+	}
+
+	if !dryRun {
+		color.HiGreen("Inserted %d annotation(s) into %d file(s), check and complete them before analysing again", len(sites), len(files))
+	}
+	return nil
+}
+
+// splitLines splits the text into lines that keep their line ending
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"lab.weave.nl/internships/tud-2022/netDep/netdep"
+)
+
+func TestSelectSites(t *testing.T) {
+	sites := []netdep.AnnotationSite{
+		{Position: "orders/main.go:9", Annotation: "//netdep:client targetSvc=users"},
+		{Position: "orders/main.go:11", Annotation: `//netdep:client url=""`},
+		{Position: "orders/main.go:15", Annotation: `//netdep:endpoint url=""`},
+		{Position: "orders/main.go:17", Annotation: `//netdep:endpoint url=""`},
+	}
+
+	var out bytes.Buffer
+	selected, err := selectSites(strings.NewReader("y\nn\na\n"), &out, sites)
+	assert.Nil(t, err)
+	assert.Equal(t, []netdep.AnnotationSite{sites[0], sites[2], sites[3]}, selected)
+	assert.Equal(t, 3, strings.Count(out.String(), "Insert this annotation?"))
+
+	// the end of the input skips the remaining sites
+	selected, err = selectSites(strings.NewReader("yes\n"), &out, sites)
+	assert.Nil(t, err)
+	assert.Equal(t, sites[:1], selected)
+
+	selected, err = selectSites(strings.NewReader("n\nq\n"), &out, sites)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(selected))
+}
+
+func TestAnnotateFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	assert.Nil(t, os.WriteFile(file, []byte("package main\n\nfunc main() {\n\tcall()\n}\n"), 0o600))
+
+	var out bytes.Buffer
+	err := annotateFiles(&out, dir, []netdep.AnnotationSite{{File: file, Line: 4, Annotation: "//netdep:client url=/users"}}, true)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "--- a/main.go\n+++ b/main.go\n@@ -1,5 +1,6 @@\n package main\n \n func main() {\n"+
+		"+\t//netdep:client url=/users\n \tcall()\n }\n", out.String())
+
+	source, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "package main\n\nfunc main() {\n\tcall()\n}\n", string(source))
+
+	err = annotateFiles(&out, dir, []netdep.AnnotationSite{{File: file, Line: 4, Annotation: "//netdep:client url=/users"}}, false)
+	assert.Nil(t, err)
+	source, err = os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "package main\n\nfunc main() {\n\t//netdep:client url=/users\n\tcall()\n}\n", string(source))
+}
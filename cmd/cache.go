@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"lab.weave.nl/internships/tud-2022/netDep/cache"
+)
+
+// CacheCmd returns a cobra command that manages the cache of discovery results
+func CacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache of discovery results",
+		Long: `netDep stores the discovery results of each service in a cache, by default in the netdep directory inside
+the user cache directory (e.g. ~/.cache/netdep). The location can be changed using the NETDEP_CACHE_DIR environment variable.
+A service is only analysed again when its sources, the shared sources of the project, go.mod, go.sum, the environment
+variable file or the configuration of netDep changed.`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clean",
+		Short: "Remove all cached discovery results",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cacheDir, err := cache.DefaultDir()
+			if err != nil {
+				return err
+			}
+
+			err = cache.New(cacheDir).Clean()
+			if err == nil {
+				color.HiGreen("Removed the cache at %s", cacheDir)
+			}
+			return err
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/policy"
+)
+
+// CheckCmd returns a cobra command that analyses the project and evaluates a policy file against the result.
+// The command fails with ExitCodeViolations when any of the rules is violated.
+func CheckCmd() *cobra.Command {
+	var (
+		config     RunConfig
+		policyFile string
+		noColor    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check the dependency graph against the rules of a policy file",
+		Long: `Analyses the project and evaluates the rules of a policy file (in YAML format) against the dependency graph.
+Each violation is reported together with the locations of the offending calls.
+The exit code is 0 when all rules are satisfied, 2 when any rule is violated and 1 when the analysis failed.`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.loadConfigFile(cmd)
+			if err != nil {
+				return err
+			}
+
+			color.NoColor = noColor // colourful terminal output
+
+			rules, err := policy.LoadPolicy(policyFile)
+			if err != nil {
+				return err
+			}
+
+			err = config.prepare("")
+			if err != nil {
+				return err
+			}
+
+			graph, err := buildDependencyGraph(cmd.Context(), config)
+			if err != nil {
+				return err
+			}
+
+			violations := rules.Evaluate(graph)
+			printViolations(violations)
+
+			if len(violations) > 0 {
+				// the command was used correctly, so there is no need to print its usage
+				cmd.SilenceUsage = true
+				return violationsError(len(violations), "policy violation(s)")
+			}
+
+			return nil
+		},
+	}
+
+	bindAnalysisFlags(cmd, &config)
+	cmd.Flags().StringVarP(&policyFile, "policy", "P", "netdep-policy.yaml", "policy file")
+	cmd.Flags().BoolVarP(&noColor, "no-color", "n", false, "disable colourful terminal output")
+	return cmd
+}
+
+// printViolations prints the violations of the policy, or a success message if there are none
+func printViolations(violations []policy.Violation) {
+	if len(violations) == 0 {
+		color.HiGreen("Successfully analysed, all policy rules are satisfied")
+		return
+	}
+
+	color.Red("Found %d policy violation(s):", len(violations))
+	for _, violation := range violations {
+		color.Red("\t%s: %s", violation.Rule, violation.Message)
+		for _, location := range violation.Locations {
+			color.HiWhite("\t\t%s", location)
+		}
+	}
+}
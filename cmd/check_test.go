@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckInvalidPolicyFile(t *testing.T) {
+	checkCmd := CheckCmd()
+	checkCmd.SetArgs([]string{"--policy", "invalid"})
+
+	err := checkCmd.Execute()
+	assert.NotNil(t, err)
+	assert.Equal(t, "the policy file cannot be read: invalid", err.Error())
+	assert.Equal(t, ExitCodeFailure, ExitCode(err))
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, ExitCodeFailure, ExitCode(fmt.Errorf("analysis failed")))
+	assert.Equal(t, ExitCodeViolations, ExitCode(violationsError(3, "policy violation(s)")))
+	assert.Equal(t, ExitCodeViolations, ExitCode(fmt.Errorf("wrapped: %w", violationsError(1, "cycle(s)"))))
+}
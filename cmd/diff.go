@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+)
+
+// DiffCmd returns a cobra command that compares two dependency graphs,
+// either read from earlier JSON results or analysed from two git revisions
+func DiffCmd() *cobra.Command {
+	var (
+		config         RunConfig
+		baseRevision   string
+		headRevision   string
+		format         string
+		outputFilename string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff [old.json new.json]",
+		Short: "Compare the dependency graphs of two analyses or git revisions",
+		Long: `Reports added and removed services, added and removed dependencies, and dependencies of which the URL or protocol changed.
+Either supply two JSON files written by netDep, or use --base (and optionally --head) to analyse two git revisions
+of the project. Each revision is checked out into a temporary git worktree.
+Dependencies are matched on their source, target, protocol and URL, so the order of discovery does not matter.`,
+		Args: cobra.MaximumNArgs(2), //nolint:gomnd
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.loadConfigFile(cmd, "format")
+			if err != nil {
+				return err
+			}
+
+			if !isValidDiffFormat(format) {
+				return fmt.Errorf("invalid output format specified: %s", format)
+			}
+
+			var oldList, newList output.AdjacencyList
+
+			switch {
+			case len(args) == 2: //nolint:gomnd
+				oldList, newList, err = readAdjacencyLists(args[0], args[1])
+			case len(args) == 0 && baseRevision != "":
+				err = config.prepare(outputFilename)
+				if err != nil {
+					return err
+				}
+				oldList, newList, err = analyseRevisions(cmd.Context(), config, baseRevision, headRevision)
+			default:
+				return fmt.Errorf("either two result files or a --base revision must be specified")
+			}
+
+			if err != nil {
+				return err
+			}
+
+			diffString, err := formatDiff(output.DiffAdjacencyLists(oldList, newList), format)
+			if err != nil {
+				return err
+			}
+
+			if outputFilename == "" {
+				_, err = fmt.Fprint(cmd.OutOrStdout(), diffString)
+				return err
+			}
+
+			const filePerm = 0o600
+			err = os.WriteFile(outputFilename, []byte(diffString), filePerm)
+			if err == nil {
+				color.HiGreen("The dependency diff has been output to %v\n", outputFilename)
+			}
+			return err
+		},
+	}
+
+	bindAnalysisFlags(cmd, &config)
+	cmd.Flags().StringVar(&baseRevision, "base", "", "git revision to compare against, e.g. main")
+	cmd.Flags().StringVar(&headRevision, "head", "HEAD", "git revision to compare")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "output format: text, json or markdown")
+	cmd.Flags().StringVarP(&outputFilename, "output-filename", "o", "", "output filename such as ./diff.md")
+	return cmd
+}
+
+// isValidDiffFormat checks whether the diff can be formatted in the specified format
+func isValidDiffFormat(format string) bool {
+	return format == "text" || format == "json" || format == "markdown"
+}
+
+// formatDiff formats the diff in the specified format
+func formatDiff(diff output.GraphDiff, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonString, err := output.SerializeDiff(diff)
+		return jsonString + "\n", err
+	case "markdown":
+		return output.FormatDiffMarkdown(diff), nil
+	default:
+		return output.FormatDiffText(diff), nil
+	}
+}
+
+// readAdjacencyLists reads two earlier analysis results from disk
+func readAdjacencyLists(oldPath, newPath string) (output.AdjacencyList, output.AdjacencyList, error) {
+	lists := make([]output.AdjacencyList, 0, 2) //nolint:gomnd
+
+	for _, resultPath := range []string{oldPath, newPath} {
+		data, err := os.ReadFile(filepath.Clean(resultPath))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid result file specified: %s", resultPath)
+		}
+
+		adjacencyList, err := output.ParseAdjacencyList(data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		lists = append(lists, adjacencyList)
+	}
+
+	return lists[0], lists[1], nil
+}
+
+// analyseRevisions analyses the base and head git revisions of the project
+func analyseRevisions(ctx context.Context, config RunConfig, baseRevision, headRevision string) (output.AdjacencyList, output.AdjacencyList, error) {
+	repositoryRoot, err := runGit(config.ProjectDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oldList, err := analyseRevision(ctx, config, repositoryRoot, baseRevision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newList, err := analyseRevision(ctx, config, repositoryRoot, headRevision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return oldList, newList, nil
+}
+
+// analyseRevision checks out the given revision into a temporary git worktree,
+// and analyses the project using the paths of the RunConfig relocated into that worktree
+func analyseRevision(ctx context.Context, config RunConfig, repositoryRoot, revision string) (output.AdjacencyList, error) {
+	tempDir, err := os.MkdirTemp("", "netdep-diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	worktree := filepath.Join(tempDir, "worktree")
+
+	_, err = runGit(repositoryRoot, "worktree", "add", "--detach", worktree, revision)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = runGit(repositoryRoot, "worktree", "remove", "--force", worktree)
+	}()
+
+	color.HiGreen("Analysing revision %s\n", revision)
+
+	revisionConfig := config
+	revisionConfig.ProjectDir = relocatePath(config.ProjectDir, repositoryRoot, worktree)
+	revisionConfig.ServiceDir = relocatePath(config.ServiceDir, repositoryRoot, worktree)
+	revisionConfig.ServiceCallsDir = relocatePath(config.ServiceCallsDir, repositoryRoot, worktree)
+	revisionConfig.EnvFile = relocatePath(config.EnvFile, repositoryRoot, worktree)
+	revisionConfig.Manifests = make([]string, 0, len(config.Manifests))
+	for _, manifest := range config.Manifests {
+		revisionConfig.Manifests = append(revisionConfig.Manifests, relocatePath(manifest, repositoryRoot, worktree))
+	}
+	revisionConfig.DotenvFiles = make(map[string]string, len(config.DotenvFiles))
+	for service, file := range config.DotenvFiles {
+		revisionConfig.DotenvFiles[service] = relocatePath(file, repositoryRoot, worktree)
+	}
+	revisionConfig.dotenvFiles = make(map[string][]string, len(config.dotenvFiles))
+	for service, files := range config.dotenvFiles {
+		for _, file := range files {
+			revisionConfig.dotenvFiles[service] = append(revisionConfig.dotenvFiles[service], relocatePath(file, repositoryRoot, worktree))
+		}
+	}
+
+	graph, err := buildDependencyGraph(ctx, revisionConfig)
+	if err != nil {
+		return nil, fmt.Errorf("analysis of revision %s failed: %w", revision, err)
+	}
+
+	return output.ConstructAdjacencyList(graph), nil
+}
+
+// relocatePath maps a path inside the repository to the same path inside the worktree.
+// Empty paths and paths outside the repository are returned unchanged.
+func relocatePath(pth, repositoryRoot, worktree string) string {
+	if pth == "" {
+		return pth
+	}
+
+	absolutePath, err := filepath.Abs(pth)
+	if err != nil {
+		return pth
+	}
+
+	relativePath, err := filepath.Rel(repositoryRoot, absolutePath)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		return pth
+	}
+
+	return filepath.Join(worktree, relativePath)
+}
+
+// runGit runs a git command in the given directory and returns its trimmed output
+func runGit(dir string, args ...string) (string, error) {
+	gitCmd := exec.Command("git", args...) //nolint:gosec // the arguments are composed by netDep itself
+	gitCmd.Dir = dir
+
+	out, err := gitCmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
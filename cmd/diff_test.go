@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeResultFile writes an analysis result to a temporary file
+func writeResultFile(t *testing.T, content string) string {
+	t.Helper()
+	resultFile := filepath.Join(t.TempDir(), "deps.json")
+	err := os.WriteFile(resultFile, []byte(content), 0o600)
+	assert.Nil(t, err)
+	return resultFile
+}
+
+func TestDiffResultFiles(t *testing.T) {
+	oldFile := writeResultFile(t, "{\"a\":[{\"service\":\"b\",\"calls\":[{\"protocol\":\"HTTP\",\"url\":\"http://b:80/x\",\"locations\":[]}],\"count\":1}],\"b\":[]}")
+	newFile := writeResultFile(t, "{\"a\":[],\"b\":[],\"c\":[]}")
+
+	var out bytes.Buffer
+	diffCmd := DiffCmd()
+	diffCmd.SetOut(&out)
+	diffCmd.SetArgs([]string{oldFile, newFile, "--format", "markdown"})
+
+	err := diffCmd.Execute()
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "| added | `c` |")
+	assert.Contains(t, out.String(), "| removed | `a` | `b` | HTTP | `http://b:80/x` |")
+}
+
+// TestDiffReportFiles checks that a document written with --report can be compared to a bare adjacency list
+func TestDiffReportFiles(t *testing.T) {
+	configFile := writeConfigFile(t, "")
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+	listFile := filepath.Join(t.TempDir(), "deps.json")
+
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile, "--no-cache", "--shallow=false", "-o", reportFile, "--report"})
+	assert.Nil(t, runDepScanCmd.Execute())
+
+	runDepScanCmd = RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile, "--no-cache", "--shallow=false", "-o", listFile})
+	assert.Nil(t, runDepScanCmd.Execute())
+
+	var out bytes.Buffer
+	diffCmd := DiffCmd()
+	diffCmd.SetOut(&out)
+	diffCmd.SetArgs([]string{reportFile, listFile})
+
+	err := diffCmd.Execute()
+	assert.Nil(t, err)
+	assert.Equal(t, "No changes in the dependency graph.\n", out.String())
+}
+
+func TestDiffInvalidFormat(t *testing.T) {
+	diffCmd := DiffCmd()
+	diffCmd.SetArgs([]string{"old.json", "new.json", "--format", "yaml"})
+
+	err := diffCmd.Execute()
+	assert.NotNil(t, err)
+	assert.Equal(t, "invalid output format specified: yaml", err.Error())
+}
+
+func TestDiffInvalidResultFile(t *testing.T) {
+	diffCmd := DiffCmd()
+	diffCmd.SetArgs([]string{"invalid", "invalid"})
+
+	err := diffCmd.Execute()
+	assert.NotNil(t, err)
+	assert.Equal(t, "invalid result file specified: invalid", err.Error())
+}
+
+func TestDiffMissingInput(t *testing.T) {
+	diffCmd := DiffCmd()
+	diffCmd.SetArgs([]string{})
+
+	err := diffCmd.Execute()
+	assert.NotNil(t, err)
+	assert.Equal(t, "either two result files or a --base revision must be specified", err.Error())
+}
+
+func TestRelocatePath(t *testing.T) {
+	repositoryRoot := filepath.Join(string(os.PathSeparator), "repo")
+	worktree := filepath.Join(string(os.PathSeparator), "tmp", "worktree")
+
+	assert.Equal(t, filepath.Join(worktree, "svc"), relocatePath(filepath.Join(repositoryRoot, "svc"), repositoryRoot, worktree))
+	assert.Equal(t, filepath.Join(string(os.PathSeparator), "other", "env"), relocatePath(filepath.Join(string(os.PathSeparator), "other", "env"), repositoryRoot, worktree))
+	assert.Equal(t, "", relocatePath("", repositoryRoot, worktree))
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ExitCodeFailure is the exit code of a run that could not be completed, e.g. because the analysis failed
+const ExitCodeFailure = 1
+
+// ExitCodeViolations is the exit code of a run that completed, but found violations (e.g. of a policy)
+const ExitCodeViolations = 2
+
+// ExitCodeError is returned by commands whose outcome should be reported using a specific exit code,
+// so that netDep can be used to gate merges in CI pipelines.
+type ExitCodeError struct {
+	Code    int
+	Message string
+}
+
+// Error returns the message of the ExitCodeError
+func (e *ExitCodeError) Error() string {
+	return e.Message
+}
+
+// violationsError creates an ExitCodeError for the given number of violations
+func violationsError(count int, kind string) error {
+	return &ExitCodeError{
+		Code:    ExitCodeViolations,
+		Message: fmt.Sprintf("found %d %s", count, kind),
+	}
+}
+
+// ExitCode returns the exit code the process should terminate with, given the error returned by a command
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitCodeError *ExitCodeError
+	if errors.As(err, &exitCodeError) {
+		return exitCodeError.Code
+	}
+
+	return ExitCodeFailure
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"lab.weave.nl/internships/tud-2022/netDep/projectconfig"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/preprocessing"
+)
+
+// configTemplate is the configuration file written by the init command. Options that were not detected are
+// commented out, so they document what can be configured.
+var configTemplate = template.Must(template.New("config").Parse(`# netDep configuration, see the README for all options.
+# Flags given on the command line override the values in this file.
+# Paths are relative to the directory of this file.
+
+# how the services are found: directories, main-packages, workspace or config
+discovery: {{ .Discovery }}
+{{ if .ServiceDirectory }}serviceDirectory: {{ .ServiceDirectory }}{{ else }}# serviceDirectory: ./svc{{ end }}
+{{ if .ServicecallsDirectory }}servicecallsDirectory: {{ .ServicecallsDirectory }}{{ else }}# servicecallsDirectory: ./servicecalls{{ end }}
+# environmentVariables: ./env.yaml
+
+# where the services get their names from, in order of preference: directory, gomod, dockerfile or k8s
+{{ if .ServiceNames }}serviceNames: [{{ .ServiceNames }}]{{ else }}# serviceNames: [gomod]{{ end }}
+
+# the services of the config discovery, with paths relative to the project directory
+# services:
+#   - name: billing
+#     path: billing/cmd/server
+#   - path: services/*
+
+# output:
+#   file: ./deps.json
+#   format: json
+
+# routes that are called from outside the project, which are not reported as unused endpoints
+# publicRoutes: [/health, "orders:/api/*"]
+
+# ignore:
+#   packages: [encoding/json]
+#   services: [tools-*]
+#   calls:
+#     - url: /healthz
+#       reason: health checks are not dependencies
+#     - service: orders
+#       package: example.com/shop/mocks
+#       function: "(*example.com/shop/mocks.Client).*"
+
+# calls:
+#   client:
+#     (*example.com/client.Client).Do: [1]
+#   server:
+#     example.com/router.Handle: [0]
+#   maxTraversalDepth: 0
+
+# other names under which the services are called
+# aliases:
+#   users: [users.default.svc.cluster.local, user-api]
+# hosts:
+#   localhost:8081: users
+
+# values of the command-line flags of the services, instead of the defaults in the code
+# flags:
+#   orders:
+#     users-url: http://users:8080
+
+# dependencies that cannot be discovered in the code, such as those of generated clients
+# dependencies:
+#   - from: orders
+#     to: users
+#     protocol: gRPC
+`))
+
+// detectedConfig holds the options that the init command detected in the project
+type detectedConfig struct {
+	Discovery             string
+	ServiceDirectory      string
+	ServicecallsDirectory string
+	ServiceNames          string
+}
+
+// InitCmd returns a cobra command that writes a configuration file for the project
+func InitCmd() *cobra.Command {
+	var (
+		projectDir string
+		force      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Write a configuration file for the project",
+		Long: `Inspects the project and writes a commented ` + projectconfig.FileName + ` to its root, holding the way in which its
+services are found, the servicecalls directory and the sources of the service names that were detected.
+Other options are included as comments. An existing configuration file is only overwritten with --force.`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath := filepath.Join(projectDir, projectconfig.FileName)
+			if _, err := os.Stat(configPath); err == nil && !force {
+				return fmt.Errorf("the configuration file already exists: %s", configPath)
+			}
+
+			detected, err := detectConfig(projectDir)
+			if err != nil {
+				return err
+			}
+
+			var buffer bytes.Buffer
+			err = configTemplate.Execute(&buffer, detected)
+			if err != nil {
+				return err
+			}
+
+			const filePerm = 0o600
+			err = os.WriteFile(configPath, buffer.Bytes(), filePerm)
+			if err != nil {
+				return err
+			}
+
+			color.HiGreen("Wrote %s", configPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&projectDir, "project-directory", "p", "./", "project directory")
+	cmd.Flags().BoolVar(&force, "force", false, "overwrite an existing configuration file")
+	return cmd
+}
+
+// detectConfig determines the way in which the services of the project are found, its servicecalls directory and
+// the sources that name its services
+func detectConfig(projectDir string) (detectedConfig, error) {
+	detected := detectedConfig{}
+
+	if info, err := os.Stat(projectDir); err != nil || !info.IsDir() {
+		return detected, fmt.Errorf("invalid project directory specified: %s", projectDir)
+	}
+
+	var finder preprocessing.ServiceFinder
+	serviceDir := filepath.Join(projectDir, "svc")
+
+	switch {
+	case isFile(filepath.Join(projectDir, "go.work")):
+		detected.Discovery = preprocessing.DiscoverWorkspace
+		finder = preprocessing.WorkspaceFinder{WorkFile: filepath.Join(projectDir, "go.work")}
+	case hasSubdirectories(serviceDir):
+		detected.Discovery = preprocessing.DiscoverDirectories
+		detected.ServiceDirectory = "./svc"
+		finder = preprocessing.DirectoryFinder{ServicesDir: serviceDir}
+	default:
+		detected.Discovery = preprocessing.DiscoverMainPackages
+		finder = preprocessing.MainPackageFinder{ProjectDir: projectDir}
+	}
+
+	servicecallsDir, err := findServicecallsDir(projectDir)
+	if err != nil {
+		return detected, err
+	}
+	if servicecallsDir != "" {
+		detected.ServicecallsDirectory = "./" + filepath.ToSlash(servicecallsDir)
+	}
+
+	// the services are only used to detect the name sources, so a project without services still gets a file
+	services, _ := finder.FindServices()
+
+	nameSources := make([]string, 0)
+	for _, source := range []string{preprocessing.NameFromDockerfile, preprocessing.NameFromKubernetes} {
+		if namesAnyService(services, source) {
+			nameSources = append(nameSources, source)
+		}
+	}
+	detected.ServiceNames = strings.Join(nameSources, ", ")
+
+	return detected, nil
+}
+
+// namesAnyService checks whether the source gives any of the services a name other than its directory
+func namesAnyService(services []preprocessing.Service, source string) bool {
+	for _, service := range services {
+		name, err := preprocessing.NameService(service.Dir, []string{source})
+		if err == nil && name != filepath.Base(service.Dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findServicecallsDir returns the path of the servicecalls directory relative to the project directory, if any
+func findServicecallsDir(projectDir string) (string, error) {
+	found := ""
+
+	err := filepath.WalkDir(projectDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() || found != "" {
+			return nil
+		}
+
+		name := entry.Name()
+		if path != projectDir && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata") {
+			return filepath.SkipDir
+		}
+
+		if name == "servicecalls" {
+			found, err = filepath.Rel(projectDir, path)
+			if err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	return found, err
+}
+
+// hasSubdirectories checks whether the directory exists and holds at least one directory
+func hasSubdirectories(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isFile checks whether the path is an existing file
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"lab.weave.nl/internships/tud-2022/netDep/projectconfig"
+)
+
+func TestInit(t *testing.T) {
+	projectDir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                    "module example.com/shop\n\ngo 1.17\n",
+		"svc/users/main.go":         "package main\n\nfunc main() {}\n",
+		"svc/users/Dockerfile":      "FROM scratch\nLABEL service=users-api\n",
+		"pkg/servicecalls/calls.go": "package servicecalls\n",
+		"svc/orders/main.go":        "package main\n\nfunc main() {}\n",
+	}
+	for path, content := range files {
+		assert.Nil(t, os.MkdirAll(filepath.Join(projectDir, filepath.Dir(path)), 0o755))
+		assert.Nil(t, os.WriteFile(filepath.Join(projectDir, path), []byte(content), 0o600))
+	}
+
+	initCmd := InitCmd()
+	initCmd.SetArgs([]string{"-p", projectDir})
+	assert.Nil(t, initCmd.Execute())
+
+	// the generated file is a valid configuration file holding the detected options
+	config, err := projectconfig.Load(filepath.Join(projectDir, projectconfig.FileName))
+	assert.Nil(t, err)
+	assert.Equal(t, "directories", config.Discovery)
+	assert.Equal(t, filepath.Join(projectDir, "svc"), config.ServiceDirectory)
+	assert.Equal(t, filepath.Join(projectDir, "pkg", "servicecalls"), config.ServicecallsDirectory)
+	assert.Equal(t, []string{"dockerfile"}, config.ServiceNames)
+
+	// an existing file is only overwritten with --force
+	initCmd = InitCmd()
+	initCmd.SetArgs([]string{"-p", projectDir})
+	assert.EqualError(t, initCmd.Execute(), "the configuration file already exists: "+filepath.Join(projectDir, projectconfig.FileName))
+
+	initCmd = InitCmd()
+	initCmd.SetArgs([]string{"-p", projectDir, "--force"})
+	assert.Nil(t, initCmd.Execute())
+}
+
+func TestInitMainPackages(t *testing.T) {
+	projectDir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(projectDir, "cmd", "api"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(projectDir, "cmd", "api", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o600))
+
+	detected, err := detectConfig(projectDir)
+	assert.Nil(t, err)
+	assert.Equal(t, detectedConfig{Discovery: "main-packages"}, detected)
+}
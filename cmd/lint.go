@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"lab.weave.nl/internships/tud-2022/netDep/netdep"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+)
+
+// LintAnnotationsCmd returns a cobra command that analyses the project and checks its annotations.
+// The command fails with ExitCodeViolations when any of the annotations has a problem.
+func LintAnnotationsCmd() *cobra.Command {
+	var (
+		config  RunConfig
+		noColor bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lint-annotations",
+		Short: "Check the //netdep: annotations of the project",
+		Long: `Analyses the project and checks each //netdep: annotation. It reports annotations that cannot be parsed,
+such as those with an unknown type or key, annotations that are not above any call or endpoint, annotations that target
+a service that does not exist, and annotations that are redundant because the call was resolved without them.
+The exit code is 0 when all annotations are valid, 2 when any annotation has a problem and 1 when the analysis failed.`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.loadConfigFile(cmd)
+			if err != nil {
+				return err
+			}
+
+			color.NoColor = noColor // colourful terminal output
+
+			err = config.prepare("")
+			if err != nil {
+				return err
+			}
+
+			result, err := discoverAllCalls(cmd.Context(), config)
+			if err != nil {
+				return err
+			}
+
+			problems := netdep.LintAnnotations(result)
+			if len(problems) == 0 {
+				color.HiGreen("Successfully analysed, all annotations are valid")
+				return nil
+			}
+
+			color.Red("Found %d annotation problem(s):", len(problems))
+			output.PrintDiagnostics(problems)
+
+			// the command was used correctly, so there is no need to print its usage
+			cmd.SilenceUsage = true
+			return violationsError(len(problems), "annotation problem(s)")
+		},
+	}
+
+	bindAnalysisFlags(cmd, &config)
+	cmd.Flags().BoolVarP(&noColor, "no-color", "n", false, "disable colourful terminal output")
+	return cmd
+}
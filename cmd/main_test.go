@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"lab.weave.nl/internships/tud-2022/netDep/cache"
+)
+
+// TestMain runs the tests using an empty cache directory, so results of earlier runs are never used
+func TestMain(m *testing.M) {
+	cacheDir, err := os.MkdirTemp("", "netdep-cache-")
+	if err != nil {
+		panic(err)
+	}
+
+	_ = os.Setenv(cache.DirEnvVariable, cacheDir)
+	code := m.Run()
+
+	_ = os.RemoveAll(cacheDir)
+	os.Exit(code)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+)
+
+// MetricsCmd returns a cobra command that analyses the project and reports the coupling metrics of each service
+func MetricsCmd() *cobra.Command {
+	var (
+		config         RunConfig
+		format         string
+		outputFilename string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "metrics",
+		Short: "Report the coupling metrics of each service",
+		Long: `Analyses the project and reports, for each service, its fan-in (the number of services calling it),
+fan-out (the number of services it calls), instability (fan-out / (fan-in + fan-out)), the number of services
+that transitively depend on it (its blast radius), the number of services it transitively depends on,
+and the length of the longest chain of synchronous calls starting at the service.
+The circular dependencies, of which the services are each other's transitive dependents, are printed as well.`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.loadConfigFile(cmd)
+			if err != nil {
+				return err
+			}
+
+			if !isValidMetricsFormat(format) {
+				return fmt.Errorf("invalid output format specified: %s", format)
+			}
+
+			err = config.prepare(outputFilename)
+			if err != nil {
+				return err
+			}
+
+			graph, err := buildDependencyGraph(cmd.Context(), config)
+			if err != nil {
+				return err
+			}
+
+			metrics := output.ComputeMetrics(graph)
+			if output.HasTruncatedChains(metrics) {
+				color.Yellow("The search for the longest chain was stopped early for some services, their longest-sync-chain may be longer than reported (marked with +)")
+			}
+			output.PrintCycles(output.FindCycles(graph, output.AllProtocols))
+
+			metricsString, err := formatMetrics(metrics, format)
+			if err != nil {
+				return err
+			}
+
+			if outputFilename == "" {
+				_, err = fmt.Fprint(cmd.OutOrStdout(), metricsString)
+				return err
+			}
+
+			const filePerm = 0o600
+			err = os.WriteFile(outputFilename, []byte(metricsString), filePerm)
+			if err == nil {
+				color.HiGreen("The service metrics have been output to %v\n", outputFilename)
+			}
+			return err
+		},
+	}
+
+	bindAnalysisFlags(cmd, &config)
+	cmd.Flags().StringVarP(&format, "format", "f", "table", "output format: table, csv or json")
+	cmd.Flags().StringVarP(&outputFilename, "output-filename", "o", "", "output filename such as ./metrics.csv")
+	return cmd
+}
+
+// isValidMetricsFormat checks whether the metrics can be formatted in the specified format
+func isValidMetricsFormat(format string) bool {
+	return format == "table" || format == "csv" || format == "json"
+}
+
+// formatMetrics formats the metrics in the specified format
+func formatMetrics(metrics []output.ServiceMetrics, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonString, err := output.SerializeMetrics(metrics)
+		return jsonString + "\n", err
+	case "csv":
+		return output.FormatMetricsCSV(metrics)
+	default:
+		return output.FormatMetricsTable(metrics), nil
+	}
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsInvalidFormat(t *testing.T) {
+	metricsCmd := MetricsCmd()
+	metricsCmd.SetArgs([]string{"--format", "xml"})
+
+	err := metricsCmd.Execute()
+	assert.EqualError(t, err, "invalid output format specified: xml")
+}
@@ -5,24 +5,23 @@ Copyright © 2022 TW Group 13C, Weave BV, TU Delft
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
+	"runtime"
+	"strconv"
 
 	"github.com/fatih/color"
 
 	"github.com/spf13/cobra"
 
-	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery"
-	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
-	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/natsanalyzer"
-	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/servicecallsanalyzer"
+	"lab.weave.nl/internships/tud-2022/netDep/netdep"
+	"lab.weave.nl/internships/tud-2022/netDep/projectconfig"
 	"lab.weave.nl/internships/tud-2022/netDep/stages/matching"
 	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
 	"lab.weave.nl/internships/tud-2022/netDep/stages/preprocessing"
-	"lab.weave.nl/internships/tud-2022/netDep/structures"
 )
 
 // RunConfig defines the parameters for a depScan command run
@@ -33,71 +32,99 @@ type RunConfig struct {
 	Verbose         bool
 	ServiceCallsDir string
 	Shallow         bool
+	Jobs            int               // Jobs is the maximum number of services that are analysed concurrently
+	SingleProgram   bool              // SingleProgram loads and builds all services as one SSA program
+	NoCache         bool              // NoCache disables loading and storing discovery results in the cache
+	Discovery       string            // Discovery selects how the services are found, see netdep.DiscoverDirectories
+	ServicesFile    string            // ServicesFile lists the services when Discovery is netdep.DiscoverConfig
+	NameSources     []string          // NameSources are the sources from which the names of the services are derived
+	Manifests       []string          // Manifests are Kubernetes manifests, or directories holding them, such as helm template output
+	DotenvFiles     map[string]string // DotenvFiles maps the names of services to their dotenv files
+	Profile         string            // Profile selects the profile of the configuration file and the .env.<profile> files
+	ConfigFile      string            // ConfigFile is the project configuration file, by default the one in the project directory
+	PublicRoutes    []string          // PublicRoutes are the routes that are called from outside the project
+	servicePatterns []netdep.ServicePattern
+	rules           netdep.Rules                 // rules are the ignored packages and interesting calls of the configuration file
+	ignoredServices []string                     // ignoredServices are the services of the configuration file that are not analysed
+	hosts           map[string]string            // hosts map the aliases and hosts of the configuration file to services
+	dotenvFiles     map[string][]string          // dotenvFiles are the dotenv files of the services in the configuration file
+	flags           map[string]map[string]string // flags are the values of the command-line flags of the services in the configuration file
+	dependencies    []netdep.Dependency          // dependencies are the dependencies that are declared in the configuration file
 }
 
 // RootCmd creates and returns a depScan command object
 func RootCmd() *cobra.Command {
 	// Variables that are supplied as command-line args
 	var (
-		projectDir      string
-		serviceDir      string
-		envVars         string
-		outputFilename  string
-		verbose         bool
-		serviceCallsDir string
-		shallow         bool
-		noColor         bool
+		config         RunConfig
+		outputFilename string
+		noColor        bool
+		cycleProtocols string
+		failOnCycles   bool
+		report         bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "netDep",
 		Short: "Scan and report dependencies between microservices",
 		Long: `Outputs network-communication-based dependencies of services within a microservice architecture Golang project.
-Output is an adjacency list of service dependencies in a JSON format`,
+Output is a JSON adjacency list of service dependencies. With --report, it is a JSON document holding the
+dependencies together with the metrics of each service, any circular dependencies, endpoints that none of the
+services call, suppressed calls and diagnostics`,
 
 		RunE: func(cmd *cobra.Command, args []string) error {
-			color.NoColor = noColor // colourful terminal output
-
-			cwd, err := os.Getwd()
+			err := config.loadConfigFile(cmd, "output-filename")
 			if err != nil {
 				return err
 			}
 
-			projectDir = ensureAbsolutePath(cwd, projectDir)
-			serviceDir = ensureAbsolutePath(cwd, serviceDir)
+			color.NoColor = noColor // colourful terminal output
 
-			ok, err := areInputPathsValid(projectDir, serviceDir, serviceCallsDir, envVars, outputFilename)
-			if !ok {
-				return err
+			if !output.IsValidProtocolSelection(cycleProtocols) {
+				return fmt.Errorf("invalid cycle protocols specified: %s", cycleProtocols)
 			}
 
-			config := RunConfig{
-				ProjectDir:      projectDir,
-				ServiceDir:      serviceDir,
-				Verbose:         verbose,
-				EnvFile:         envVars,
-				ServiceCallsDir: serviceCallsDir,
-				Shallow:         shallow,
+			err = config.prepare(outputFilename)
+			if err != nil {
+				return err
 			}
 
 			// CALL OUR MAIN FUNCTIONALITY LOGIC FROM HERE AND SUPPLY BOTH PROJECT DIR AND SERVICE DIR
-			dependencies, err := discoverAllCalls(config)
+			result, err := discoverAllCalls(cmd.Context(), config)
 			if err != nil {
 				return err
 			}
+			graph := result.Graph
 
 			// generate output
-			graph := matching.CreateDependencyGraph(dependencies)
-			adjacencyList := output.ConstructAdjacencyList(graph)
-			jsonString, err := output.SerializeAdjacencyList(adjacencyList, true)
-			if err != nil {
-				return err
+			cycles := output.FindCycles(graph, cycleProtocols)
+			document := output.Document{
+				Dependencies:    output.ConstructAdjacencyList(graph),
+				Metrics:         result.Metrics,
+				UnusedEndpoints: matching.FindUnusedEndpoints(result.Dependencies, config.PublicRoutes),
+				Diagnostics:     result.Diagnostics,
+			}
+			if result.Suppressed != nil {
+				document.Suppressed = output.ConstructSuppressedList(result.Suppressed.Calls, result.Suppressed.Endpoints)
+			}
+			if len(cycles.Components) > 0 {
+				document.Cycles = &cycles
 			}
 
-			allServices, err := preprocessing.FindServices(config.ServiceDir)
+			var jsonString string
+			if report {
+				jsonString, err = output.SerializeDocument(document, true)
+			} else {
+				jsonString, err = output.SerializeAdjacencyList(document.Dependencies, true)
+			}
 			if err != nil {
 				return err
 			}
+
+			allServices := make([]string, 0, len(result.Services))
+			for _, service := range result.Services {
+				allServices = append(allServices, service.Name)
+			}
 			noReferenceToServices, noReferenceToAndFromServices := output.ConstructUnusedServicesLists(graph.Nodes, allServices)
 
 			err = printOutput(outputFilename, jsonString, noReferenceToServices, noReferenceToAndFromServices)
@@ -105,20 +132,266 @@ Output is an adjacency list of service dependencies in a JSON format`,
 				return err
 			}
 
+			output.PrintUnusedEndpoints(document.UnusedEndpoints)
+			output.PrintCycles(cycles)
+			if failOnCycles && len(cycles.Cycles) > 0 {
+				// the command was used correctly, so there is no need to print its usage
+				cmd.SilenceUsage = true
+				return violationsError(len(cycles.Cycles), "circular dependencies")
+			}
+
 			return nil
 		},
 	}
-	cmd.Flags().StringVarP(&projectDir, "project-directory", "p", "./", "project directory")
-	cmd.Flags().StringVarP(&serviceDir, "service-directory", "s", "./svc", "service directory")
-	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "toggle logging trace of unknown variables")
-	cmd.Flags().StringVarP(&envVars, "environment-variables", "e", "", "environment variable file")
+	bindAnalysisFlags(cmd, &config)
 	cmd.Flags().StringVarP(&outputFilename, "output-filename", "o", "", "output filename such as ./deps.json")
-	cmd.Flags().StringVarP(&serviceCallsDir, "servicecalls-directory", "c", "", "servicecalls package directory")
 	cmd.Flags().BoolVarP(&noColor, "no-color", "n", false, "disable colourful terminal output")
-	cmd.Flags().BoolVarP(&shallow, "shallow", "S", false, "toggle shallow scanning")
+	cmd.Flags().StringVar(&cycleProtocols, "cycle-protocols", output.AllProtocols, "protocols considered for cycle detection: all, sync or async")
+	cmd.Flags().BoolVar(&failOnCycles, "fail-on-cycles", false, "exit with a non-zero code when circular dependencies are found")
+	cmd.Flags().BoolVar(&report, "report", false, "output a document holding the metrics, cycles, unused endpoints, suppressed calls and diagnostics as well as the dependencies")
+	cmd.Flags().StringSliceVar(&config.PublicRoutes, "public-routes", nil, "routes that are called from outside the project, such as /health or service-1:/api/*")
 	return cmd
 }
 
+// bindAnalysisFlags registers the flags that configure an analysis run on the given command
+func bindAnalysisFlags(cmd *cobra.Command, config *RunConfig) {
+	cmd.Flags().StringVarP(&config.ProjectDir, "project-directory", "p", "./", "project directory")
+	cmd.Flags().StringVarP(&config.ServiceDir, "service-directory", "s", "./svc", "service directory")
+	cmd.Flags().BoolVarP(&config.Verbose, "verbose", "v", false, "toggle logging trace of unknown variables")
+	cmd.Flags().StringVarP(&config.EnvFile, "environment-variables", "e", "", "environment variable file, or a Docker Compose file")
+	cmd.Flags().StringVarP(&config.ServiceCallsDir, "servicecalls-directory", "c", "", "servicecalls package directory")
+	cmd.Flags().BoolVarP(&config.Shallow, "shallow", "S", false, "toggle shallow scanning")
+	cmd.Flags().BoolVar(&config.SingleProgram, "single-program", false, "load and build all services as a single program, which must be part of one module")
+	cmd.Flags().BoolVar(&config.NoCache, "no-cache", false, "analyse all services, without using or updating the cache of earlier results")
+	cmd.Flags().IntVarP(&config.Jobs, "jobs", "j", runtime.NumCPU(), "maximum number of services that are analysed concurrently")
+	cmd.Flags().StringVar(&config.Discovery, "discovery", netdep.DiscoverDirectories, "how services are found: directories, main-packages, workspace or config")
+	cmd.Flags().StringVar(&config.ServicesFile, "services-file", "", "YAML file listing the name and path of each service, used by --discovery config")
+	cmd.Flags().StringSliceVar(&config.Manifests, "manifests", []string{}, "Kubernetes manifests or helm template output, files or directories")
+	cmd.Flags().StringToStringVar(&config.DotenvFiles, "dotenv", map[string]string{}, "dotenv file of a service, such as orders=./orders.env")
+	cmd.Flags().StringVar(&config.Profile, "profile", "", "profile of the configuration file, which also selects the .env.<profile> files")
+	cmd.Flags().StringVar(&config.ConfigFile, "config", "", "project configuration file, by default "+projectconfig.FileName+" in the project directory")
+	cmd.Flags().StringSliceVar(&config.NameSources, "service-names", []string{netdep.NameFromDirectory}, "sources of service names in order of preference: directory, gomod, dockerfile or k8s")
+}
+
+// prepare makes the directories of the RunConfig absolute and verifies that all the input paths are valid
+func (config *RunConfig) prepare(outputFilename string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if config.Jobs < 1 {
+		return fmt.Errorf("invalid number of jobs specified: %d", config.Jobs)
+	}
+
+	if !preprocessing.IsValidDiscovery(config.Discovery) {
+		return fmt.Errorf("invalid service discovery specified: %s", config.Discovery)
+	}
+
+	for _, nameSource := range config.NameSources {
+		if !preprocessing.IsValidNameSource(nameSource) {
+			return fmt.Errorf("invalid service name source specified: %s", nameSource)
+		}
+	}
+
+	config.ProjectDir = ensureAbsolutePath(cwd, config.ProjectDir)
+	config.ServiceDir = ensureAbsolutePath(cwd, config.ServiceDir)
+
+	// the service directory is only used when each of its subdirectories is a service
+	serviceDir := ""
+	if config.Discovery == netdep.DiscoverDirectories {
+		serviceDir = config.ServiceDir
+	}
+
+	ok, err := areInputPathsValid(config.ProjectDir, serviceDir, config.ServiceCallsDir, config.EnvFile, outputFilename)
+	if !ok {
+		return err
+	}
+
+	for _, manifest := range config.Manifests {
+		if _, err := os.Stat(manifest); err != nil {
+			return fmt.Errorf("invalid manifests specified: %s", manifest)
+		}
+	}
+
+	if config.Discovery == netdep.DiscoverConfig && config.ServicesFile != "" {
+		config.servicePatterns, err = preprocessing.LoadServicePatterns(config.ServicesFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.Discovery == netdep.DiscoverConfig && len(config.servicePatterns) == 0 {
+		return fmt.Errorf("the config discovery requires a services file")
+	}
+
+	return nil
+}
+
+// loadConfigFile applies the project configuration file, if there is one, to the flags that were not set on the
+// command line and to the RunConfig. The output section of the file is only applied to the given flags of the command,
+// as the meaning of the output flags differs between commands.
+func (config *RunConfig) loadConfigFile(cmd *cobra.Command, outputFlags ...string) error {
+	path := config.ConfigFile
+	if path == "" {
+		var found bool
+		var err error
+		path, found, err = projectconfig.Find(config.ProjectDir)
+		if err != nil || !found {
+			return err
+		}
+	}
+
+	file, err := projectconfig.Load(path)
+	if err != nil {
+		return err
+	}
+
+	if config.Profile != "" {
+		if err := file.ApplyProfile(config.Profile); err != nil {
+			return err
+		}
+	}
+
+	discovery := file.Discovery
+	if discovery == "" && len(file.Services) > 0 {
+		discovery = netdep.DiscoverConfig
+	}
+
+	values := map[string]string{
+		"project-directory":      file.ProjectDirectory,
+		"service-directory":      file.ServiceDirectory,
+		"servicecalls-directory": file.ServicecallsDirectory,
+		"environment-variables":  file.EnvironmentVariables,
+		"discovery":              discovery,
+	}
+	if file.Shallow != nil {
+		values["shallow"] = strconv.FormatBool(*file.Shallow)
+	}
+	if file.Verbose != nil {
+		values["verbose"] = strconv.FormatBool(*file.Verbose)
+	}
+	for _, name := range outputFlags {
+		switch name {
+		case "output-filename":
+			values[name] = file.Output.File
+		case "format":
+			values[name] = file.Output.Format
+		}
+	}
+
+	// flags that are set on the command line override the values of the file
+	for name, value := range values {
+		flag := cmd.Flags().Lookup(name)
+		if value == "" || flag == nil || flag.Changed {
+			continue
+		}
+
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s in the configuration file: %w", name, err)
+		}
+	}
+
+	// lists are assigned directly, as the values of slice flags are parsed as CSV, which splits or rejects the values
+	// that hold commas or quotes
+	setList(cmd, "service-names", file.ServiceNames, &config.NameSources)
+	setList(cmd, "manifests", file.Manifests, &config.Manifests)
+	setList(cmd, "public-routes", file.PublicRoutes, &config.PublicRoutes)
+
+	config.servicePatterns = file.Services
+	config.dotenvFiles = file.Dotenv
+	config.ignoredServices = file.Ignore.Services
+	config.hosts = file.HostMappings()
+	config.flags = file.Flags
+	config.dependencies = make([]netdep.Dependency, 0, len(file.Dependencies))
+	for _, dependency := range file.Dependencies {
+		config.dependencies = append(config.dependencies, netdep.Dependency{
+			Source:   dependency.From,
+			Target:   dependency.To,
+			Protocol: dependency.Protocol,
+			URL:      dependency.URL,
+		})
+	}
+	config.rules = netdep.Rules{
+		ClientCalls:       file.Calls.Client,
+		ServerCalls:       file.Calls.Server,
+		IgnoredPackages:   file.Ignore.Packages,
+		MaxTraversalDepth: file.Calls.MaxTraversalDepth,
+		Exclusions:        make([]netdep.Exclusion, 0, len(file.Ignore.Calls)),
+	}
+	for _, exclusion := range file.Ignore.Calls {
+		config.rules.Exclusions = append(config.rules.Exclusions, netdep.Exclusion{
+			Service:  exclusion.Service,
+			Package:  exclusion.Package,
+			URL:      exclusion.URL,
+			Function: exclusion.Function,
+			Reason:   exclusion.Reason,
+		})
+	}
+
+	return nil
+}
+
+// setList assigns the list of the configuration file to target, unless it is empty or the named flag does not exist or
+// was set on the command line
+func setList(cmd *cobra.Command, name string, list []string, target *[]string) {
+	flag := cmd.Flags().Lookup(name)
+	if len(list) == 0 || flag == nil || flag.Changed {
+		return
+	}
+
+	*target = list
+}
+
+// options converts the RunConfig into the options of the analysis
+func (config *RunConfig) options() netdep.Options {
+	return netdep.Options{
+		ProjectDir:      config.ProjectDir,
+		ServiceDir:      config.ServiceDir,
+		EnvFile:         config.EnvFile,
+		ServiceCallsDir: config.ServiceCallsDir,
+		Verbose:         config.Verbose,
+		Shallow:         config.Shallow,
+		Jobs:            config.Jobs,
+		SingleProgram:   config.SingleProgram,
+		NoCache:         config.NoCache,
+		Discovery:       config.Discovery,
+		Services:        config.servicePatterns,
+		NameSources:     config.NameSources,
+		Rules:           config.rules,
+		IgnoredServices: config.ignoredServices,
+		Hosts:           config.hosts,
+		Manifests:       config.Manifests,
+		DotenvFiles:     config.allDotenvFiles(),
+		Profile:         config.Profile,
+		Flags:           config.flags,
+		Dependencies:    config.dependencies,
+	}
+}
+
+// allDotenvFiles combines the dotenv files of the configuration file with those of the flags, which replace them
+func (config *RunConfig) allDotenvFiles() map[string][]string {
+	dotenvFiles := make(map[string][]string)
+	for service, files := range config.dotenvFiles {
+		dotenvFiles[service] = files
+	}
+	for service, file := range config.DotenvFiles {
+		dotenvFiles[service] = []string{file}
+	}
+
+	return dotenvFiles
+}
+
+// buildDependencyGraph runs the discovery and matching stages for the given RunConfig
+func buildDependencyGraph(ctx context.Context, config RunConfig) (output.NodeGraph, error) {
+	result, err := discoverAllCalls(ctx, config)
+	if err != nil {
+		return output.NodeGraph{}, err
+	}
+
+	return result.Graph, nil
+}
+
 // ensureAbsolutePath makes sure the given path is absolute, or makes it absolute based on the current working directory
 func ensureAbsolutePath(cwd, pth string) string {
 	if !filepath.IsAbs(pth) {
@@ -156,7 +429,7 @@ func areInputPathsValid(projectDir, serviceDir, serviceCallsDir, envVars, output
 		return false, fmt.Errorf("invalid project directory specified: %s", projectDir)
 	}
 
-	if !pathOk(serviceDir) {
+	if !pathOk(serviceDir) && serviceDir != "" {
 		return false, fmt.Errorf("invalid service directory: %s", serviceDir)
 	}
 
@@ -202,131 +475,45 @@ func pathExists(path string) (bool, error) {
 	return false, err
 }
 
-// resolveEnvironmentValues calls resolving stage if the path is not unspecified(""), returns nil otherwise
-func resolveEnvironmentValues(path string) (map[string]map[string]string, error) {
-	if path == "" {
-		return nil, nil
-	}
-	return preprocessing.IndexEnvironmentVariables(path)
-}
-
-// discoverAllCalls calls the correct stages for loading, building,
-// filtering and discovering all client and server calls.
-func discoverAllCalls(config RunConfig) (*structures.Dependencies, error) {
-	// Filtering
-	services, err := preprocessing.FindServices(config.ServiceDir)
-	fmt.Printf("Starting to analyse %d services.\n", len(services))
-
-	if err != nil {
-		return nil, err
-	}
-
-	// resolve environment values
-	// TODO: Integrate the envVariables into discovery
-	envVariables, err := resolveEnvironmentValues(config.EnvFile)
+// discoverAllCalls analyses all services of the project, and reports its progress, the unresolved calls and any diagnostics
+func discoverAllCalls(ctx context.Context, config RunConfig) (*netdep.Result, error) {
+	project, err := netdep.NewProject(config.options())
 	if err != nil {
 		return nil, err
 	}
+	fmt.Printf("Starting to analyse %d services.\n", len(project.Services()))
 
-	analyserConfig := callanalyzer.DefaultConfigForFindingHTTPCalls()
-	analyserConfig.SetVerbose(config.Verbose)
-	analyserConfig.SetEnv(envVariables)
-
-	allClientTargets, allServerTargets, annotations, err := processEachService(&services, &config, &analyserConfig)
+	result, err := project.Analyze(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	consumers, producers, err := natsanalyzer.FindNATSCalls(config.ServiceDir)
-	if err != nil {
-		return nil, err
-	}
-
-	if config.Verbose {
-		output.PrintDiscoveredAnnotations(annotations)
-	}
-
-	dependencies := &structures.Dependencies{
-		Calls:     allClientTargets,
-		Endpoints: allServerTargets,
-		Consumers: consumers,
-		Producers: producers,
-	}
+	printAnalysisReport(result, config.Verbose)
 
-	return dependencies, err
+	return result, nil
 }
 
-// processEachService preprocesses and analyses each of the services using RunConfig and callanalyzer.AnalyserConfig
-func processEachService(services *[]string, config *RunConfig, analyserConfig *callanalyzer.AnalyserConfig) ([]*callanalyzer.CallTarget, []*callanalyzer.CallTarget, map[string]map[callanalyzer.Position]string, error) {
-	allClientTargets := make([]*callanalyzer.CallTarget, 0)
-	allServerTargets := make([]*callanalyzer.CallTarget, 0)
-	annotations := make(map[string]map[callanalyzer.Position]string)
-
-	analyserConfig.SetAnnotations(annotations)
-
-	packageCount := 0
-
-	internalCalls, serverTargets, err := servicecallsanalyzer.ParseServiceCallsPackage(config.ServiceCallsDir)
-	if err != nil {
-		return nil, nil, nil, err
-	}
-
-	allServerTargets = append(allServerTargets, *serverTargets...)
-	internalClientTargets := make([]*callanalyzer.CallTarget, 0)
-
-	for _, serviceDir := range *services {
-		serviceName := strings.Split(serviceDir, string(os.PathSeparator))[len(strings.Split(serviceDir, string(os.PathSeparator)))-1]
-
-		if config.Verbose {
-			fmt.Printf("Analysing service %s\n", serviceDir)
-		}
-
-		err := preprocessing.LoadAnnotations(serviceDir, serviceName, annotations)
-		if err != nil {
-			return nil, nil, nil, err
-		}
-
-		// There are some interesting internal calls so the tool should parse all methods
-		if len(internalCalls) != 0 {
-			err = servicecallsanalyzer.LoadServiceCalls(serviceDir, serviceName, internalCalls, &internalClientTargets)
-			if err != nil {
-				return nil, nil, nil, err
+// printAnalysisReport prints the number of calls of each service when verbose,
+// annotation suggestions for the unresolved calls, and the diagnostics of the analysis
+func printAnalysisReport(result *netdep.Result, verbose bool) {
+	if verbose {
+		for _, service := range result.Services {
+			if service.IsCached {
+				fmt.Printf("Loaded service %s from the cache\n", service.Dir)
 			}
+			color.Green("Found %d calls in service %s of which %d client call(s) and %d server call(s)",
+				service.ClientCalls+service.ServerCalls, service.Name, service.ClientCalls, service.ServerCalls)
 		}
+	}
 
-		// Load and build packages and proceed with discovery if the user
-		// Didn't ask for shallow scanning
-		if !config.Shallow {
-			// load packages
-			packagesInService, err := preprocessing.LoadAndBuildPackages(config.ProjectDir, serviceDir)
-			if err != nil {
-				return nil, nil, nil, err
-			}
-			packageCount += len(packagesInService)
-
-			// discover calls
-			clientCalls, serverCalls, err := discovery.DiscoverAll(packagesInService, analyserConfig)
-			if err != nil {
-				return nil, nil, nil, err
-			}
-
-			if config.Verbose {
-				clientSum := len(allClientTargets)
-				targetSum := len(clientCalls)
+	output.PrintAnnotationSuggestions(result.Unresolved)
 
-				color.Green("Found %d calls of which %d client call(s) and %d server call(s)", clientSum+targetSum, clientSum, targetSum)
-			}
+	output.PrintDiagnostics(result.Diagnostics)
 
-			// append
-			allClientTargets = append(allClientTargets, clientCalls...)
-			allServerTargets = append(allServerTargets, serverCalls...)
+	if verbose {
+		output.PrintDiscoveredAnnotations(result.Annotations)
+		if result.Suppressed != nil {
+			output.PrintSuppressed(output.ConstructSuppressedList(result.Suppressed.Calls, result.Suppressed.Endpoints))
 		}
 	}
-
-	allClientTargets = append(allClientTargets, internalClientTargets...)
-
-	if !config.Shallow && packageCount == 0 {
-		return nil, nil, nil, fmt.Errorf("no service to analyse were found")
-	}
-	return allClientTargets, allServerTargets, annotations, nil
 }
@@ -4,13 +4,18 @@ Copyright © 2022 TW Group 13C, Weave BV, TU Delft
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"lab.weave.nl/internships/tud-2022/netDep/helpers"
+	"lab.weave.nl/internships/tud-2022/netDep/netdep"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
 
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,7 +55,7 @@ func TestExecuteDepScanNoServicePackages(t *testing.T) {
 
 	err := runDepScanCmd.Execute()
 	assert.NotNil(t, err)
-	assert.Equal(t, "no service to analyse were found", err.Error())
+	assert.Equal(t, "no services to analyse were found", err.Error())
 }
 
 func TestExecuteDepScanNoMainFunctionFound(t *testing.T) {
@@ -180,3 +185,211 @@ func TestOutputToInvalidFile(t *testing.T) {
 	err := printOutput("/../badPath/", "{\"key\": \"dummyJSON\"}", nil, nil)
 	assert.NotNil(t, err)
 }
+
+func TestExecuteDepScanInvalidJobs(t *testing.T) {
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--jobs", "0"})
+
+	err := runDepScanCmd.Execute()
+	assert.EqualError(t, err, "invalid number of jobs specified: 0")
+}
+
+func TestExecuteDepScanInvalidDiscovery(t *testing.T) {
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--discovery", "helm"})
+
+	err := runDepScanCmd.Execute()
+	assert.EqualError(t, err, "invalid service discovery specified: helm")
+}
+
+func TestExecuteDepScanInvalidServiceNames(t *testing.T) {
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--service-names", "gomod,helm"})
+
+	err := runDepScanCmd.Execute()
+	assert.EqualError(t, err, "invalid service name source specified: helm")
+}
+
+func TestExecuteDepScanConfigDiscoveryWithoutServicesFile(t *testing.T) {
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{
+		"-p", filepath.Join(helpers.RootDir, "test", "example"),
+		"--discovery", "config",
+	})
+
+	err := runDepScanCmd.Execute()
+	assert.EqualError(t, err, "the config discovery requires a services file")
+}
+
+func TestExecuteDepScanConfigDiscovery(t *testing.T) {
+	projectDir := filepath.Join(helpers.RootDir, "test", "example")
+	servicesFile := filepath.Join(t.TempDir(), "services.yaml")
+	err := os.WriteFile(servicesFile, []byte("services:\n  - name: basic\n    path: svc/node-basic-http\n"), 0o600)
+	assert.Nil(t, err)
+
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{
+		"-p", projectDir,
+		"-s", filepath.Join(helpers.RootDir, "test", "empty"),
+		"--discovery", "config",
+		"--services-file", servicesFile,
+		"--no-cache",
+	})
+
+	err = runDepScanCmd.Execute()
+	assert.Nil(t, err)
+}
+
+// writeConfigFile writes a configuration file for the example project to a temporary directory and returns its path
+func writeConfigFile(t *testing.T, extra string) string {
+	t.Helper()
+
+	projectDir := filepath.Join(helpers.RootDir, "test", "example")
+	content := fmt.Sprintf("projectDirectory: %s\nserviceDirectory: %s\nshallow: true\n%s",
+		projectDir, filepath.Join(projectDir, "svc"), extra)
+
+	path := filepath.Join(t.TempDir(), ".netdep.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestExecuteDepScanConfigFile(t *testing.T) {
+	configFile := writeConfigFile(t, "output:\n  file: deps.json\n")
+
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile, "--no-cache"})
+
+	err := runDepScanCmd.Execute()
+	assert.Nil(t, err)
+
+	// the output file is relative to the configuration file
+	_, err = os.Stat(filepath.Join(filepath.Dir(configFile), "deps.json"))
+	assert.Nil(t, err)
+}
+
+func TestExecuteDepScanReport(t *testing.T) {
+	configFile := writeConfigFile(t, "")
+	outputFile := filepath.Join(t.TempDir(), "deps.json")
+
+	// by default, the output is the bare adjacency list
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile, "--no-cache", "-o", outputFile})
+	assert.Nil(t, runDepScanCmd.Execute())
+
+	data, err := os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	_, err = output.ParseAdjacencyList(data)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), `"dependencies"`)
+
+	runDepScanCmd = RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile, "--no-cache", "-o", outputFile, "--report", "--shallow=false"})
+	assert.Nil(t, runDepScanCmd.Execute())
+
+	data, err = os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "{\n\t\"dependencies\": "))
+
+	var document output.Document
+	assert.Nil(t, json.Unmarshal(data, &document))
+	assert.NotEmpty(t, document.Metrics)
+}
+
+func TestExecuteDepScanConfigFilePublicRoutes(t *testing.T) {
+	configFile := writeConfigFile(t, "publicRoutes: [/bar, \"node-gin-http:/*\"]\n")
+	outputFile := filepath.Join(t.TempDir(), "deps.json")
+
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile, "--no-cache", "-o", outputFile, "--report", "--shallow=false"})
+	assert.Nil(t, runDepScanCmd.Execute())
+
+	data, err := os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"/foo"`)
+	assert.NotContains(t, string(data), `"/bar"`)
+	assert.NotContains(t, string(data), `"/ping"`)
+
+	// the flag takes precedence over the configuration file
+	runDepScanCmd = RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile, "--no-cache", "-o", outputFile, "--report", "--shallow=false", "--public-routes", "/foo"})
+	assert.Nil(t, runDepScanCmd.Execute())
+
+	data, err = os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), `"/foo"`)
+	assert.Contains(t, string(data), `"/bar"`)
+	assert.Contains(t, string(data), `"/ping"`)
+}
+
+func TestLoadConfigFileLists(t *testing.T) {
+	configFile := writeConfigFile(t, "publicRoutes: [\"/search?q=a,b\", '/say \"hi\"']\nserviceNames: [gomod, directory]\nmanifests: [./k8s]\n")
+
+	config := RunConfig{}
+	cmd := &cobra.Command{}
+	bindAnalysisFlags(cmd, &config)
+	cmd.Flags().StringSliceVar(&config.PublicRoutes, "public-routes", nil, "")
+	assert.Nil(t, cmd.ParseFlags([]string{"--config", configFile, "--manifests", "./deploy.yaml"}))
+
+	assert.Nil(t, config.loadConfigFile(cmd))
+	assert.Equal(t, []string{"/search?q=a,b", `/say "hi"`}, config.PublicRoutes)
+	assert.Equal(t, []string{netdep.NameFromGoMod, netdep.NameFromDirectory}, config.NameSources)
+	// the flags that are set on the command line override the configuration file
+	assert.Equal(t, []string{"./deploy.yaml"}, config.Manifests)
+}
+
+func TestExecuteDepScanFlagsOverrideConfigFile(t *testing.T) {
+	configFile := writeConfigFile(t, "output:\n  file: deps.json\n")
+	outputFile := filepath.Join(t.TempDir(), "result.json")
+
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile, "--no-cache", "-o", outputFile})
+
+	err := runDepScanCmd.Execute()
+	assert.Nil(t, err)
+
+	_, err = os.Stat(outputFile)
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(filepath.Dir(configFile), "deps.json"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExecuteDepScanConfigFileInvalidDiscovery(t *testing.T) {
+	configFile := writeConfigFile(t, "discovery: services\n")
+
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile})
+
+	err := runDepScanCmd.Execute()
+	assert.EqualError(t, err, "invalid service discovery specified: services")
+}
+
+func TestExecuteDepScanMissingConfigFile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), ".netdep.yaml")
+
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile})
+
+	err := runDepScanCmd.Execute()
+	assert.EqualError(t, err, "the configuration file cannot be read: "+configFile)
+}
+
+func TestExecuteDepScanInvalidManifests(t *testing.T) {
+	projectDir := filepath.Join(helpers.RootDir, "test", "example")
+	manifests := filepath.Join(projectDir, "deploy")
+
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"-p", projectDir, "-s", filepath.Join(projectDir, "svc"), "--manifests", manifests})
+
+	err := runDepScanCmd.Execute()
+	assert.EqualError(t, err, "invalid manifests specified: "+manifests)
+}
+
+func TestExecuteDepScanConfigFileUnknownProfile(t *testing.T) {
+	configFile := writeConfigFile(t, "profiles:\n  prod:\n    environmentVariables: env/prod.yaml\n")
+
+	runDepScanCmd := RootCmd()
+	runDepScanCmd.SetArgs([]string{"--config", configFile, "--profile", "staging"})
+
+	err := runDepScanCmd.Execute()
+	assert.EqualError(t, err, "the profile staging is not defined in the configuration file")
+}
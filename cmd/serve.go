@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"lab.weave.nl/internships/tud-2022/netDep/server"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+)
+
+// ServeCmd returns a cobra command that analyses the project and serves the dependency graph over HTTP
+func ServeCmd() *cobra.Command {
+	var (
+		config  RunConfig
+		address string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the dependency graph over HTTP",
+		Long: `Analyses the project and serves the dependency graph as JSON over HTTP, with the following endpoints:
+  GET  /services                       all services
+  GET  /services/{name}/dependencies   the calls of the service, grouped by the service they target
+  GET  /services/{name}/dependents     the calls to the service, grouped by the service they originate from
+  GET  /edges?protocol=NATS            all calls, optionally of a single protocol
+  GET  /unresolved                     the calls of which the target could not be resolved
+  POST /refresh                        analyses the project again`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := config.loadConfigFile(cmd)
+			if err != nil {
+				return err
+			}
+
+			err = config.prepare("")
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			graphServer, err := server.New(func() (output.NodeGraph, error) {
+				return buildDependencyGraph(ctx, config)
+			})
+			if err != nil {
+				return err
+			}
+
+			return listenAndServe(ctx, address, graphServer.Handler())
+		},
+	}
+
+	bindAnalysisFlags(cmd, &config)
+	cmd.Flags().StringVarP(&address, "address", "a", "localhost:8080", "address to listen on")
+	return cmd
+}
+
+// listenAndServe serves the handler on the address until the context is cancelled
+func listenAndServe(ctx context.Context, address string, handler http.Handler) error {
+	const readHeaderTimeout = 10 * time.Second
+	httpServer := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+	color.HiGreen("Serving the dependency graph on http://%s", address)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	const shutdownTimeout = 5 * time.Second
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// once shut down, ListenAndServe returns http.ErrServerClosed, which is not an error of the command
+	return httpServer.Shutdown(shutdownCtx)
+}
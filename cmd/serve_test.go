@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeInvalidProjectDirectory(t *testing.T) {
+	serveCmd := ServeCmd()
+	serveCmd.SetArgs([]string{"-p", "./does-not-exist"})
+
+	err := serveCmd.Execute()
+	assert.ErrorContains(t, err, "invalid project directory specified")
+}
+
+func TestListenAndServeStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := listenAndServe(ctx, "localhost:0", http.NotFoundHandler())
+	assert.NoError(t, err)
+}
+
+func TestListenAndServeInvalidAddress(t *testing.T) {
+	err := listenAndServe(context.Background(), "localhost:-1", http.NotFoundHandler())
+	assert.Error(t, err)
+}
@@ -0,0 +1,573 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"lab.weave.nl/internships/tud-2022/netDep/netdep"
+	"lab.weave.nl/internships/tud-2022/netDep/projectconfig"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/preprocessing"
+)
+
+// The ways in which the watch command reports a new analysis result
+const (
+	emitDiff  = "diff"  // emitDiff prints the changes compared to the previous result
+	emitGraph = "graph" // emitGraph prints the complete dependency graph
+)
+
+// WatchCmd returns a cobra command that analyses the project, watches its files,
+// and re-analyses the services of which files changed
+func WatchCmd() *cobra.Command {
+	var (
+		config         RunConfig
+		emit           string
+		format         string
+		outputFilename string
+		debounce       time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Re-analyse services whenever their files change",
+		Long: `Analyses the project and watches its files. When the files of a service change, only that service is analysed
+again. Changes to Go files outside of the services (e.g. shared libraries), go.mod, go.sum, the configuration file or the
+environment variable file cause all services to be analysed again. After each analysis, either the changes to the dependency graph (diff),
+including the circular dependencies that were introduced or resolved, or the complete graph and its circular
+dependencies (graph) are printed. When an output file is given, it always holds the latest dependency graph.`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if emit != emitDiff && emit != emitGraph {
+				return fmt.Errorf("invalid emit mode specified: %s", emit)
+			}
+
+			session := &watchSession{
+				commandLine: &watchFlags{
+					config:         config,
+					format:         format,
+					outputFilename: outputFilename,
+					changed:        make(map[string]bool),
+				},
+				emit: emit,
+				out:  cmd.OutOrStdout(),
+			}
+			cmd.Flags().Visit(func(flag *pflag.Flag) {
+				session.commandLine.changed[flag.Name] = true
+			})
+
+			err := session.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			return session.run(ctx, debounce)
+		},
+	}
+
+	bindAnalysisFlags(cmd, &config)
+	cmd.Flags().StringVar(&emit, "emit", emitDiff, "what to print after each analysis: diff or graph")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "format of the diff: text, json or markdown")
+	cmd.Flags().StringVarP(&outputFilename, "output-filename", "o", "", "file that holds the latest dependency graph, such as ./deps.json")
+	cmd.Flags().DurationVar(&debounce, "debounce", 500*time.Millisecond, "time to wait for further changes before analysing") //nolint:gomnd
+	return cmd
+}
+
+// watchFlags are the values of the flags of the watch command as given on the command line,
+// to which the configuration file is applied again when it changes
+type watchFlags struct {
+	config         RunConfig
+	format         string
+	outputFilename string
+	changed        map[string]bool // changed holds the names of the flags that were set on the command line
+}
+
+// watchSession holds the state of the watch command between analyses
+type watchSession struct {
+	commandLine    *watchFlags // commandLine is nil when the options are not read from the command line
+	config         RunConfig
+	emit           string
+	format         string
+	outputFilename string
+	out            io.Writer
+
+	project       *netdep.Project
+	services      []string          // services are the directories of the services of the project
+	serviceNames  map[string]string // serviceNames maps the directories of the services to their names
+	adjacencyList output.AdjacencyList
+
+	watcher *fsnotify.Watcher // watcher is nil when the files are not watched
+	watched map[string]bool   // watched holds the directories that were added to the watcher by watch
+}
+
+// run performs the initial analysis and re-analyses the project on changes, until the context is cancelled
+func (session *watchSession) run(ctx context.Context, debounce time.Duration) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	session.watcher = watcher
+	err = session.watch(watcher)
+	if err != nil {
+		return err
+	}
+
+	err = session.analyseAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		changedPaths, ok := collectChanges(ctx, watcher, debounce)
+		if !ok {
+			return nil
+		}
+
+		err = session.update(ctx, changedPaths)
+		if err != nil && ctx.Err() == nil {
+			// keep watching, as the next change may fix the error
+			color.Red("Analysis failed: %s", err)
+		}
+	}
+}
+
+// watch adds the directories of the project, and of the files and services outside of it, to the watcher.
+// The directories of the configured dotenv files are watched, as they may be outside of the project directory.
+// When called again after the configuration changed, the directories that are no longer needed are removed.
+func (session *watchSession) watch(watcher *fsnotify.Watcher) error {
+	dirs := make(map[string]bool)
+	err := collectDirs(dirs, session.config.ProjectDir)
+	if err != nil {
+		return err
+	}
+
+	// the service directory and the configuration file may be outside of the project directory
+	serviceDir := session.config.ServiceDir
+	if session.config.Discovery == netdep.DiscoverDirectories && !isWithin(serviceDir, session.config.ProjectDir) && isDir(serviceDir) {
+		err = collectDirs(dirs, serviceDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	files := []string{session.config.EnvFile, session.config.ConfigFile}
+	for _, dotenvFiles := range session.config.allDotenvFiles() {
+		files = append(files, dotenvFiles...)
+	}
+
+	for _, file := range files {
+		if file != "" {
+			dirs[filepath.Dir(file)] = true
+		}
+	}
+
+	for _, manifest := range session.config.Manifests {
+		if isDir(manifest) {
+			err = collectDirs(dirs, manifest)
+			if err != nil {
+				return err
+			}
+		} else {
+			dirs[filepath.Dir(manifest)] = true
+		}
+	}
+
+	for dir := range dirs {
+		if !session.watched[dir] {
+			err = watcher.Add(dir)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for dir := range session.watched {
+		if !dirs[dir] {
+			// the directory may have been removed, in which case it is no longer watched
+			_ = watcher.Remove(dir)
+		}
+	}
+
+	session.watched = dirs
+	return nil
+}
+
+// loadConfig applies the configuration file to the flags that were given on the command line, and prepares the
+// options of the analysis. It does nothing when the options are not read from the command line.
+func (session *watchSession) loadConfig() error {
+	if session.commandLine == nil {
+		return nil
+	}
+
+	// the configuration file is applied to new flags, as it may have set some of the flags before
+	config := RunConfig{}
+	var format, outputFilename string
+	cmd := &cobra.Command{}
+	bindAnalysisFlags(cmd, &config)
+	cmd.Flags().StringVar(&format, "format", "", "")
+	cmd.Flags().StringVar(&outputFilename, "output-filename", "", "")
+
+	config = session.commandLine.config
+	format = session.commandLine.format
+	outputFilename = session.commandLine.outputFilename
+	for name := range session.commandLine.changed {
+		if flag := cmd.Flags().Lookup(name); flag != nil {
+			flag.Changed = true
+		}
+	}
+
+	err := config.loadConfigFile(cmd, "output-filename", "format")
+	if err != nil {
+		return err
+	}
+
+	if !isValidDiffFormat(format) {
+		return fmt.Errorf("invalid output format specified: %s", format)
+	}
+
+	err = config.prepare(outputFilename)
+	if err != nil {
+		return err
+	}
+
+	// the environment variable file, configuration file, manifests and dotenv files are compared to the (absolute)
+	// paths of changed files
+	for _, file := range []*string{&config.EnvFile, &config.ConfigFile} {
+		if *file != "" {
+			*file, err = filepath.Abs(*file)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	manifests := make([]string, len(config.Manifests))
+	for i, manifest := range config.Manifests {
+		manifests[i], err = filepath.Abs(manifest)
+		if err != nil {
+			return err
+		}
+	}
+	config.Manifests = manifests
+
+	// the dotenv files are copied, as the maps of the flags are shared with the command line
+	dotenvFiles := make(map[string][]string, len(config.dotenvFiles))
+	for service, files := range config.dotenvFiles {
+		for _, file := range files {
+			file, err = filepath.Abs(file)
+			if err != nil {
+				return err
+			}
+			dotenvFiles[service] = append(dotenvFiles[service], file)
+		}
+	}
+	config.dotenvFiles = dotenvFiles
+	flagDotenvFiles := make(map[string]string, len(config.DotenvFiles))
+	for service, file := range config.DotenvFiles {
+		flagDotenvFiles[service], err = filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+	}
+	config.DotenvFiles = flagDotenvFiles
+
+	session.config = config
+	session.format = format
+	session.outputFilename = outputFilename
+	return nil
+}
+
+// analyseAll finds the services of the project and analyses all of them
+func (session *watchSession) analyseAll(ctx context.Context) error {
+	project, err := netdep.NewProject(session.config.options())
+	if err != nil {
+		return err
+	}
+
+	result, err := project.Analyze(ctx)
+	if err != nil {
+		return err
+	}
+
+	session.project = project
+	session.services = project.Services()
+	session.serviceNames = make(map[string]string, len(result.Services))
+	for _, service := range result.Services {
+		session.serviceNames[service.Dir] = service.Name
+	}
+
+	return session.report(result)
+}
+
+// update re-analyses the services affected by the changed paths
+func (session *watchSession) update(ctx context.Context, changedPaths []string) error {
+	serviceDirs, analyseAll := session.affectedServices(changedPaths)
+	if !analyseAll && len(serviceDirs) == 0 {
+		return nil
+	}
+
+	if analyseAll || session.project == nil {
+		color.HiGreen("Files changed, analysing all services")
+
+		// the configuration file may have changed, so its options are applied again, and the files it refers to watched
+		err := session.loadConfig()
+		if err != nil {
+			return err
+		}
+
+		if session.watcher != nil {
+			err = session.watch(session.watcher)
+			if err != nil {
+				return err
+			}
+		}
+
+		return session.analyseAll(ctx)
+	}
+
+	names := make([]string, 0, len(serviceDirs))
+	for _, serviceDir := range serviceDirs {
+		names = append(names, session.serviceNames[serviceDir])
+	}
+	color.HiGreen("Files changed, analysing %s", strings.Join(names, ", "))
+
+	result, err := session.project.Analyze(ctx, serviceDirs...)
+	if err != nil {
+		return err
+	}
+
+	return session.report(result)
+}
+
+// affectedServices determines the (sorted) directories of the services that the changed paths belong to.
+// Returns true if all services are to be analysed again: when shared sources, go.mod, go.sum, go.work, the configuration
+// file, the environment variable file, the manifests or dotenv files changed, or when a service was added or removed.
+// The environment of the project is read when it is created, so a changed dotenv file requires a new project.
+func (session *watchSession) affectedServices(changedPaths []string) ([]string, bool) {
+	if session.services == nil {
+		return nil, true
+	}
+
+	affected := make(map[string]bool)
+
+	for _, changedPath := range changedPaths {
+		name := filepath.Base(changedPath)
+		isSource := strings.HasSuffix(name, ".go") || name == "go.mod" || name == "go.sum" || name == "go.work"
+		isDotenv := name == preprocessing.DotenvFileName || strings.HasPrefix(name, preprocessing.DotenvFileName+".")
+
+		if changedPath == session.config.EnvFile || isDotenv || session.isDotenvFile(changedPath) ||
+			session.isConfigFile(changedPath) || session.isManifest(changedPath) {
+			return nil, true
+		}
+
+		serviceDir, isInService := session.serviceOf(changedPath)
+		switch {
+		case isInService && changedPath == serviceDir && !isDir(serviceDir):
+			// a service was removed
+			return nil, true
+		case isInService && isSource:
+			affected[serviceDir] = true
+		case !isInService && filepath.Dir(changedPath) == session.config.ServiceDir && isDir(changedPath):
+			// a service was added to the service directory
+			return nil, true
+		case !isInService && isSource:
+			// a file outside the services, such as a shared library or a new main package
+			return nil, true
+		}
+	}
+
+	serviceDirs := make([]string, 0, len(affected))
+	for serviceDir := range affected {
+		serviceDirs = append(serviceDirs, serviceDir)
+	}
+	sort.Strings(serviceDirs)
+
+	return serviceDirs, false
+}
+
+// report prints the result of the latest analysis, and writes the dependency graph to the output file if set
+func (session *watchSession) report(result *netdep.Result) error {
+	output.PrintDiagnostics(result.Diagnostics)
+
+	adjacencyList := output.ConstructAdjacencyList(result.Graph)
+	jsonString, err := output.SerializeAdjacencyList(adjacencyList, true)
+	if err != nil {
+		return err
+	}
+
+	if session.outputFilename != "" {
+		const filePerm = 0o600
+		err = os.WriteFile(session.outputFilename, []byte(jsonString), filePerm)
+		if err != nil {
+			return err
+		}
+	}
+
+	previous := session.adjacencyList
+	session.adjacencyList = adjacencyList
+
+	if session.emit == emitGraph || previous == nil {
+		_, err = fmt.Fprintln(session.out, jsonString)
+		output.PrintCycles(output.FindCycles(result.Graph, output.AllProtocols))
+		return err
+	}
+
+	diffString, err := formatDiff(output.DiffAdjacencyLists(previous, adjacencyList), session.format)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(session.out, diffString)
+	return err
+}
+
+// serviceOf returns the directory of the (innermost) service that contains the path, if any
+func (session *watchSession) serviceOf(changedPath string) (string, bool) {
+	found := ""
+	for _, serviceDir := range session.services {
+		if isWithin(changedPath, serviceDir) && len(serviceDir) > len(found) {
+			found = serviceDir
+		}
+	}
+
+	return found, found != ""
+}
+
+// isConfigFile checks whether the path is the configuration file, or the file that is looked for in the project directory
+func (session *watchSession) isConfigFile(changedPath string) bool {
+	if session.config.ConfigFile != "" {
+		return changedPath == session.config.ConfigFile
+	}
+
+	return changedPath == filepath.Join(session.config.ProjectDir, projectconfig.FileName)
+}
+
+// isDotenvFile checks whether the path is one of the dotenv files that are configured for the services
+func (session *watchSession) isDotenvFile(changedPath string) bool {
+	for _, files := range session.config.allDotenvFiles() {
+		for _, file := range files {
+			if changedPath == file {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isManifest checks whether the path is one of the manifests, or is in one of the directories of manifests
+func (session *watchSession) isManifest(changedPath string) bool {
+	for _, manifest := range session.config.Manifests {
+		if isWithin(changedPath, manifest) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectChanges waits for changes and returns the changed paths once no further changes were seen for the debounce
+// duration. Returns false if the context is cancelled or the watcher is closed.
+func collectChanges(ctx context.Context, watcher *fsnotify.Watcher, debounce time.Duration) ([]string, bool) {
+	changed := make(map[string]bool)
+	var timer <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil, false
+			}
+
+			// watch directories that are created after the watch started
+			if event.Op&fsnotify.Create != 0 && isDir(event.Name) {
+				if err := addDirsToWatcher(watcher, event.Name); err != nil {
+					color.Yellow("Could not watch %s: %s", event.Name, err)
+				}
+			}
+
+			changed[event.Name] = true
+			timer = time.After(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil, false
+			}
+			color.Yellow("Error while watching files: %s", err)
+		case <-timer:
+			paths := make([]string, 0, len(changed))
+			for changedPath := range changed {
+				paths = append(paths, changedPath)
+			}
+			sort.Strings(paths)
+
+			return paths, true
+		}
+	}
+}
+
+// addDirsToWatcher adds the directory and its subdirectories to the watcher, skipping hidden directories
+func addDirsToWatcher(watcher *fsnotify.Watcher, root string) error {
+	dirs := make(map[string]bool)
+	err := collectDirs(dirs, root)
+	if err != nil {
+		return err
+	}
+
+	for dir := range dirs {
+		err = watcher.Add(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectDirs adds the directory and its subdirectories to dirs, skipping hidden directories
+func collectDirs(dirs map[string]bool, root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if path != root && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		dirs[path] = true
+		return nil
+	})
+}
+
+// isWithin checks whether the path is the directory or is in it
+func isWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// isDir checks whether the path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
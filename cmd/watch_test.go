@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+
+	"lab.weave.nl/internships/tud-2022/netDep/netdep"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+)
+
+func TestWatchInvalidEmit(t *testing.T) {
+	watchCmd := WatchCmd()
+	watchCmd.SetArgs([]string{"--emit", "html"})
+
+	err := watchCmd.Execute()
+	assert.EqualError(t, err, "invalid emit mode specified: html")
+}
+
+func TestWatchInvalidFormat(t *testing.T) {
+	watchCmd := WatchCmd()
+	watchCmd.SetArgs([]string{"--format", "xml"})
+
+	err := watchCmd.Execute()
+	assert.EqualError(t, err, "invalid output format specified: xml")
+}
+
+// newTestWatchSession creates a project with the services svc-a and svc-b and a shared library
+func newTestWatchSession(t *testing.T) (*watchSession, string) {
+	t.Helper()
+
+	projectDir := t.TempDir()
+	serviceDir := filepath.Join(projectDir, "svc")
+	for _, dir := range []string{"svc/svc-a/handlers", "svc/svc-b", "lib"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(projectDir, dir), 0o700))
+	}
+
+	session := &watchSession{
+		config: RunConfig{
+			ProjectDir: projectDir,
+			ServiceDir: serviceDir,
+			EnvFile:    filepath.Join(projectDir, ".env"),
+			Manifests:  []string{filepath.Join(projectDir, "deploy")},
+		},
+		services: []string{filepath.Join(serviceDir, "svc-a"), filepath.Join(serviceDir, "svc-b")},
+	}
+
+	return session, projectDir
+}
+
+func TestAffectedServices(t *testing.T) {
+	session, projectDir := newTestWatchSession(t)
+
+	serviceDirs, analyseAll := session.affectedServices([]string{
+		filepath.Join(projectDir, "svc/svc-b/main.go"),
+		filepath.Join(projectDir, "svc/svc-a/handlers/users.go"),
+		filepath.Join(projectDir, "svc/svc-a/README.md"),
+	})
+
+	assert.False(t, analyseAll)
+	assert.Equal(t, []string{filepath.Join(projectDir, "svc/svc-a"), filepath.Join(projectDir, "svc/svc-b")}, serviceDirs)
+}
+
+func TestAffectedServicesIgnoresOtherFiles(t *testing.T) {
+	session, projectDir := newTestWatchSession(t)
+
+	serviceDirs, analyseAll := session.affectedServices([]string{
+		filepath.Join(projectDir, "svc/svc-a/notes.txt"),
+		filepath.Join(projectDir, "svc/deps.json"),
+		filepath.Join(projectDir, "README.md"),
+	})
+
+	assert.False(t, analyseAll)
+	assert.Empty(t, serviceDirs)
+}
+
+func TestAffectedServicesAll(t *testing.T) {
+	session, projectDir := newTestWatchSession(t)
+	assert.NoError(t, os.MkdirAll(filepath.Join(projectDir, "svc/svc-c"), 0o700))
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "shared library", path: "lib/util.go"},
+		{name: "project module", path: "go.mod"},
+		{name: "environment variables", path: ".env"},
+		{name: "configuration file", path: ".netdep.yaml"},
+		{name: "dotenv file", path: "svc/svc-b/.env.staging"},
+		{name: "manifests", path: "deploy/templates/deployment.yaml"},
+		{name: "added service", path: "svc/svc-c"},
+		{name: "removed service", path: "svc/svc-d"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.name == "removed service" {
+				session.services = append(session.services, filepath.Join(projectDir, test.path))
+			}
+
+			_, analyseAll := session.affectedServices([]string{filepath.Join(projectDir, test.path)})
+			assert.True(t, analyseAll)
+		})
+	}
+}
+
+func TestWatchDotenvChange(t *testing.T) {
+	projectDir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"svc/orders/main.go": "package main\n\nimport (\n\t\"net/http\"\n\t\"os\"\n)\n\nfunc main() {\n" +
+			"\t_, _ = http.Get(os.Getenv(\"USERS_URL\") + \"/users\")\n}\n",
+		"svc/orders/.env": "USERS_URL=http://localhost:8081\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(projectDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	session := &watchSession{
+		config: RunConfig{
+			ProjectDir: projectDir,
+			ServiceDir: filepath.Join(projectDir, "svc"),
+			Discovery:  netdep.DiscoverDirectories,
+			Jobs:       1,
+			NoCache:    true,
+		},
+		emit: emitGraph,
+		out:  io.Discard,
+	}
+	assert.NoError(t, session.analyseAll(context.Background()))
+	assert.Equal(t, "http://localhost:8081/users", session.adjacencyList["orders"][0].Calls[0].URL)
+
+	dotenvFile := filepath.Join(projectDir, "svc/orders/.env")
+	assert.NoError(t, os.WriteFile(dotenvFile, []byte("USERS_URL=http://users:8080\n"), 0o600))
+	assert.NoError(t, session.update(context.Background(), []string{dotenvFile}))
+	assert.Equal(t, "http://users:8080/users", session.adjacencyList["orders"][0].Calls[0].URL)
+}
+
+func TestWatchReloadsConfigFile(t *testing.T) {
+	projectDir := t.TempDir()
+	serviceDir := filepath.Join(projectDir, "svc")
+	assert.NoError(t, os.Mkdir(serviceDir, 0o700))
+	configFile := filepath.Join(projectDir, ".netdep.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte("serviceNames: [gomod]\nshallow: false\n"), 0o600))
+
+	session := &watchSession{
+		commandLine: &watchFlags{
+			config: RunConfig{
+				ProjectDir:  projectDir,
+				ServiceDir:  serviceDir,
+				Shallow:     true,
+				Jobs:        1,
+				Discovery:   netdep.DiscoverDirectories,
+				NameSources: []string{netdep.NameFromDirectory},
+			},
+			format:  "text",
+			changed: map[string]bool{"project-directory": true, "service-directory": true, "shallow": true},
+		},
+	}
+
+	assert.NoError(t, session.loadConfig())
+	assert.Equal(t, []string{netdep.NameFromGoMod}, session.config.NameSources)
+	// the flags that are set on the command line override the configuration file
+	assert.True(t, session.config.Shallow)
+
+	// the changed configuration file replaces the values it set before
+	assert.NoError(t, os.WriteFile(configFile, []byte("serviceNames: [k8s, directory]\n"), 0o600))
+	_, analyseAll := session.affectedServices([]string{configFile})
+	assert.True(t, analyseAll)
+
+	assert.NoError(t, session.loadConfig())
+	assert.Equal(t, []string{netdep.NameFromKubernetes, netdep.NameFromDirectory}, session.config.NameSources)
+	assert.True(t, session.config.Shallow)
+}
+
+func TestWatchServiceDirOutsideProject(t *testing.T) {
+	projectDir := t.TempDir()
+	serviceDir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(serviceDir, "svc-a"), 0o700))
+
+	session := &watchSession{config: RunConfig{ProjectDir: projectDir, ServiceDir: serviceDir, Discovery: netdep.DiscoverDirectories}}
+
+	watcher, err := fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+	assert.NoError(t, session.watch(watcher))
+
+	changedFile := filepath.Join(serviceDir, "svc-a", "main.go")
+	assert.NoError(t, os.WriteFile(changedFile, []byte("package main\n"), 0o600))
+	paths, ok := collectChanges(context.Background(), watcher, 50*time.Millisecond)
+	assert.True(t, ok)
+	assert.Contains(t, paths, changedFile)
+}
+
+// TestWatchConfiguredDotenvFiles checks that the dotenv files of the configuration file and the flags are watched,
+// also outside the project directory, and cause all services to be analysed again
+func TestWatchConfiguredDotenvFiles(t *testing.T) {
+	projectDir := t.TempDir()
+	serviceDir := filepath.Join(projectDir, "svc")
+	assert.NoError(t, os.Mkdir(serviceDir, 0o700))
+	configDotenvFile := filepath.Join(t.TempDir(), "orders.env")
+	flagDotenvFile := filepath.Join(t.TempDir(), "users.env")
+	for _, file := range []string{configDotenvFile, flagDotenvFile} {
+		assert.NoError(t, os.WriteFile(file, []byte("USERS_URL=http://users:8080\n"), 0o600))
+	}
+
+	// the paths in the configuration file are relative to its directory
+	relativeDotenvFile, err := filepath.Rel(projectDir, configDotenvFile)
+	assert.NoError(t, err)
+	configFile := filepath.Join(projectDir, ".netdep.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte("dotenv:\n  orders: ["+relativeDotenvFile+"]\n"), 0o600))
+
+	session := &watchSession{
+		commandLine: &watchFlags{
+			config: RunConfig{
+				ProjectDir:  projectDir,
+				ServiceDir:  serviceDir,
+				Jobs:        1,
+				Discovery:   netdep.DiscoverDirectories,
+				DotenvFiles: map[string]string{"users": flagDotenvFile},
+			},
+			format:  "text",
+			changed: map[string]bool{"project-directory": true, "service-directory": true, "dotenv": true},
+		},
+		services: []string{},
+	}
+	assert.NoError(t, session.loadConfig())
+
+	for _, file := range []string{configDotenvFile, flagDotenvFile} {
+		_, analyseAll := session.affectedServices([]string{file})
+		assert.True(t, analyseAll)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+	assert.NoError(t, session.watch(watcher))
+
+	// the context ends the wait if the change is not seen
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, os.WriteFile(configDotenvFile, []byte("USERS_URL=http://users:8081\n"), 0o600))
+	paths, ok := collectChanges(ctx, watcher, 50*time.Millisecond)
+	assert.True(t, ok)
+	assert.Contains(t, paths, configDotenvFile)
+}
+
+// TestWatchReloadUpdatesWatcher checks that the files the configuration file refers to are watched again once it changed,
+// and that the services are known by their resolved names
+func TestWatchReloadUpdatesWatcher(t *testing.T) {
+	projectDir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                "module example.com/shop\n\ngo 1.17\n",
+		"svc/orders/main.go":    "package main\n\nfunc main() {}\n",
+		"svc/orders/Dockerfile": "FROM scratch\nLABEL service=order-service\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(projectDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	oldDotenvFile := filepath.Join(t.TempDir(), "orders.env")
+	newDotenvFile := filepath.Join(t.TempDir(), "orders.env")
+	for _, file := range []string{oldDotenvFile, newDotenvFile} {
+		assert.NoError(t, os.WriteFile(file, []byte("USERS_URL=http://users:8080\n"), 0o600))
+	}
+	configFile := filepath.Join(projectDir, ".netdep.yaml")
+	writeConfig := func(dotenvFile string) {
+		assert.NoError(t, os.WriteFile(configFile, []byte("serviceNames: [dockerfile]\ndotenv:\n  order-service: ["+dotenvFile+"]\n"), 0o600))
+	}
+	writeConfig(oldDotenvFile)
+
+	watcher, err := fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	session := &watchSession{
+		commandLine: &watchFlags{
+			config: RunConfig{
+				ProjectDir:  projectDir,
+				ServiceDir:  filepath.Join(projectDir, "svc"),
+				Jobs:        1,
+				NoCache:     true,
+				Discovery:   netdep.DiscoverDirectories,
+				NameSources: []string{netdep.NameFromDirectory},
+			},
+			format:  "text",
+			changed: map[string]bool{"project-directory": true, "service-directory": true},
+		},
+		emit:    emitGraph,
+		out:     io.Discard,
+		watcher: watcher,
+	}
+	assert.NoError(t, session.loadConfig())
+	assert.NoError(t, session.watch(watcher))
+	assert.NoError(t, session.analyseAll(context.Background()))
+	assert.Equal(t, "order-service", session.serviceNames[filepath.Join(projectDir, "svc", "orders")])
+	assert.True(t, session.watched[filepath.Dir(oldDotenvFile)])
+
+	writeConfig(newDotenvFile)
+	assert.NoError(t, session.update(context.Background(), []string{configFile}))
+	assert.True(t, session.watched[filepath.Dir(newDotenvFile)])
+	assert.False(t, session.watched[filepath.Dir(oldDotenvFile)])
+
+	// the context ends the wait if the change is not seen
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, os.WriteFile(newDotenvFile, []byte("USERS_URL=http://users:8081\n"), 0o600))
+	paths, ok := collectChanges(ctx, watcher, 50*time.Millisecond)
+	assert.True(t, ok)
+	assert.Contains(t, paths, newDotenvFile)
+}
+
+// TestWatchReportCycles checks that the diff printed after an analysis lists the circular dependencies that were introduced
+func TestWatchReportCycles(t *testing.T) {
+	session, _ := newTestWatchSession(t)
+	var out bytes.Buffer
+	session.out = &out
+	session.emit = emitDiff
+	session.format = "text"
+
+	nodeA := &output.ServiceNode{ServiceName: "svc-a"}
+	nodeB := &output.ServiceNode{ServiceName: "svc-b"}
+	graph := output.NodeGraph{
+		Nodes: []*output.ServiceNode{nodeA, nodeB},
+		Edges: []*output.ConnectionEdge{{Call: output.NetworkCall{Protocol: "HTTP", URL: "http://svc-b:80/"}, Source: nodeA, Target: nodeB}},
+	}
+	assert.NoError(t, session.report(&netdep.Result{Graph: graph}))
+
+	out.Reset()
+	graph.Edges = append(graph.Edges, &output.ConnectionEdge{Call: output.NetworkCall{Protocol: "HTTP", URL: "http://svc-a:80/"}, Source: nodeB, Target: nodeA})
+	assert.NoError(t, session.report(&netdep.Result{Graph: graph}))
+	assert.Contains(t, out.String(), "Added circular dependencies:\n\t+ svc-a -> svc-b -> svc-a\n")
+}
+
+func TestCollectChanges(t *testing.T) {
+	dir := t.TempDir()
+
+	watcher, err := fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+	assert.NoError(t, addDirsToWatcher(watcher, dir))
+
+	// a directory created during the watch is watched as well
+	newDir := filepath.Join(dir, "svc-c")
+	assert.NoError(t, os.Mkdir(newDir, 0o700))
+	paths, ok := collectChanges(context.Background(), watcher, 50*time.Millisecond)
+	assert.True(t, ok)
+	assert.Contains(t, paths, newDir)
+
+	newFile := filepath.Join(newDir, "main.go")
+	assert.NoError(t, os.WriteFile(newFile, []byte("package main\n"), 0o600))
+	paths, ok = collectChanges(context.Background(), watcher, 50*time.Millisecond)
+	assert.True(t, ok)
+	assert.Contains(t, paths, newFile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok = collectChanges(ctx, watcher, 50*time.Millisecond)
+	assert.False(t, ok)
+}
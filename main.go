@@ -20,9 +20,27 @@ func runRoot() {
 	rootCmd := cmd.RootCmd()
 	// add the subcommand for generating a manpage
 	rootCmd.AddCommand(cmd.GenManpageCmd(rootCmd))
+	// add the subcommand for comparing dependency graphs
+	rootCmd.AddCommand(cmd.DiffCmd())
+	// add the subcommand for checking the graph against a policy
+	rootCmd.AddCommand(cmd.CheckCmd())
+	// add the subcommand for linting the annotations
+	rootCmd.AddCommand(cmd.LintAnnotationsCmd())
+	// add the subcommand for inserting annotations
+	rootCmd.AddCommand(cmd.AnnotateCmd())
+	// add the subcommand for computing service metrics
+	rootCmd.AddCommand(cmd.MetricsCmd())
+	// add the subcommand for managing the cache
+	rootCmd.AddCommand(cmd.CacheCmd())
+	// add the subcommand for re-analysing services on changes
+	rootCmd.AddCommand(cmd.WatchCmd())
+	// add the subcommand for serving the graph over HTTP
+	rootCmd.AddCommand(cmd.ServeCmd())
+	// add the subcommand for scaffolding a configuration file
+	rootCmd.AddCommand(cmd.InitCmd())
 	err := rootCmd.Execute()
 	if err != nil {
-		// report an unsuccessful run
-		os.Exit(1)
+		// report an unsuccessful run, or a run that found violations
+		os.Exit(cmd.ExitCode(err))
 	}
 }
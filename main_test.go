@@ -13,7 +13,7 @@ func TestRunRootSmokeTest(_ *testing.T) {
 	dummySvcDir := filepath.Join(helpers.RootDir, "test", "example", "svc")
 
 	osArgsBackup := os.Args
-	os.Args = []string{"netDep.exe", "-p", dummyProjDir, "-s", dummySvcDir}
+	os.Args = []string{"netDep.exe", "-p", dummyProjDir, "-s", dummySvcDir, "--no-cache"}
 	runRoot()
 	os.Args = osArgsBackup
 }
@@ -0,0 +1,253 @@
+// Package netdep analyses the network dependencies between the services of a Go project
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package netdep
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
+)
+
+// AnnotationSite is an unresolved call or endpoint, together with the annotation skeleton that is inserted above it
+type AnnotationSite struct {
+	Service    string
+	File       string // File is the absolute path of the source file
+	Line       int    // Line is the line of the call, above which the annotation is inserted
+	Position   string // Position is the file:line of the call, as reported by the analysis
+	Code       string // Code is the source line of the call, without its indentation
+	Annotation string // Annotation is the comment that is inserted, such as "//netdep:client url=http://users:8080/ targetSvc=users"
+}
+
+// AnnotationSites returns an annotation skeleton for each unresolved call and endpoint, ordered by file and line.
+// The skeleton holds the part of the URL that was resolved and, for a call, the service that it most likely targets.
+// Calls that already have an annotation, and calls that cannot be found in the source, are reported instead.
+func AnnotationSites(result *Result) ([]AnnotationSite, []Diagnostic) {
+	collector := diagnostics.NewCollector()
+	sites := make([]AnnotationSite, 0)
+
+	serviceDirs := make(map[string]string)
+	for _, service := range result.Services {
+		serviceDirs[service.Name] = service.Dir
+	}
+	var hosts map[string]string
+	if result.Dependencies != nil {
+		hosts = result.Dependencies.Hosts
+	}
+
+	endpoints := make(map[*callanalyzer.CallTarget]bool)
+	if result.Dependencies != nil {
+		for _, endpoint := range result.Dependencies.Endpoints {
+			endpoints[endpoint] = true
+		}
+	}
+
+	files := make(map[string]*sourceFile)
+	seen := make(map[string]bool)
+	for _, target := range result.Unresolved {
+		if len(target.Trace) == 0 {
+			continue
+		}
+
+		fileName := target.Trace[0].FileName
+		position := fmt.Sprintf("%s:%s", fileName, target.Trace[0].PositionInFile)
+		line, err := strconv.Atoi(target.Trace[0].PositionInFile)
+		if err != nil || seen[target.ServiceName+"@"+position] {
+			continue
+		}
+		seen[target.ServiceName+"@"+position] = true
+
+		if _, ok := result.Annotations[target.ServiceName][callanalyzer.Position{Filename: fileName, Line: line - 1}]; ok {
+			collector.Warningf(diagnostics.StageAnnotations, target.ServiceName, position,
+				"the call already has an annotation, which could not be used")
+			continue
+		}
+
+		file := findSourceFile(serviceDirs[target.ServiceName], fileName, line, files)
+		if file == nil {
+			collector.Warningf(diagnostics.StageAnnotations, target.ServiceName, position, "the call was not found in the source")
+			continue
+		}
+
+		annotation := callanalyzer.Annotation{Type: "client", Params: make(map[string]string)}
+		if endpoints[target] {
+			annotation.Type = "endpoint"
+		}
+
+		partial := partialLocation(target.PartialLocation)
+		if partial != "" {
+			annotation.Params["url"] = partial
+		}
+		if annotation.Type == "client" {
+			if candidate := candidateService(target, partial, serviceDirs, hosts); candidate != "" {
+				annotation.Params["targetSvc"] = candidate
+			}
+		}
+		if len(annotation.Params) == 0 {
+			// the skeleton still has to be completed, so it is invalid until then and reported by LintAnnotations
+			annotation.Params["url"] = ""
+		}
+
+		sites = append(sites, AnnotationSite{
+			Service:    target.ServiceName,
+			File:       file.path,
+			Line:       line,
+			Position:   position,
+			Code:       strings.TrimSpace(file.line(line)),
+			Annotation: "//netdep:" + annotation.String(),
+		})
+	}
+
+	sort.SliceStable(sites, func(i, j int) bool {
+		if sites[i].File != sites[j].File {
+			return sites[i].File < sites[j].File
+		}
+		return sites[i].Line < sites[j].Line
+	})
+
+	return sites, collector.Diagnostics()
+}
+
+// InsertAnnotations inserts the annotations of the sites into the source of a file, each on its own line
+// above the line of its call and with the same indentation. The rest of the source is left as it is.
+func InsertAnnotations(source []byte, sites []AnnotationSite) []byte {
+	annotations := make(map[int][]string)
+	for _, site := range sites {
+		annotations[site.Line] = append(annotations[site.Line], site.Annotation)
+	}
+
+	newline := "\n"
+	if bytes.Contains(source, []byte("\r\n")) {
+		newline = "\r\n"
+	}
+
+	var buffer bytes.Buffer
+	lines := bytes.SplitAfter(source, []byte("\n"))
+	for i, line := range lines {
+		indentation := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+		for _, annotation := range annotations[i+1] {
+			buffer.Write(indentation)
+			buffer.WriteString(annotation + newline)
+		}
+		buffer.Write(line)
+	}
+
+	return buffer.Bytes()
+}
+
+// sourceFile is a source file of which the lines that hold the start of a call are known
+type sourceFile struct {
+	path      string
+	source    []byte
+	callLines map[int]bool
+}
+
+// line returns the text of a line of the file, counting from 1
+func (file *sourceFile) line(number int) string {
+	lines := strings.Split(string(file.source), "\n")
+	if number < 1 || number > len(lines) {
+		return ""
+	}
+
+	return lines[number-1]
+}
+
+// findSourceFile finds the source file of a call, of which the analysis reports the path from the parent of the
+// directory of the service, if a call is made in it at the line
+func findSourceFile(serviceDir, fileName string, line int, files map[string]*sourceFile) *sourceFile {
+	path := fileName
+	if !filepath.IsAbs(fileName) {
+		if serviceDir == "" {
+			return nil
+		}
+		path = filepath.Join(filepath.Dir(serviceDir), fileName)
+	}
+
+	file, ok := files[path]
+	if !ok {
+		file = parseSourceFile(path)
+		files[path] = file
+	}
+
+	if file != nil && file.callLines[line] {
+		return file
+	}
+
+	return nil
+}
+
+// parseSourceFile parses a source file to find the lines of its calls, or returns nil if it cannot be parsed
+func parseSourceFile(path string) *sourceFile {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, path, source, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+
+	file := &sourceFile{path: path, source: source, callLines: make(map[int]bool)}
+	ast.Inspect(parsed, func(node ast.Node) bool {
+		// the analysis reports the position of the opening parenthesis of a call
+		if call, ok := node.(*ast.CallExpr); ok {
+			file.callLines[fset.Position(call.Lparen).Line] = true
+		}
+		return true
+	})
+
+	return file
+}
+
+// partialLocation returns the part of a request location that was resolved, which is the part before the first
+// value that was not resolved
+func partialLocation(location string) string {
+	if index := strings.Index(location, "unknown:"); index >= 0 {
+		location = location[:index]
+	}
+
+	return strings.TrimSpace(location)
+}
+
+// candidateService returns the service that a call most likely targets: the service of the host of the partial URL,
+// or else the service of which the name occurs in the request location, such as users for USERS_URL
+func candidateService(target *callanalyzer.CallTarget, partial string, services, hosts map[string]string) string {
+	if parsedURL, err := url.Parse(partial); err == nil && parsedURL.Host != "" {
+		for _, host := range []string{parsedURL.Host, parsedURL.Hostname()} {
+			if service, ok := hosts[host]; ok {
+				return service
+			}
+			if _, ok := services[host]; ok {
+				return host
+			}
+		}
+	}
+
+	normalize := strings.NewReplacer("_", "-", ".", "-").Replace
+	location := normalize(strings.ToLower(target.PartialLocation))
+
+	candidate := ""
+	for service := range services {
+		if service == target.ServiceName || !strings.Contains(location, normalize(strings.ToLower(service))) {
+			continue
+		}
+		// prefer the longest name, so that users-api is not mistaken for users
+		if len(service) > len(candidate) || len(service) == len(candidate) && service < candidate {
+			candidate = service
+		}
+	}
+
+	return candidate
+}
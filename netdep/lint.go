@@ -0,0 +1,143 @@
+// Package netdep analyses the network dependencies between the services of a Go project
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package netdep
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
+	"lab.weave.nl/internships/tud-2022/netDep/structures"
+)
+
+// annotatedTarget is a call or endpoint that an annotation on the line above it applies to
+type annotatedTarget struct {
+	target     *callanalyzer.CallTarget
+	isEndpoint bool
+}
+
+// LintAnnotations checks the annotations that were found during the analysis. It reports annotations that
+// cannot be parsed, annotations that are not above any call or endpoint, annotations of which the target
+// service does not exist and annotations that are redundant because the call was already resolved.
+func LintAnnotations(result *Result) []Diagnostic {
+	collector := diagnostics.NewCollector()
+
+	targets := annotatedTargets(result)
+	services := make(map[string]bool)
+	for _, service := range result.Services {
+		services[service.Name] = true
+	}
+
+	for _, serviceName := range sortedKeys(result.Annotations) {
+		serviceAnnotations := result.Annotations[serviceName]
+
+		positions := make([]callanalyzer.Position, 0, len(serviceAnnotations))
+		for pos := range serviceAnnotations {
+			positions = append(positions, pos)
+		}
+		sort.Slice(positions, func(i, j int) bool {
+			if positions[i].Filename != positions[j].Filename {
+				return positions[i].Filename < positions[j].Filename
+			}
+			return positions[i].Line < positions[j].Line
+		})
+
+		for _, pos := range positions {
+			lintAnnotation(serviceAnnotations[pos], serviceName, pos, targets, services, collector)
+		}
+	}
+
+	return collector.Diagnostics()
+}
+
+// lintAnnotation checks a single annotation
+func lintAnnotation(ann, serviceName string, pos callanalyzer.Position, targets map[string]map[callanalyzer.Position]annotatedTarget,
+	services map[string]bool, collector *diagnostics.Collector,
+) {
+	position := fmt.Sprintf("%s:%d", pos.Filename, pos.Line)
+
+	annotation, err := callanalyzer.ParseAnnotation(ann)
+	if err != nil {
+		collector.Errorf(diagnostics.StageAnnotations, serviceName, position, "invalid annotation %q: %s", ann, err)
+		return
+	}
+
+	for _, key := range []string{"targetSvc", "target"} {
+		if target, ok := annotation.Params[key]; ok && !services[target] {
+			collector.Warningf(diagnostics.StageAnnotations, serviceName, position, "the %s annotation targets service %s, which does not exist", annotation.Type, target)
+		}
+	}
+
+	// the annotations of these types apply to the call or endpoint on the next line
+	if annotation.Type != "client" && annotation.Type != "endpoint" && annotation.Type != "public" {
+		return
+	}
+
+	target, ok := targets[serviceName][callanalyzer.Position{Filename: pos.Filename, Line: pos.Line + 1}]
+	switch {
+	case !ok:
+		collector.Warningf(diagnostics.StageAnnotations, serviceName, position, "the %s annotation is not above a call or endpoint", annotation.Type)
+	case annotation.Type == "public" && !target.isEndpoint:
+		collector.Warningf(diagnostics.StageAnnotations, serviceName, position, "the public annotation is not above an endpoint")
+	case annotation.Type == "public" || target.target.IsAnnotated || !target.target.IsResolved:
+		return
+	case annotation.Type == "endpoint" && annotation.Params["public"] != "":
+		// the annotation still marks the endpoint as public
+		return
+	default:
+		collector.Warningf(diagnostics.StageAnnotations, serviceName, position, "the %s annotation is redundant, the target was resolved to %s",
+			annotation.Type, target.target.RequestLocation)
+	}
+}
+
+// annotatedTargets returns the discovered calls and endpoints by service and by position of their call,
+// which are the targets that an annotation can apply to
+func annotatedTargets(result *Result) map[string]map[callanalyzer.Position]annotatedTarget {
+	targets := make(map[string]map[callanalyzer.Position]annotatedTarget)
+	if result.Dependencies == nil {
+		return targets
+	}
+
+	add := func(target *callanalyzer.CallTarget, isEndpoint bool) {
+		if target.IsDeclared || len(target.Trace) == 0 {
+			return
+		}
+
+		line, err := strconv.Atoi(target.Trace[0].PositionInFile)
+		if err != nil {
+			return
+		}
+
+		if targets[target.ServiceName] == nil {
+			targets[target.ServiceName] = make(map[callanalyzer.Position]annotatedTarget)
+		}
+		targets[target.ServiceName][callanalyzer.Position{Filename: target.Trace[0].FileName, Line: line}] = annotatedTarget{target, isEndpoint}
+	}
+
+	for _, dependencies := range []*structures.Dependencies{result.Dependencies, result.Suppressed} {
+		if dependencies == nil {
+			continue
+		}
+		for _, call := range dependencies.Calls {
+			add(call, false)
+		}
+		for _, endpoint := range dependencies.Endpoints {
+			add(endpoint, true)
+		}
+	}
+
+	return targets
+}
+
+// sortedKeys returns the service names of the annotations in alphabetical order
+func sortedKeys(annotations map[string]map[callanalyzer.Position]string) []string {
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
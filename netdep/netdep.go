@@ -0,0 +1,162 @@
+// Package netdep analyses the network dependencies between the services of a Go project.
+// It is the library behind the netDep command, and does not print anything unless Options.Verbose is set.
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package netdep
+
+import (
+	"context"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/preprocessing"
+	"lab.weave.nl/internships/tud-2022/netDep/structures"
+)
+
+// Options configure an analysis
+type Options struct {
+	ProjectDir      string // ProjectDir is the (absolute) root directory of the project
+	ServiceDir      string // ServiceDir is the (absolute) directory of which each subdirectory is a service, see DiscoverDirectories
+	EnvFile         string // EnvFile is the YAML file holding the environment variables of the services, or a Docker Compose file, if any
+	ServiceCallsDir string // ServiceCallsDir is the directory of the servicecalls package, if any
+	Verbose         bool   // Verbose makes the analyser print the traces of calls that could not be resolved
+	Shallow         bool   // Shallow only discovers the servicecalls and NATS calls, which does not require building the services
+	Jobs            int    // Jobs is the maximum number of services that are analysed concurrently, at least 1
+	SingleProgram   bool   // SingleProgram loads and builds all services as one SSA program
+	NoCache         bool   // NoCache disables loading and storing discovery results in the cache
+	CacheDir        string // CacheDir overrides the default cache directory, see cache.DefaultDir
+	Rules           Rules
+
+	// Discovery selects how the services of the project are found, by default DiscoverDirectories
+	Discovery string
+	// WorkFile is the go.work file of DiscoverWorkspace, by default the one in ProjectDir
+	WorkFile string
+	// Services are the name-to-path patterns of DiscoverConfig
+	Services []ServicePattern
+	// ServiceFinder overrides Discovery with a custom way of finding the services
+	ServiceFinder ServiceFinder
+	// NameSources are the sources from which the names of services are derived, in order of preference,
+	// such as NameFromGoMod. A service is named after its directory if none of the sources names it.
+	NameSources []string
+	// IgnoredServices are the names of the services that are not analysed, which may contain wildcards
+	// as supported by path.Match
+	IgnoredServices []string
+	// Hosts maps hosts, optionally with their port, to the services they belong to,
+	// for calls that do not use the name of the service they target
+	Hosts map[string]string
+	// Manifests are Kubernetes manifests, or directories holding them, such as the output of helm template.
+	// The environment variables of their workloads are added to those of EnvFile, which take precedence,
+	// and the DNS names of their Services are added to the Hosts.
+	Manifests []string
+	// DotenvFiles maps the names of services to their dotenv files, which are read after the .env file in the
+	// directory of each service. Their variables take precedence over those of Manifests, but not over those of EnvFile.
+	DotenvFiles map[string][]string
+	// Profile selects the .env.<profile> file in the directory of each service, which is read after its .env file
+	Profile string
+	// Flags maps the names of services to the values of their command-line flags, which are used instead of the
+	// defaults of the flags that they define, such as flag.String("users-url", "http://users:8080", "")
+	Flags map[string]map[string]string
+	// Dependencies are dependencies that cannot be discovered in the code, which are added to those that are
+	Dependencies []Dependency
+}
+
+// Dependency declares that a service depends on another service or URL, such as through a generated client
+type Dependency struct {
+	Source   string // Source is the name of the service that makes the calls
+	Target   string // Target is the name of the service that is called, if URL does not identify it
+	Protocol string // Protocol is the protocol of the calls, HTTP if it is empty
+	URL      string // URL is the URL or endpoint that is called, if any
+}
+
+// The ways in which the services of a project can be discovered
+const (
+	DiscoverDirectories  = preprocessing.DiscoverDirectories  // DiscoverDirectories treats each subdirectory of ServiceDir as a service
+	DiscoverMainPackages = preprocessing.DiscoverMainPackages // DiscoverMainPackages treats each main package in ProjectDir as a service
+	DiscoverWorkspace    = preprocessing.DiscoverWorkspace    // DiscoverWorkspace treats each module of WorkFile with a main package as a service
+	DiscoverConfig       = preprocessing.DiscoverConfig       // DiscoverConfig takes the services from the Services patterns
+)
+
+// The sources from which the name of a service can be derived
+const (
+	NameFromDirectory  = preprocessing.NameFromDirectory  // NameFromDirectory names a service after its directory
+	NameFromGoMod      = preprocessing.NameFromGoMod      // NameFromGoMod names a service after its module path
+	NameFromDockerfile = preprocessing.NameFromDockerfile // NameFromDockerfile names a service after the title or service label of its Dockerfile
+	NameFromKubernetes = preprocessing.NameFromKubernetes // NameFromKubernetes names a service after the app label of its Kubernetes manifests
+)
+
+// ServicePattern maps the name of a service to the directory holding it, which may be a glob relative to ProjectDir
+type ServicePattern = preprocessing.ServicePattern
+
+// ServiceFinder finds the services of a project, see preprocessing.ServiceFinder
+type ServiceFinder = preprocessing.ServiceFinder
+
+// Rules extend the calls that the analyser looks for
+type Rules struct {
+	// ClientCalls maps the qualified name of a function that makes a request, such as "(*net/http.Client).Get",
+	// to the indices of the arguments that hold its target
+	ClientCalls map[string][]int
+	// ServerCalls maps the qualified name of a function that registers an endpoint, such as "net/http.HandleFunc",
+	// to the indices of the arguments that hold the endpoint
+	ServerCalls map[string][]int
+	// IgnoredPackages are the packages of which the functions are not traversed, such as "encoding/json"
+	IgnoredPackages []string
+	// MaxTraversalDepth limits the depth of the traversed call chains, the default is used when it is 0
+	MaxTraversalDepth int
+	// Exclusions leave the calls and endpoints that match them out of the dependency graph
+	Exclusions []Exclusion
+}
+
+// Exclusion leaves the calls and endpoints that match all of its patterns out of the dependency graph
+type Exclusion = callanalyzer.Exclusion
+
+// Severity indicates how severe a Diagnostic is
+type Severity = diagnostics.Severity
+
+const (
+	SeverityWarning = diagnostics.Warning // SeverityWarning means the result may be incomplete
+	SeverityError   = diagnostics.Error   // SeverityError means part of the project could not be analysed
+)
+
+// Diagnostic is a problem that was encountered during the analysis, but did not stop it
+type Diagnostic = diagnostics.Diagnostic
+
+// Service summarises the result of a single service
+type Service struct {
+	Name        string
+	Dir         string
+	ClientCalls int  // ClientCalls is the number of requests that the service makes
+	ServerCalls int  // ServerCalls is the number of endpoints that the service registers
+	IsCached    bool // IsCached is set if the result was loaded from the cache
+}
+
+// Result is the outcome of an analysis
+type Result struct {
+	// Services are the services that were found, in the order of their directories
+	Services []Service
+	// Dependencies are the discovered calls, endpoints and NATS messages of all services
+	Dependencies *structures.Dependencies
+	// Graph is the dependency graph that was built by matching the calls to the endpoints
+	Graph output.NodeGraph
+	// Metrics are the coupling metrics of each known service, which are also set on the nodes of the graph
+	Metrics []output.ServiceMetrics
+	// Unresolved are the calls and endpoints of which the target could not be resolved, which could be annotated
+	Unresolved []*callanalyzer.CallTarget
+	// Suppressed are the calls and endpoints that were left out of the graph by an exclusion or an ignore annotation
+	Suppressed *structures.Dependencies
+	// Annotations are the annotations that were found, per service
+	Annotations map[string]map[callanalyzer.Position]string
+	// Diagnostics are the problems that were encountered, such as files that could not be parsed
+	// and packages that could not be type-checked
+	Diagnostics []Diagnostic
+}
+
+// Analyze finds the services of the project and analyses all of them.
+// Cancelling the context stops the analysis before the next service is analysed.
+func Analyze(ctx context.Context, options Options) (*Result, error) {
+	project, err := NewProject(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return project.Analyze(ctx)
+}
@@ -0,0 +1,776 @@
+// Package netdep
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+
+package netdep
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"lab.weave.nl/internships/tud-2022/netDep/helpers"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
+)
+
+// exampleOptions returns the options for analysing the example project, without using the cache
+func exampleOptions() Options {
+	return Options{
+		ProjectDir: filepath.Join(helpers.RootDir, "test", "example"),
+		ServiceDir: filepath.Join(helpers.RootDir, "test", "example", "svc"),
+		Jobs:       2,
+		NoCache:    true,
+	}
+}
+
+func TestAnalyzeConcurrentlyIsDeterministic(t *testing.T) {
+	options := exampleOptions()
+	options.Jobs = 1
+
+	sequential, err := Analyze(context.Background(), options)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 4, len(sequential.Services))
+	assert.Equal(t, "node-basic-http", sequential.Services[0].Name)
+	assert.NotEmpty(t, sequential.Graph.Edges)
+	assert.Empty(t, sequential.Diagnostics)
+
+	options.Jobs = 4
+	concurrent, err := Analyze(context.Background(), options)
+	assert.Nil(t, err)
+
+	assert.Equal(t, sequential.Dependencies.Calls, concurrent.Dependencies.Calls)
+	assert.Equal(t, sequential.Dependencies.Endpoints, concurrent.Dependencies.Endpoints)
+}
+
+func TestAnalyzeSingleProgram(t *testing.T) {
+	options := exampleOptions()
+
+	perService, err := Analyze(context.Background(), options)
+	assert.Nil(t, err)
+
+	options.SingleProgram = true
+	singleProgram, err := Analyze(context.Background(), options)
+	assert.Nil(t, err)
+
+	assert.Equal(t, perService.Dependencies.Calls, singleProgram.Dependencies.Calls)
+	assert.Equal(t, perService.Dependencies.Endpoints, singleProgram.Dependencies.Endpoints)
+}
+
+func TestAnalyzeFromCache(t *testing.T) {
+	options := exampleOptions()
+	options.NoCache = false
+	options.CacheDir = t.TempDir()
+
+	// the first run fills the cache, the second run loads all services from it
+	uncached, err := Analyze(context.Background(), options)
+	assert.Nil(t, err)
+
+	cached, err := Analyze(context.Background(), options)
+	assert.Nil(t, err)
+
+	for _, service := range cached.Services {
+		assert.True(t, service.IsCached)
+	}
+	assert.Equal(t, uncached.Dependencies.Calls, cached.Dependencies.Calls)
+	assert.Equal(t, uncached.Dependencies.Endpoints, cached.Dependencies.Endpoints)
+	assert.Equal(t, uncached.Dependencies.Producers, cached.Dependencies.Producers)
+	assert.Equal(t, uncached.Dependencies.Consumers, cached.Dependencies.Consumers)
+}
+
+func TestAnalyzeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Analyze(ctx, exampleOptions())
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestAnalyzeInvalidServiceDir(t *testing.T) {
+	options := exampleOptions()
+	options.ServiceDir = filepath.Join(helpers.RootDir, "test", "example", "invalid")
+
+	_, err := Analyze(context.Background(), options)
+	assert.NotNil(t, err)
+}
+
+func TestAnalyzeRecordsDiagnostics(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod":              "module example.com/broken\n\ngo 1.17\n",
+		"svc/healthy/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n\t_, _ = http.Get(\"http://broken:8080/\")\n}\n",
+		"svc/broken/main.go":  "package main\n\nfunc main( {\n}\n",
+	})
+
+	options := Options{
+		ProjectDir: projectDir,
+		ServiceDir: filepath.Join(projectDir, "svc"),
+		Jobs:       2,
+		NoCache:    true,
+	}
+
+	// the broken service does not stop the analysis of the healthy one
+	result, err := Analyze(context.Background(), options)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result.Services))
+	assert.NotEmpty(t, result.Graph.Edges)
+
+	assert.NotEmpty(t, result.Diagnostics)
+	for _, diagnostic := range result.Diagnostics {
+		assert.Equal(t, SeverityError, diagnostic.Severity)
+		assert.Equal(t, "broken", diagnostic.Service)
+	}
+}
+
+// writeProject creates the files, of which the paths are relative to the project directory, with their content
+func writeProject(t *testing.T, projectDir string, files map[string]string) {
+	t.Helper()
+
+	for path, content := range files {
+		assert.Nil(t, os.MkdirAll(filepath.Join(projectDir, filepath.Dir(path)), 0o755))
+		assert.Nil(t, os.WriteFile(filepath.Join(projectDir, path), []byte(content), 0o600))
+	}
+}
+
+func TestAnalyzeMainPackages(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\t_, _ = http.Get(\"http://users-api:8080/users\")\n}\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/users\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+		"cmd/users/Dockerfile":    "FROM scratch\nLABEL service=users-api\n",
+		"internal/store/store.go": "package store\n",
+	})
+
+	result, err := Analyze(context.Background(), Options{
+		ProjectDir:  projectDir,
+		Discovery:   DiscoverMainPackages,
+		NameSources: []string{NameFromDockerfile},
+		Jobs:        2,
+		NoCache:     true,
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []Service{
+		{Name: "orders", Dir: filepath.Join(projectDir, "cmd", "orders"), ClientCalls: 1},
+		{Name: "users-api", Dir: filepath.Join(projectDir, "cmd", "users"), ServerCalls: 2},
+	}, result.Services)
+
+	// the calls are attributed to the services by their derived names, so the call can be matched to the endpoint
+	assert.Equal(t, 1, len(result.Graph.Edges))
+	assert.Equal(t, "orders", result.Graph.Edges[0].Source.ServiceName)
+	assert.Equal(t, "users-api", result.Graph.Edges[0].Target.ServiceName)
+
+	// the files are named from the directory of the service, whatever the source of its name
+	for _, endpoint := range result.Dependencies.Endpoints {
+		assert.Equal(t, filepath.Join("users", "main.go"), endpoint.Trace[0].FileName)
+	}
+}
+
+func TestAnalyzeIgnoredServicesAndHosts(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\t_, _ = http.Get(\"http://localhost:9000/users\")\n}\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/users\", nil)\n\t_ = http.ListenAndServe(\":9000\", nil)\n}\n",
+		"cmd/tools-seed/main.go": "package main\n\nfunc main() {}\n",
+	})
+
+	result, err := Analyze(context.Background(), Options{
+		ProjectDir:      projectDir,
+		Discovery:       DiscoverMainPackages,
+		IgnoredServices: []string{"tools-*"},
+		Hosts:           map[string]string{"localhost:9000": "users"},
+		Jobs:            2,
+		NoCache:         true,
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, len(result.Services))
+	assert.Equal(t, "orders", result.Services[0].Name)
+	assert.Equal(t, "users", result.Services[1].Name)
+
+	// the call to localhost is matched to the users service through the host mapping
+	assert.Equal(t, 1, len(result.Graph.Edges))
+	assert.Equal(t, "orders", result.Graph.Edges[0].Source.ServiceName)
+	assert.Equal(t, "users", result.Graph.Edges[0].Target.ServiceName)
+}
+
+func TestAnalyzeComposeFile(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nimport (\n\t\"net/http\"\n\t\"os\"\n)\n\nfunc main() {\n" +
+			"\t_, _ = http.Get(os.Getenv(\"USERS_URL\") + \"/users\")\n}\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/users\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+		"docker-compose.yml": "services:\n" +
+			"  order-service:\n    build: ./cmd/orders\n    environment:\n      USERS_URL: http://user-api:8080\n" +
+			"  user-api:\n    build: ./cmd/users\n",
+	})
+
+	result, err := Analyze(context.Background(), Options{
+		ProjectDir: projectDir,
+		Discovery:  DiscoverMainPackages,
+		EnvFile:    filepath.Join(projectDir, "docker-compose.yml"),
+		Jobs:       2,
+		NoCache:    true,
+	})
+	assert.Nil(t, err)
+
+	// the environment of order-service belongs to orders, and the user-api host to users
+	assert.Equal(t, 1, len(result.Graph.Edges))
+	assert.Equal(t, "orders", result.Graph.Edges[0].Source.ServiceName)
+	assert.Equal(t, "users", result.Graph.Edges[0].Target.ServiceName)
+	assert.Equal(t, "users", result.Dependencies.Hosts["user-api"])
+}
+
+func TestAnalyzeKubernetesManifests(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nimport (\n\t\"net/http\"\n\t\"os\"\n)\n\nfunc main() {\n" +
+			"\t_, _ = http.Get(os.Getenv(\"USERS_URL\") + \"/users\")\n}\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/users\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+		"deploy/orders.yaml": "kind: Deployment\nmetadata:\n  name: orders\nspec:\n  template:\n    spec:\n      containers:\n" +
+			"        - name: orders\n          env:\n            - name: USERS_URL\n" +
+			"              value: http://user-api.default.svc.cluster.local:8080\n",
+		"deploy/users.yaml": "kind: Service\nmetadata:\n  name: user-api\nspec:\n  selector:\n    app: users\n" +
+			"---\nkind: Deployment\nmetadata:\n  name: users\nspec:\n  template:\n    metadata:\n      labels:\n        app: users\n",
+	})
+
+	result, err := Analyze(context.Background(), Options{
+		ProjectDir: projectDir,
+		Discovery:  DiscoverMainPackages,
+		Manifests:  []string{filepath.Join(projectDir, "deploy")},
+		Jobs:       2,
+		NoCache:    true,
+	})
+	assert.Nil(t, err)
+
+	// the call to the DNS name of the Kubernetes Service is matched to the service it selects
+	assert.Equal(t, 1, len(result.Graph.Edges))
+	assert.Equal(t, "orders", result.Graph.Edges[0].Source.ServiceName)
+	assert.Equal(t, "users", result.Graph.Edges[0].Target.ServiceName)
+}
+
+func TestAnalyzeDotenvProfile(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nimport (\n\t\"net/http\"\n\t\"os\"\n)\n\nfunc main() {\n" +
+			"\t_, _ = http.Get(os.Getenv(\"USERS_URL\") + \"/users\")\n}\n",
+		"cmd/orders/.env":         "USERS_URL=http://localhost:8081\n",
+		"cmd/orders/.env.staging": "USERS_URL=http://users:8080\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/users\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+	})
+
+	options := Options{ProjectDir: projectDir, Discovery: DiscoverMainPackages, Jobs: 2, NoCache: true}
+
+	// without a profile, the call goes to localhost, which is not known to be the users service
+	result, err := Analyze(context.Background(), options)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result.Graph.Edges))
+	assert.Equal(t, "UnknownService", result.Graph.Edges[0].Target.ServiceName)
+
+	options.Profile = "staging"
+	result, err = Analyze(context.Background(), options)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result.Graph.Edges))
+	assert.Equal(t, "users", result.Graph.Edges[0].Target.ServiceName)
+}
+
+func TestAnalyzeEnvironmentDefaults(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n\n" +
+			"require (\n\tgithub.com/kelseyhightower/envconfig v1.4.0\n\tgithub.com/spf13/viper v1.12.0\n)\n\n" +
+			"replace github.com/kelseyhightower/envconfig => ./stubs/envconfig\n\n" +
+			"replace github.com/spf13/viper => ./stubs/viper\n",
+		"stubs/envconfig/go.mod": "module github.com/kelseyhightower/envconfig\n\ngo 1.17\n",
+		"stubs/envconfig/envconfig.go": "package envconfig\n\n" +
+			"func Process(prefix string, spec interface{}) error { return nil }\n",
+		"stubs/viper/go.mod": "module github.com/spf13/viper\n\ngo 1.17\n",
+		"stubs/viper/viper.go": "package viper\n\n" +
+			"func SetDefault(key string, value interface{}) {}\n\nfunc GetString(key string) string { return \"\" }\n",
+		// a helper that falls back to a default when os.LookupEnv does not find the variable
+		"cmd/orders/main.go": "package main\n\nimport (\n\t\"net/http\"\n\t\"os\"\n)\n\n" +
+			"func getEnv(key, fallback string) string {\n\tif value, ok := os.LookupEnv(key); ok {\n\t\treturn value\n\t}\n\treturn fallback\n}\n\n" +
+			"func main() {\n\t_, _ = http.Get(getEnv(\"USERS_URL\", \"http://users:8080\") + \"/users\")\n}\n",
+		"cmd/orders/.env.local": "USERS_URL=http://localhost:8081\n",
+		// an empty os.Getenv value that is replaced by a default
+		"cmd/billing/main.go": "package main\n\nimport (\n\t\"net/http\"\n\t\"os\"\n)\n\n" +
+			"func main() {\n\turl := os.Getenv(\"USERS_URL\")\n\tif url == \"\" {\n\t\turl = \"http://users:8080\"\n\t}\n" +
+			"\t_, _ = http.Get(url + \"/users\")\n}\n",
+		"cmd/reports/main.go": "package main\n\nimport (\n\t\"net/http\"\n\n\t\"github.com/kelseyhightower/envconfig\"\n)\n\n" +
+			"type config struct {\n\tUsersURL string `envconfig:\"USERS_URL\" default:\"http://users:8080\"`\n}\n\n" +
+			"func main() {\n\tvar cfg config\n\t_ = envconfig.Process(\"reports\", &cfg)\n\t_, _ = http.Get(cfg.UsersURL + \"/users\")\n}\n",
+		"cmd/reports/.env.local": "REPORTS_USERS_URL=http://localhost:8081\n",
+		"cmd/audit/main.go": "package main\n\nimport (\n\t\"net/http\"\n\n\t\"github.com/spf13/viper\"\n)\n\n" +
+			"func init() {\n\tviper.SetDefault(\"users.url\", \"http://users:8080\")\n}\n\n" +
+			"func main() {\n\t_, _ = http.Get(viper.GetString(\"users.url\") + \"/users\")\n}\n",
+		"cmd/audit/.env.local": "USERS_URL=http://localhost:8081\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/users\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+	})
+
+	urls := func(options Options) map[string]string {
+		result, err := Analyze(context.Background(), options)
+		assert.Nil(t, err)
+
+		urls := make(map[string]string)
+		for _, edge := range result.Graph.Edges {
+			urls[edge.Source.ServiceName] = edge.Call.URL
+		}
+		return urls
+	}
+
+	// without environment variables, the coded defaults are used
+	options := Options{ProjectDir: projectDir, Discovery: DiscoverMainPackages, Jobs: 2, NoCache: true}
+	assert.Equal(t, map[string]string{
+		"orders":  "http://users:8080/users",
+		"billing": "http://users:8080/users",
+		"reports": "http://users:8080/users",
+		"audit":   "http://users:8080/users",
+	}, urls(options))
+
+	// variables that are set take precedence over the defaults
+	options.Profile = "local"
+	assert.Equal(t, map[string]string{
+		"orders":  "http://localhost:8081/users",
+		"billing": "http://users:8080/users",
+		"reports": "http://localhost:8081/users",
+		"audit":   "http://localhost:8081/users",
+	}, urls(options))
+}
+
+func TestAnalyzeEnvironmentDefaultsSingleProgram(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n\nrequire github.com/spf13/viper v1.12.0\n\n" +
+			"replace github.com/spf13/viper => ./stubs/viper\n",
+		"stubs/viper/go.mod": "module github.com/spf13/viper\n\ngo 1.17\n",
+		"stubs/viper/viper.go": "package viper\n\n" +
+			"func SetDefault(key string, value interface{}) {}\n\nfunc GetString(key string) string { return \"\" }\n",
+		"cmd/orders/main.go": "package main\n\nimport (\n\t\"net/http\"\n\n\t\"github.com/spf13/viper\"\n)\n\n" +
+			"func init() {\n\tviper.SetDefault(\"users.url\", \"http://users:8080\")\n}\n\n" +
+			"func main() {\n\t_, _ = http.Get(viper.GetString(\"users.url\") + \"/users\")\n}\n",
+		// the default of the same key is set in a package of the module that the service imports
+		"internal/billingconfig/config.go": "package billingconfig\n\nimport \"github.com/spf13/viper\"\n\n" +
+			"func Init() {\n\tviper.SetDefault(\"users.url\", \"http://accounts:9090\")\n}\n",
+		"cmd/billing/main.go": "package main\n\nimport (\n\t\"net/http\"\n\n\t\"example.com/shop/internal/billingconfig\"\n" +
+			"\t\"github.com/spf13/viper\"\n)\n\n" +
+			"func main() {\n\tbillingconfig.Init()\n\t_, _ = http.Get(viper.GetString(\"users.url\") + \"/users\")\n}\n",
+	})
+
+	result, err := Analyze(context.Background(), Options{
+		ProjectDir:    projectDir,
+		Discovery:     DiscoverMainPackages,
+		SingleProgram: true,
+		Jobs:          2,
+		NoCache:       true,
+	})
+	assert.Nil(t, err)
+
+	// the defaults of one service are not used for the other service, although they are built in the same program
+	urls := make(map[string]string)
+	for _, edge := range result.Graph.Edges {
+		urls[edge.Source.ServiceName] = edge.Call.URL
+	}
+	assert.Equal(t, map[string]string{
+		"orders":  "http://users:8080/users",
+		"billing": "http://accounts:9090/users",
+	}, urls)
+}
+
+func TestAnalyzeFlagDefaults(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nimport (\n\t\"flag\"\n\t\"net/http\"\n)\n\n" +
+			"func main() {\n\tusersURL := flag.String(\"users-url\", \"http://users:8080\", \"users service\")\n" +
+			"\tflag.Parse()\n\t_, _ = http.Get(*usersURL + \"/users\")\n}\n",
+		// a package variable bound to a flag of a flag set
+		"cmd/billing/main.go": "package main\n\nimport (\n\t\"flag\"\n\t\"net/http\"\n\t\"os\"\n)\n\n" +
+			"var usersURL string\n\nfunc init() {\n\tflags := flag.NewFlagSet(\"billing\", flag.ExitOnError)\n" +
+			"\tflags.StringVar(&usersURL, \"users-url\", \"http://users:8080\", \"users service\")\n" +
+			"\t_ = flags.Parse(os.Args[1:])\n}\n\nfunc main() {\n\t_, _ = http.Get(usersURL + \"/users\")\n}\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/users\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+	})
+
+	urls := func(options Options) map[string]string {
+		result, err := Analyze(context.Background(), options)
+		assert.Nil(t, err)
+
+		urls := make(map[string]string)
+		for _, edge := range result.Graph.Edges {
+			urls[edge.Source.ServiceName] = edge.Call.URL
+		}
+		return urls
+	}
+
+	// flags resolve to their defaults
+	options := Options{ProjectDir: projectDir, Discovery: DiscoverMainPackages, Jobs: 2, NoCache: true}
+	assert.Equal(t, map[string]string{
+		"orders":  "http://users:8080/users",
+		"billing": "http://users:8080/users",
+	}, urls(options))
+
+	// unless they are set for the service
+	options.Flags = map[string]map[string]string{"billing": {"users-url": "http://localhost:8081"}}
+	assert.Equal(t, map[string]string{
+		"orders":  "http://users:8080/users",
+		"billing": "http://localhost:8081/users",
+	}, urls(options))
+}
+
+func TestAnalyzeFlagDefaultsSingleProgram(t *testing.T) {
+	projectDir := t.TempDir()
+	main := func(defaultURL string) string {
+		return "package main\n\nimport (\n\t\"flag\"\n\t\"net/http\"\n\n\t\"example.com/shop/internal/config\"\n)\n\n" +
+			"func main() {\n\tflag.StringVar(&config.UsersURL, \"users-url\", \"" + defaultURL + "\", \"users service\")\n" +
+			"\tflag.Parse()\n\t_, _ = http.Get(config.UsersURL + \"/users\")\n}\n"
+	}
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		// a variable of a shared package that each service binds to a flag with its own default
+		"internal/config/config.go": "package config\n\nvar UsersURL string\n",
+		"cmd/orders/main.go":        main("http://users:8080"),
+		"cmd/billing/main.go":       main("http://accounts:9090"),
+	})
+
+	result, err := Analyze(context.Background(), Options{
+		ProjectDir:    projectDir,
+		Discovery:     DiscoverMainPackages,
+		SingleProgram: true,
+		Jobs:          2,
+		NoCache:       true,
+	})
+	assert.Nil(t, err)
+
+	urls := make(map[string]string)
+	for _, edge := range result.Graph.Edges {
+		urls[edge.Source.ServiceName] = edge.Call.URL
+	}
+	assert.Equal(t, map[string]string{
+		"orders":  "http://users:8080/users",
+		"billing": "http://accounts:9090/users",
+	}, urls)
+}
+func TestAnalyzeDeclaredDependencies(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "// Package main calls the users service through a generated client\n" +
+			"//netdep:depends target=users protocol=gRPC url=/v1/users\npackage main\n\nfunc main() {}\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/v1/users\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+	})
+
+	options := Options{
+		ProjectDir: projectDir, Discovery: DiscoverMainPackages, Jobs: 2, NoCache: true,
+		Dependencies: []Dependency{
+			{Source: "users", URL: "https://api.stripe.com/v1/charges"},
+			{Source: "billing", Target: "users"},
+		},
+	}
+
+	result, err := Analyze(context.Background(), options)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, len(result.Graph.Edges))
+	assert.Equal(t, "orders", result.Graph.Edges[0].Source.ServiceName)
+	assert.Equal(t, "users", result.Graph.Edges[0].Target.ServiceName)
+	assert.Equal(t, "gRPC", result.Graph.Edges[0].Call.Protocol)
+	assert.Equal(t, []string{"orders/main.go:2"}, result.Graph.Edges[0].Call.Locations)
+	assert.True(t, result.Graph.Edges[0].Call.Declared)
+
+	assert.Equal(t, "users", result.Graph.Edges[1].Source.ServiceName)
+	assert.Equal(t, "UnknownService", result.Graph.Edges[1].Target.ServiceName)
+	assert.True(t, result.Graph.Edges[1].Call.Declared)
+
+	// billing is not a service, so its dependency is left out
+	assert.Equal(t, 1, len(result.Diagnostics))
+	assert.Equal(t, "billing", result.Diagnostics[0].Service)
+}
+
+func TestAnalyzeAnnotatedMessaging(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nfunc main() {\n" +
+			"\t//netdep:publish subject=orders.created protocol=Kafka\n\tpublish(\"orders.created\")\n}\n\n" +
+			"func publish(topic string) {}\n",
+		"cmd/billing/main.go": "package main\n\n//netdep:subscribe subject=orders.created protocol=Kafka\nfunc main() {}\n",
+	})
+
+	result, err := Analyze(context.Background(), Options{ProjectDir: projectDir, Discovery: DiscoverMainPackages, Jobs: 2, NoCache: true})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(result.Graph.Edges))
+	assert.Equal(t, "orders", result.Graph.Edges[0].Source.ServiceName)
+	assert.Equal(t, "billing", result.Graph.Edges[0].Target.ServiceName)
+	assert.Equal(t, "Kafka", result.Graph.Edges[0].Call.Protocol)
+	assert.Equal(t, "orders.created", result.Graph.Edges[0].Call.URL)
+	assert.Equal(t, []string{"orders/main.go:4"}, result.Graph.Edges[0].Call.Locations)
+	assert.True(t, result.Graph.Edges[0].Call.Declared)
+	assert.Empty(t, LintAnnotations(result))
+}
+
+func TestAnalyzeClientWrappers(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nimport (\n\t\"context\"\n\t\"net/http\"\n)\n\n" +
+			"type Client struct {\n\tbase string\n}\n\n" +
+			"// call calls the users service\n//netdep:client-wrapper urlArg=1 targetSvc=users\n" +
+			"func (c *Client) call(ctx context.Context, path string) {\n" +
+			"\treq, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)\n" +
+			"\t_, _ = http.DefaultClient.Do(req)\n}\n\n" +
+			"//netdep:client-wrapper urlArg=0\nfunc get(url string) {\n\t_, _ = http.Get(url)\n}\n\n" +
+			"func main() {\n\tclient := &Client{}\n" +
+			"\tclient.call(context.Background(), \"/v1/users\")\n" +
+			"\tclient.call(context.Background(), \"/v1/roles\")\n" +
+			"\tget(\"http://payments:8080/v1/charges\")\n}\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/v1/users\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+		"cmd/payments/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/v1/charges\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+	})
+
+	result, err := Analyze(context.Background(), Options{ProjectDir: projectDir, Discovery: DiscoverMainPackages, Jobs: 2, NoCache: true})
+	assert.Nil(t, err)
+
+	// each caller of a wrapper is a call, instead of the single unresolved call within the wrapper
+	calls := make([]string, 0)
+	for _, call := range result.Dependencies.Calls {
+		calls = append(calls, fmt.Sprintf("%s %s %s %s", call.MethodName, call.RequestLocation, call.TargetSvc, strings.Join(call.TraceAsStringArray(), ",")))
+	}
+	assert.Equal(t, []string{
+		"(*example.com/shop/cmd/orders.Client).call /v1/users users orders/main.go:26",
+		"(*example.com/shop/cmd/orders.Client).call /v1/roles users orders/main.go:27",
+		"example.com/shop/cmd/orders.get http://payments:8080/v1/charges  orders/main.go:28",
+	}, calls)
+	assert.Empty(t, result.Unresolved)
+
+	targets := make([]string, 0)
+	for _, edge := range result.Graph.Edges {
+		targets = append(targets, edge.Target.ServiceName)
+	}
+	assert.Equal(t, []string{"users", "users", "payments"}, targets)
+}
+
+func TestAnalyzeSuppressedCalls(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\t_, _ = http.Get(\"http://users:8080/v1\")\n" +
+			"\t//netdep:ignore reason=\"a test double\"\n" +
+			"\t_, _ = http.Get(\"http://users:8080/fake\")\n" +
+			"\t_, _ = http.Get(\"http://users:8080/healthz\")\n" +
+			"\tping()\n\t(&userDB{}).Update()\n}\n\n" +
+			"// ping checks that the users service is up\n//netdep:ignore\nfunc ping() {\n" +
+			"\t_, _ = http.Get(\"http://users:8080/ping\")\n}\n\n" +
+			"type userDB struct{}\n\nfunc (db *userDB) Update() {\n" +
+			"\t_, _ = http.Get(\"http://users:8080/cache\")\n}\n",
+		"cmd/tools/main.go": "//netdep:ignore scope=file reason=\"a development tool\"\npackage main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\t_, _ = http.Get(\"http://users:8080/v1\")\n}\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/v1\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+	})
+
+	options := Options{
+		ProjectDir: projectDir, Discovery: DiscoverMainPackages, Jobs: 2, NoCache: true,
+		Rules: Rules{Exclusions: []Exclusion{
+			{URL: "/healthz"},
+			// the function is matched by its package-qualified name
+			{Function: "(*example.com/shop/cmd/orders.userDB).*", Reason: "a cache refresh"},
+		}},
+	}
+
+	result, err := Analyze(context.Background(), options)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(result.Graph.Edges))
+	assert.Equal(t, "orders", result.Graph.Edges[0].Source.ServiceName)
+	assert.Equal(t, "http://users:8080/v1", result.Graph.Edges[0].Call.URL)
+
+	reasons := make(map[string]string)
+	for _, call := range result.Suppressed.Calls {
+		reasons[call.ServiceName+" "+call.RequestLocation] = call.Suppressed
+	}
+	assert.Equal(t, map[string]string{
+		"orders http://users:8080/fake":    "a test double",
+		"orders http://users:8080/healthz": "excluded by url /healthz",
+		"orders http://users:8080/ping":    "ignored by the annotation at orders/main.go:15",
+		"orders http://users:8080/cache":   "a cache refresh",
+		"tools http://users:8080/v1":       "a development tool",
+	}, reasons)
+	assert.Equal(t, 0, len(result.Suppressed.Endpoints))
+}
+
+func TestAnalyzeAllServicesIgnored(t *testing.T) {
+	options := exampleOptions()
+	options.IgnoredServices = []string{"*"}
+
+	_, err := Analyze(context.Background(), options)
+	assert.EqualError(t, err, "no services to analyse were found")
+}
+
+func TestAnalyzeUnknownDiscovery(t *testing.T) {
+	options := exampleOptions()
+	options.Discovery = "services"
+
+	_, err := Analyze(context.Background(), options)
+	assert.EqualError(t, err, "unknown service discovery: services")
+}
+
+func TestProjectAnalyzeSingleService(t *testing.T) {
+	project, err := NewProject(exampleOptions())
+	assert.Nil(t, err)
+
+	all, err := project.Analyze(context.Background())
+	assert.Nil(t, err)
+
+	// analysing a single service again keeps the results of the other services
+	again, err := project.Analyze(context.Background(), project.Services()[0])
+	assert.Nil(t, err)
+	assert.Equal(t, all.Dependencies.Calls, again.Dependencies.Calls)
+
+	_, err = project.Analyze(context.Background(), "/does/not/exist")
+	assert.EqualError(t, err, "unknown service directory: /does/not/exist")
+}
+
+func TestApplyRules(t *testing.T) {
+	defaultConfig := callanalyzer.DefaultConfigForFindingHTTPCalls()
+	config := callanalyzer.DefaultConfigForFindingHTTPCalls()
+
+	applyRules(&config, Rules{})
+	assert.Equal(t, defaultConfig.Fingerprint(), config.Fingerprint())
+
+	applyRules(&config, Rules{
+		ClientCalls:       map[string][]int{"(*example.com/client.Client).Call": {1}},
+		ServerCalls:       map[string][]int{"(*example.com/router.Router).Route": {1}},
+		IgnoredPackages:   []string{"encoding/json"},
+		MaxTraversalDepth: 16,
+	})
+	assert.Contains(t, config.Fingerprint(), "(*example.com/client.Client).Call")
+	assert.Contains(t, config.Fingerprint(), "(*example.com/router.Router).Route")
+	assert.Contains(t, config.Fingerprint(), "encoding/json")
+	assert.Contains(t, config.Fingerprint(), "maxTraversalDepth:16")
+}
+
+func TestLintAnnotations(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nimport (\n\t\"net/http\"\n\t\"os\"\n)\n\nfunc main() {\n" +
+			"\t//netdep:client url=http://users:8080/v1 targetSvc=users\n" +
+			"\t_, _ = http.Get(\"http://users:8080/v1\")\n" +
+			"\t//netdep:client url=http://users:8080/v2 targetsvc=users\n" +
+			"\t_, _ = http.Get(os.Getenv(\"USERS_URL\"))\n" +
+			"\t//netdep:client targetSvc=payments\n" +
+			"\t_, _ = http.Get(os.Getenv(\"PAYMENTS_URL\"))\n" +
+			"\t//netdep:client url=/orphan\n\n}\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/v1\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+	})
+
+	result, err := Analyze(context.Background(), Options{ProjectDir: projectDir, Discovery: DiscoverMainPackages, Jobs: 2, NoCache: true})
+	assert.Nil(t, err)
+
+	problems := LintAnnotations(result)
+
+	assert.Equal(t, 4, len(problems))
+	assert.Equal(t, Diagnostic{
+		Severity: SeverityWarning, Stage: "annotations", Service: "orders", Position: "orders/main.go:9",
+		Message: "the client annotation is redundant, the target was resolved to http://users:8080/v1",
+	}, problems[0])
+	assert.Equal(t, Diagnostic{
+		Severity: SeverityError, Stage: "annotations", Service: "orders", Position: "orders/main.go:11",
+		Message: `invalid annotation "client url=http://users:8080/v2 targetsvc=users": unknown key targetsvc of the client annotation, did you mean targetSvc?`,
+	}, problems[1])
+	assert.Equal(t, Diagnostic{
+		Severity: SeverityWarning, Stage: "annotations", Service: "orders", Position: "orders/main.go:13",
+		Message: "the client annotation targets service payments, which does not exist",
+	}, problems[2])
+	assert.Equal(t, Diagnostic{
+		Severity: SeverityWarning, Stage: "annotations", Service: "orders", Position: "orders/main.go:15",
+		Message: "the client annotation is not above a call or endpoint",
+	}, problems[3])
+}
+
+func TestAnnotationSites(t *testing.T) {
+	projectDir := t.TempDir()
+	writeProject(t, projectDir, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.17\n",
+		"cmd/orders/main.go": "package main\n\nimport (\n\t\"net/http\"\n\t\"os\"\n)\n\nfunc main() {\n" +
+			"\t_, _ = http.Get(\"http://users:8080/v1/\" + os.Getenv(\"USER_PATH\"))\n" +
+			"\tif len(os.Args) > 1 {\n" +
+			"\t\t_, _ = http.Get(os.Getenv(\"USERS_URL\"))\n" +
+			"\t}\n" +
+			"\t//netdep:client targetsvc=users\n" +
+			"\t_, _ = http.Get(os.Getenv(\"BILLING_URL\"))\n" +
+			"\thttp.HandleFunc(os.Getenv(\"ROUTE\"), nil)\n}\n",
+		"cmd/users/main.go": "package main\n\nimport \"net/http\"\n\nfunc main() {\n" +
+			"\thttp.HandleFunc(\"/v1\", nil)\n\t_ = http.ListenAndServe(\":8080\", nil)\n}\n",
+	})
+
+	result, err := Analyze(context.Background(), Options{ProjectDir: projectDir, Discovery: DiscoverMainPackages, Jobs: 2, NoCache: true})
+	assert.Nil(t, err)
+
+	sites, problems := AnnotationSites(result)
+
+	mainFile := filepath.Join(projectDir, "cmd", "orders", "main.go")
+	assert.Equal(t, []AnnotationSite{
+		{
+			Service: "orders", File: mainFile, Line: 9, Position: "orders/main.go:9",
+			Code:       "_, _ = http.Get(\"http://users:8080/v1/\" + os.Getenv(\"USER_PATH\"))",
+			Annotation: "//netdep:client url=http://users:8080/v1/ targetSvc=users",
+		},
+		{
+			Service: "orders", File: mainFile, Line: 11, Position: "orders/main.go:11",
+			Code:       "_, _ = http.Get(os.Getenv(\"USERS_URL\"))",
+			Annotation: "//netdep:client targetSvc=users",
+		},
+		{
+			Service: "orders", File: mainFile, Line: 15, Position: "orders/main.go:15",
+			Code:       "http.HandleFunc(os.Getenv(\"ROUTE\"), nil)",
+			Annotation: `//netdep:endpoint url=""`,
+		},
+	}, sites)
+
+	// a skeleton of which nothing is known is invalid until it is completed
+	_, err = callanalyzer.ParseAnnotation(strings.TrimPrefix(sites[2].Annotation, "//netdep:"))
+	assert.EqualError(t, err, "the key url has no value")
+
+	// the annotation above the call to billing cannot be parsed, so it is reported instead
+	assert.Equal(t, 1, len(problems))
+	assert.Equal(t, "orders/main.go:14", problems[0].Position)
+
+	source, err := os.ReadFile(mainFile)
+	assert.Nil(t, err)
+
+	annotated := string(InsertAnnotations(source, sites[1:2]))
+	assert.Contains(t, annotated, "\tif len(os.Args) > 1 {\n\t\t//netdep:client targetSvc=users\n\t\t_, _ = http.Get(os.Getenv(\"USERS_URL\"))\n")
+	assert.Equal(t, len(source)+len("\t\t//netdep:client targetSvc=users\n"), len(annotated))
+}
+
+func TestInsertAnnotationsKeepsLineEndings(t *testing.T) {
+	source := []byte("func main() {\r\n    call()\r\n}\r\n")
+	sites := []AnnotationSite{{Line: 2, Annotation: "//netdep:client url=/users"}}
+
+	assert.Equal(t, "func main() {\r\n    //netdep:client url=/users\r\n    call()\r\n}\r\n", string(InsertAnnotations(source, sites)))
+}
@@ -0,0 +1,721 @@
+// Package netdep analyses the network dependencies between the services of a Go project
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package netdep
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/tools/go/ssa"
+
+	"lab.weave.nl/internships/tud-2022/netDep/cache"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/natsanalyzer"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/servicecallsanalyzer"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/matching"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/preprocessing"
+	"lab.weave.nl/internships/tud-2022/netDep/structures"
+)
+
+// serviceResult holds the calls that were discovered in a single service
+type serviceResult struct {
+	clientTargets         []*callanalyzer.CallTarget
+	serverTargets         []*callanalyzer.CallTarget
+	internalClientTargets []*callanalyzer.CallTarget
+	consumers             []*natsanalyzer.NatsCall
+	producers             []*natsanalyzer.NatsCall
+	packageCount          int
+	loadErr               error  // loadErr is the reason that the packages of the service could not be loaded, if any
+	cacheKey              string // cacheKey is empty when the cache is disabled
+	isCached              bool
+	collector             *diagnostics.Collector // collector records the diagnostics while the service is analysed
+	diagnostics           []Diagnostic
+	err                   error
+}
+
+// serviceAnalysis holds the state that is shared by the analyses of all services, which is only read once they start
+type serviceAnalysis struct {
+	options           *Options
+	analyserConfig    *callanalyzer.AnalyserConfig
+	internalCalls     map[servicecallsanalyzer.IntCall]string
+	packagesByService map[string][]*ssa.Package // packagesByService is only set when a single program is built
+}
+
+// Project holds the result of each of the services of a project,
+// so that services can be analysed again individually once their sources change
+type Project struct {
+	serviceAnalysis
+	services      []preprocessing.Service
+	environment   map[string]map[string]string // environment holds the environment variables of each service
+	hosts         map[string]string            // hosts map the hosts of the environment, manifests and options to services
+	results       []serviceResult
+	serverTargets []*callanalyzer.CallTarget // serverTargets are the endpoints of the servicecalls package
+	annotations   map[string]map[callanalyzer.Position]string
+	declared      []*callanalyzer.CallTarget // declared are the client targets of the Dependencies of the options
+	resultCache   *cache.Cache               // resultCache is nil when the cache is disabled
+	collector     *diagnostics.Collector     // collector holds the diagnostics that do not belong to a single service
+}
+
+// NewProject finds the services of the project and prepares their analysis, without analysing them yet
+func NewProject(options Options) (*Project, error) {
+	if options.Jobs < 1 {
+		options.Jobs = 1
+	}
+
+	if options.Discovery != "" && !preprocessing.IsValidDiscovery(options.Discovery) {
+		return nil, fmt.Errorf("unknown service discovery: %s", options.Discovery)
+	}
+
+	services, err := options.finder().FindServices()
+	if err != nil {
+		return nil, err
+	}
+
+	nameSources := options.NameSources
+	if len(nameSources) == 0 {
+		nameSources = []string{preprocessing.NameFromDirectory}
+	}
+	if err := preprocessing.ResolveServices(options.ProjectDir, services, nameSources); err != nil {
+		return nil, err
+	}
+
+	services, err = withoutIgnoredServices(services, options.IgnoredServices)
+	if err != nil {
+		return nil, err
+	}
+
+	// resolve environment values
+	envVariables, fileHosts, err := resolveEnvironmentValues(options.EnvFile, services)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestVariables, manifestHosts, err := resolveManifests(options.Manifests, services)
+	if err != nil {
+		return nil, err
+	}
+	dotenvVariables, err := preprocessing.IndexDotenvFiles(services, options.Profile, options.DotenvFiles)
+	if err != nil {
+		return nil, err
+	}
+	envVariables = mergeEnvironments(manifestVariables, dotenvVariables, envVariables)
+
+	analyserConfig := callanalyzer.DefaultConfigForFindingHTTPCalls()
+	analyserConfig.SetVerbose(options.Verbose)
+	analyserConfig.SetEnv(envVariables)
+	analyserConfig.SetFlags(options.Flags)
+	applyRules(&analyserConfig, options.Rules)
+	analyserConfig.SetServiceNames(serviceNamesByPackage(services))
+	analyserConfig.SetServiceDirectories(serviceDirectories(services))
+
+	collector := diagnostics.NewCollector()
+	internalCalls, serverTargets, err := servicecallsanalyzer.ParseServiceCallsPackage(options.ServiceCallsDir, collector)
+	if err != nil {
+		return nil, err
+	}
+
+	project := &Project{
+		serviceAnalysis: serviceAnalysis{
+			options:        &options,
+			analyserConfig: &analyserConfig,
+			internalCalls:  internalCalls,
+		},
+		services:      services,
+		environment:   envVariables,
+		hosts:         mergeHosts(manifestHosts, fileHosts, options.Hosts),
+		results:       make([]serviceResult, len(services)),
+		serverTargets: *serverTargets,
+		annotations:   make(map[string]map[callanalyzer.Position]string),
+		collector:     collector,
+	}
+	analyserConfig.SetAnnotations(project.annotations)
+	project.declared = declaredTargets(options.Dependencies, services, collector)
+
+	if !options.NoCache {
+		cacheDir := options.CacheDir
+		if cacheDir == "" {
+			cacheDir, err = cache.DefaultDir()
+			if err != nil {
+				return nil, fmt.Errorf("the cache directory cannot be determined: %w", err)
+			}
+		}
+		project.resultCache = cache.New(cacheDir)
+	}
+
+	return project, nil
+}
+
+// declaredTargets returns the client targets of the declared dependencies. Dependencies of which the source
+// is not one of the services, for example because it is ignored, are left out with a warning.
+func declaredTargets(dependencies []Dependency, services []preprocessing.Service, collector *diagnostics.Collector) []*callanalyzer.CallTarget {
+	targets := make([]*callanalyzer.CallTarget, 0, len(dependencies))
+
+	for _, dependency := range dependencies {
+		if !hasService(services, dependency.Source) {
+			collector.Warningf(diagnostics.StagePreprocessing, dependency.Source, "",
+				"the declared dependency of %s is left out, as it is not an analysed service", dependency.Source)
+			continue
+		}
+
+		targets = append(targets, callanalyzer.NewDeclaredTarget(dependency.Source, dependency.Target, dependency.Protocol, dependency.URL, nil))
+	}
+
+	return targets
+}
+
+// hasService checks whether one of the services has the name
+func hasService(services []preprocessing.Service, name string) bool {
+	for _, service := range services {
+		if service.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// finder returns the finder of the services, which is the ServiceFinder if it is set or else depends on Discovery
+func (options *Options) finder() ServiceFinder {
+	if options.ServiceFinder != nil {
+		return options.ServiceFinder
+	}
+
+	switch options.Discovery {
+	case DiscoverMainPackages:
+		return preprocessing.MainPackageFinder{ProjectDir: options.ProjectDir}
+	case DiscoverWorkspace:
+		workFile := options.WorkFile
+		if workFile == "" {
+			workFile = filepath.Join(options.ProjectDir, "go.work")
+		}
+		return preprocessing.WorkspaceFinder{WorkFile: workFile}
+	case DiscoverConfig:
+		return preprocessing.PatternFinder{ProjectDir: options.ProjectDir, Patterns: options.Services}
+	default:
+		return preprocessing.DirectoryFinder{ServicesDir: options.ServiceDir}
+	}
+}
+
+// withoutIgnoredServices leaves out the services of which the name matches one of the ignored patterns
+func withoutIgnoredServices(services []preprocessing.Service, ignoredServices []string) ([]preprocessing.Service, error) {
+	remaining := make([]preprocessing.Service, 0, len(services))
+
+	for _, service := range services {
+		isIgnored := false
+		for _, pattern := range ignoredServices {
+			matches, err := path.Match(pattern, service.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ignored service %s: %w", pattern, err)
+			}
+			isIgnored = isIgnored || matches
+		}
+
+		if !isIgnored {
+			remaining = append(remaining, service)
+		}
+	}
+
+	if len(remaining) == 0 {
+		return nil, fmt.Errorf("no services to analyse were found")
+	}
+
+	return remaining, nil
+}
+
+// serviceDirectories maps the name of each service to its directory
+func serviceDirectories(services []preprocessing.Service) map[string]string {
+	serviceDirs := make(map[string]string, len(services))
+	for _, service := range services {
+		serviceDirs[service.Name] = service.Dir
+	}
+
+	return serviceDirs
+}
+
+// serviceNamesByPackage maps the directory of each main package to the name of its service
+func serviceNamesByPackage(services []preprocessing.Service) map[string]string {
+	serviceNames := make(map[string]string)
+	for _, service := range services {
+		for _, packageDir := range service.Packages {
+			serviceNames[packageDir] = service.Name
+		}
+	}
+
+	return serviceNames
+}
+
+// applyRules adds the calls and ignored packages of the rules to the analyser configuration
+func applyRules(analyserConfig *callanalyzer.AnalyserConfig, rules Rules) {
+	for qualifiedName, targetArgs := range rules.ClientCalls {
+		analyserConfig.AddInterestingClientCall(qualifiedName, targetArgs)
+	}
+
+	for qualifiedName, endpointArgs := range rules.ServerCalls {
+		analyserConfig.AddInterestingServerCall(qualifiedName, endpointArgs)
+	}
+
+	for _, pkg := range rules.IgnoredPackages {
+		analyserConfig.AddIgnoredPackage(pkg)
+	}
+
+	for _, exclusion := range rules.Exclusions {
+		analyserConfig.AddExclusion(exclusion)
+	}
+
+	if rules.MaxTraversalDepth > 0 {
+		analyserConfig.SetMaxTraversalDepth(rules.MaxTraversalDepth)
+	}
+}
+
+// resolveEnvironmentValues calls resolving stage if the path is not unspecified(""), returns nil otherwise.
+// For a Docker Compose file, the hosts of its services are returned as well.
+func resolveEnvironmentValues(path string, services []preprocessing.Service) (map[string]map[string]string, map[string]string, error) {
+	if path == "" {
+		return nil, nil, nil
+	}
+
+	if preprocessing.IsComposeFile(path) {
+		return preprocessing.IndexComposeFile(path, services)
+	}
+
+	envVariables, err := preprocessing.IndexEnvironmentVariables(path)
+	return envVariables, nil, err
+}
+
+// resolveManifests reads the environment variables and hosts of the Kubernetes manifests, if any
+func resolveManifests(paths []string, services []preprocessing.Service) (map[string]map[string]string, map[string]string, error) {
+	if len(paths) == 0 {
+		return nil, nil, nil
+	}
+	return preprocessing.IndexKubernetesManifests(paths, services)
+}
+
+// mergeEnvironments combines the environment variables of each service, of which the later ones take precedence
+func mergeEnvironments(environments ...map[string]map[string]string) map[string]map[string]string {
+	merged := make(map[string]map[string]string)
+	for _, environment := range environments {
+		for service, variables := range environment {
+			if merged[service] == nil {
+				merged[service] = make(map[string]string)
+			}
+			for name, value := range variables {
+				merged[service][name] = value
+			}
+		}
+	}
+
+	return merged
+}
+
+// mergeHosts combines the host mappings, of which the later ones take precedence
+func mergeHosts(hostMappings ...map[string]string) map[string]string {
+	hosts := make(map[string]string)
+	for _, hostMapping := range hostMappings {
+		for host, service := range hostMapping {
+			hosts[host] = service
+		}
+	}
+
+	return hosts
+}
+
+// Services returns the directories of the services of the project
+func (project *Project) Services() []string {
+	serviceDirs := make([]string, 0, len(project.services))
+	for _, service := range project.services {
+		serviceDirs = append(serviceDirs, service.Dir)
+	}
+
+	return serviceDirs
+}
+
+// Analyze (re-)analyses the services with the given directories, or all services if none are given,
+// and returns the result of the whole project. Services of which the sources did not change since an earlier
+// run are loaded from the cache, unless it is disabled. Cancelling the context stops the analysis before
+// the next service is analysed.
+func (project *Project) Analyze(ctx context.Context, serviceDirs ...string) (*Result, error) {
+	indices := make([]int, 0, len(project.services))
+
+	if len(serviceDirs) == 0 {
+		for i := range project.services {
+			indices = append(indices, i)
+		}
+	}
+
+	for _, serviceDir := range serviceDirs {
+		index := project.indexOf(serviceDir)
+		if index < 0 {
+			return nil, fmt.Errorf("unknown service directory: %s", serviceDir)
+		}
+		indices = append(indices, index)
+	}
+
+	runDiagnostics, err := project.analyse(ctx, indices)
+	if err != nil {
+		return nil, err
+	}
+
+	return project.result(runDiagnostics)
+}
+
+// indexOf returns the index of the service with the directory, or -1 if there is no such service
+func (project *Project) indexOf(serviceDir string) int {
+	for i, service := range project.services {
+		if service.Dir == filepath.Clean(serviceDir) {
+			return i
+		}
+	}
+	return -1
+}
+
+// analyse (re-)analyses the services with the given indices. Up to options.Jobs services are analysed concurrently.
+// Returns the diagnostics of the run itself, such as packages of the single program that could not be type-checked
+// and results that could not be stored in the cache.
+func (project *Project) analyse(ctx context.Context, indices []int) ([]Diagnostic, error) {
+	runCollector := diagnostics.NewCollector()
+
+	sharedSources := ""
+	if project.resultCache != nil {
+		var err error
+		sharedSources, err = cache.HashSharedSources(project.options.ProjectDir, project.Services()...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	uncachedServices := make([]preprocessing.Service, 0)
+	uncachedIndices := make([]int, 0)
+
+	// load the annotations before the analysis, so the map is only read while the services are analysed concurrently
+	for _, i := range indices {
+		result, err := project.loadCachedResult(sharedSources, project.services[i])
+		if err != nil {
+			return nil, err
+		}
+		project.results[i] = result
+
+		if !result.isCached {
+			uncachedServices = append(uncachedServices, project.services[i])
+			uncachedIndices = append(uncachedIndices, i)
+		}
+	}
+
+	// build a single SSA program for all services, instead of one program per service
+	project.packagesByService = nil
+	if project.options.SingleProgram && !project.options.Shallow && len(uncachedServices) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var err error
+		project.packagesByService, err = preprocessing.LoadAndBuildProgram(project.options.ProjectDir, uncachedServices, runCollector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	collectors := make([]*diagnostics.Collector, len(uncachedIndices))
+	for j, i := range uncachedIndices {
+		collectors[j] = project.results[i].collector
+	}
+
+	for j, result := range project.analyseServicesConcurrently(ctx, uncachedServices, collectors) {
+		i := uncachedIndices[j]
+		result.cacheKey = project.results[i].cacheKey
+		result.diagnostics = collectors[j].Diagnostics()
+		project.results[i] = result
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, i := range indices {
+		result := &project.results[i]
+		if result.err != nil {
+			return nil, result.err
+		}
+
+		if !result.isCached {
+			serviceName := project.services[i].Name
+			err := project.storeResult(result, project.annotations[serviceName])
+			if err != nil {
+				runCollector.Warningf(diagnostics.StageCache, serviceName, "",
+					"could not store the analysis results in the cache: %s", err)
+			}
+		}
+	}
+
+	return runCollector.Diagnostics(), nil
+}
+
+// result combines the results of all services and builds the dependency graph.
+// The diagnostics of the project come first, then those of each service, and then those of the run.
+func (project *Project) result(runDiagnostics []Diagnostic) (*Result, error) {
+	dependencies, err := project.dependencies()
+	if err != nil {
+		return nil, err
+	}
+	dependencies, suppressed := withoutSuppressed(dependencies)
+	graph := matching.CreateDependencyGraph(dependencies)
+
+	result := &Result{
+		Services:     make([]Service, 0, len(project.services)),
+		Dependencies: dependencies,
+		Graph:        graph,
+		Metrics:      output.ComputeMetrics(graph),
+		Unresolved:   make([]*callanalyzer.CallTarget, 0),
+		Suppressed:   suppressed,
+		Annotations:  project.annotations,
+		Diagnostics:  project.collector.Diagnostics(),
+	}
+
+	for i, service := range project.services {
+		serviceResult := &project.results[i]
+
+		result.Services = append(result.Services, Service{
+			Name:        service.Name,
+			Dir:         service.Dir,
+			ClientCalls: len(serviceResult.clientTargets),
+			ServerCalls: len(serviceResult.serverTargets),
+			IsCached:    serviceResult.isCached,
+		})
+
+		for _, target := range discovery.FilterUnresolvedTargets(serviceResult.clientTargets, serviceResult.serverTargets) {
+			if target.Suppressed == "" {
+				result.Unresolved = append(result.Unresolved, target)
+			}
+		}
+		result.Diagnostics = append(result.Diagnostics, serviceResult.diagnostics...)
+	}
+	result.Diagnostics = append(result.Diagnostics, runDiagnostics...)
+
+	return result, nil
+}
+
+// dependencies combines the results of all services
+func (project *Project) dependencies() (*structures.Dependencies, error) {
+	dependencies := &structures.Dependencies{
+		Calls:     make([]*callanalyzer.CallTarget, 0),
+		Endpoints: append(make([]*callanalyzer.CallTarget, 0), project.serverTargets...),
+		Consumers: make([]*natsanalyzer.NatsCall, 0),
+		Producers: make([]*natsanalyzer.NatsCall, 0),
+		Hosts:     project.hosts,
+	}
+	internalClientTargets := make([]*callanalyzer.CallTarget, 0)
+
+	packageCount := 0
+	var loadErr error
+	for i := range project.results {
+		result := &project.results[i]
+
+		packageCount += result.packageCount
+		if loadErr == nil {
+			loadErr = result.loadErr
+		}
+		dependencies.Calls = append(dependencies.Calls, result.clientTargets...)
+		dependencies.Endpoints = append(dependencies.Endpoints, result.serverTargets...)
+		dependencies.Consumers = append(dependencies.Consumers, result.consumers...)
+		dependencies.Producers = append(dependencies.Producers, result.producers...)
+		internalClientTargets = append(internalClientTargets, result.internalClientTargets...)
+	}
+
+	dependencies.Calls = append(dependencies.Calls, internalClientTargets...)
+	dependencies.Calls = append(dependencies.Calls, callanalyzer.DeclaredDependencies(project.annotations)...)
+	dependencies.Calls = append(dependencies.Calls, project.declared...)
+	consumers, producers := natsanalyzer.AnnotatedCalls(project.annotations)
+	dependencies.Consumers = append(dependencies.Consumers, consumers...)
+	dependencies.Producers = append(dependencies.Producers, producers...)
+
+	if !project.options.Shallow && packageCount == 0 {
+		// none of the services could be loaded, so the reason is returned instead of recorded
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return nil, fmt.Errorf("no services to analyse were found")
+	}
+	return dependencies, nil
+}
+
+// withoutSuppressed splits the calls and endpoints that were suppressed from the dependencies
+func withoutSuppressed(dependencies *structures.Dependencies) (*structures.Dependencies, *structures.Dependencies) {
+	kept := *dependencies
+	kept.Calls = make([]*callanalyzer.CallTarget, 0, len(dependencies.Calls))
+	kept.Endpoints = make([]*callanalyzer.CallTarget, 0, len(dependencies.Endpoints))
+	suppressed := &structures.Dependencies{
+		Calls:     make([]*callanalyzer.CallTarget, 0),
+		Endpoints: make([]*callanalyzer.CallTarget, 0),
+	}
+
+	for _, call := range dependencies.Calls {
+		if call.Suppressed != "" {
+			suppressed.Calls = append(suppressed.Calls, call)
+		} else {
+			kept.Calls = append(kept.Calls, call)
+		}
+	}
+	for _, endpoint := range dependencies.Endpoints {
+		if endpoint.Suppressed != "" {
+			suppressed.Endpoints = append(suppressed.Endpoints, endpoint)
+		} else {
+			kept.Endpoints = append(kept.Endpoints, endpoint)
+		}
+	}
+
+	return &kept, suppressed
+}
+
+// loadCachedResult loads the annotations and, if the service did not change, the result of a service from the cache.
+// When the service is not cached, its annotations are loaded from its sources.
+func (project *Project) loadCachedResult(sharedSources string, service preprocessing.Service) (serviceResult, error) {
+	options := project.options
+	serviceName := service.Name
+	result := serviceResult{}
+
+	if project.resultCache != nil {
+		key, err := cache.Key(cache.KeyInputs{
+			ServiceName:     serviceName,
+			ServiceDir:      service.Dir,
+			ProjectDir:      options.ProjectDir,
+			ServiceCallsDir: options.ServiceCallsDir,
+			EnvFile:         options.EnvFile,
+			Environment:     project.environment[serviceName],
+			Flags:           options.Flags[serviceName],
+			SharedSources:   sharedSources,
+			Fingerprint:     fmt.Sprintf("%s shallow=%t", project.analyserConfig.Fingerprint(), options.Shallow),
+		})
+		if err != nil {
+			return result, err
+		}
+		result.cacheKey = key
+
+		if entry, ok := project.resultCache.Load(key); ok {
+			project.annotations[serviceName] = entry.Annotations
+			if project.annotations[serviceName] == nil {
+				project.annotations[serviceName] = make(map[callanalyzer.Position]string)
+			}
+
+			return serviceResult{
+				clientTargets:         entry.ClientTargets,
+				serverTargets:         entry.ServerTargets,
+				internalClientTargets: entry.InternalClientTargets,
+				consumers:             entry.Consumers,
+				producers:             entry.Producers,
+				packageCount:          entry.PackageCount,
+				cacheKey:              key,
+				isCached:              true,
+				diagnostics:           entry.Diagnostics,
+			}, nil
+		}
+	}
+
+	result.collector = diagnostics.NewCollector()
+	return result, preprocessing.LoadAnnotations(service.Dir, serviceName, project.annotations, result.collector)
+}
+
+// storeResult stores the result of an analysed service in the cache
+func (project *Project) storeResult(result *serviceResult, annotations map[callanalyzer.Position]string) error {
+	if project.resultCache == nil || result.cacheKey == "" {
+		return nil
+	}
+
+	return project.resultCache.Store(result.cacheKey, &cache.Entry{
+		ClientTargets:         result.clientTargets,
+		ServerTargets:         result.serverTargets,
+		InternalClientTargets: result.internalClientTargets,
+		PackageCount:          result.packageCount,
+		Consumers:             result.consumers,
+		Producers:             result.producers,
+		Annotations:           annotations,
+		Diagnostics:           result.diagnostics,
+	})
+}
+
+// analyseServicesConcurrently analyses the services using a pool of options.Jobs workers, recording the diagnostics
+// of each service in its collector. The result of each service is stored at the index of the service,
+// so the order of the results is deterministic. Once the analysis of a service fails or the context is cancelled,
+// the services that have not been started yet are skipped.
+func (analysis *serviceAnalysis) analyseServicesConcurrently(ctx context.Context, services []preprocessing.Service, collectors []*diagnostics.Collector) []serviceResult {
+	results := make([]serviceResult, len(services))
+	indices := make(chan int)
+
+	var failed int32
+	var waitGroup sync.WaitGroup
+
+	for worker := 0; worker < analysis.options.Jobs && worker < len(services); worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			for i := range indices {
+				if atomic.LoadInt32(&failed) != 0 || ctx.Err() != nil {
+					continue
+				}
+
+				results[i] = analysis.analyseService(services[i], collectors[i])
+				if results[i].err != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	for i := range services {
+		indices <- i
+	}
+	close(indices)
+	waitGroup.Wait()
+
+	return results
+}
+
+// analyseService discovers the servicecalls, NATS calls, client calls and server calls of a single service
+func (analysis *serviceAnalysis) analyseService(service preprocessing.Service, collector *diagnostics.Collector) serviceResult {
+	options := analysis.options
+	serviceDir, serviceName := service.Dir, service.Name
+	result := serviceResult{internalClientTargets: make([]*callanalyzer.CallTarget, 0)}
+
+	// There are some interesting internal calls so the tool should parse all methods
+	if len(analysis.internalCalls) != 0 {
+		result.err = servicecallsanalyzer.LoadServiceCalls(serviceDir, serviceName, analysis.internalCalls, &result.internalClientTargets, analysis.analyserConfig, collector)
+		if result.err != nil {
+			return result
+		}
+	}
+
+	result.consumers, result.producers = natsanalyzer.FindServiceNATSCalls(serviceDir, serviceName, collector)
+
+	// Load and build packages and proceed with discovery if the user
+	// Didn't ask for shallow scanning
+	if options.Shallow {
+		return result
+	}
+
+	// load packages, unless they are part of the single program that was built for all services
+	packagesInService, ok := analysis.packagesByService[serviceDir]
+	if !options.SingleProgram {
+		var err error
+		packagesInService, err = preprocessing.LoadAndBuildService(service, collector)
+		if err != nil {
+			// the other services can still be analysed, so this is recorded instead of returned
+			collector.Errorf(diagnostics.StagePreprocessing, serviceName, "", "the service could not be loaded: %s", err)
+			result.loadErr = err
+			return result
+		}
+	} else if !ok {
+		collector.Warningf(diagnostics.StagePreprocessing, serviceName, "", "no usable packages found in the service")
+	}
+	result.packageCount = len(packagesInService)
+
+	// discover calls
+	result.clientTargets, result.serverTargets, result.err = discovery.DiscoverAll(packagesInService, analysis.analyserConfig)
+
+	return result
+}
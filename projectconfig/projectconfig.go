@@ -0,0 +1,266 @@
+// Package projectconfig reads the project configuration file, which holds the options of netDep for a project
+// so they do not have to be repeated on each invocation
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package projectconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/preprocessing"
+)
+
+// FileName is the name of the configuration file that is looked for in the project directory
+const FileName = ".netdep.yaml"
+
+// Config is the content of a configuration file. Paths are relative to the directory of the file.
+// Options that are left out keep the default of their flag.
+type Config struct {
+	ProjectDirectory      string                         `yaml:"projectDirectory"`
+	ServiceDirectory      string                         `yaml:"serviceDirectory"`
+	ServicecallsDirectory string                         `yaml:"servicecallsDirectory"`
+	EnvironmentVariables  string                         `yaml:"environmentVariables"`
+	Output                Output                         `yaml:"output"`
+	Shallow               *bool                          `yaml:"shallow"` // Shallow is nil when it is left out
+	Verbose               *bool                          `yaml:"verbose"` // Verbose is nil when it is left out
+	Discovery             string                         `yaml:"discovery"`
+	Services              []preprocessing.ServicePattern `yaml:"services"`
+	ServiceNames          []string                       `yaml:"serviceNames"`
+	Manifests             []string                       `yaml:"manifests"`
+	Dotenv                map[string][]string            `yaml:"dotenv"` // Dotenv maps a service to its dotenv files
+	Ignore                Ignore                         `yaml:"ignore"`
+	Calls                 Calls                          `yaml:"calls"`
+	Aliases               map[string][]string            `yaml:"aliases"` // Aliases maps a service to the other names under which it is called
+	Hosts                 map[string]string              `yaml:"hosts"`   // Hosts maps a host, optionally with its port, to a service
+	Flags                 map[string]map[string]string   `yaml:"flags"`   // Flags maps a service to the values of its command-line flags
+	Dependencies          []Dependency                   `yaml:"dependencies"`
+	PublicRoutes          []string                       `yaml:"publicRoutes"` // PublicRoutes are the routes that are called from outside the project
+	Profiles              map[string]*Profile            `yaml:"profiles"`
+}
+
+// Dependency declares a dependency of a service that cannot be discovered in its code, on a service or URL
+type Dependency struct {
+	From     string `yaml:"from"`
+	To       string `yaml:"to"`
+	Protocol string `yaml:"protocol"`
+	URL      string `yaml:"url"`
+}
+
+// Profile holds the sources of the environment of a deployment, such as staging or production,
+// which replace those of the configuration when the profile is selected
+type Profile struct {
+	EnvironmentVariables string                       `yaml:"environmentVariables"`
+	Manifests            []string                     `yaml:"manifests"`
+	Dotenv               map[string][]string          `yaml:"dotenv"`
+	Hosts                map[string]string            `yaml:"hosts"`
+	Flags                map[string]map[string]string `yaml:"flags"`
+}
+
+// Output configures where and how the dependency graph is written
+type Output struct {
+	File   string `yaml:"file"`
+	Format string `yaml:"format"`
+}
+
+// Ignore lists the parts of the project that are left out of the analysis
+type Ignore struct {
+	Packages []string    `yaml:"packages"` // Packages are the packages of which the functions are not traversed
+	Services []string    `yaml:"services"` // Services are the names of the services that are not analysed, which may contain wildcards
+	Calls    []Exclusion `yaml:"calls"`    // Calls are the calls and endpoints that are left out of the dependency graph
+}
+
+// Exclusion leaves the calls and endpoints that match all of its patterns out of the dependency graph.
+// The patterns may contain wildcards, at least one of them is needed.
+type Exclusion struct {
+	Service  string `yaml:"service"`
+	Package  string `yaml:"package"`
+	URL      string `yaml:"url"`
+	Function string `yaml:"function"`
+	Reason   string `yaml:"reason"`
+}
+
+// Calls are the functions that the analyser looks for in addition to the default ones, mapping the qualified name
+// of each function to the indices of the arguments holding the target (client) or endpoint (server)
+type Calls struct {
+	Client            map[string][]int `yaml:"client"`
+	Server            map[string][]int `yaml:"server"`
+	MaxTraversalDepth int              `yaml:"maxTraversalDepth"`
+}
+
+// Load reads the configuration file, and makes the paths in it absolute
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("the configuration file cannot be read: %s", path)
+	}
+
+	config := &Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("the configuration file cannot be parsed: %w", err)
+	}
+
+	for _, pattern := range config.Services {
+		if pattern.Path == "" {
+			return nil, fmt.Errorf("the service %s in the configuration file has no path", pattern.Name)
+		}
+	}
+	for _, dependency := range config.Dependencies {
+		if dependency.From == "" || dependency.To == "" && dependency.URL == "" {
+			return nil, fmt.Errorf("a dependency in the configuration file needs a from service, and a to service or url")
+		}
+	}
+
+	for _, exclusion := range config.Ignore.Calls {
+		if err := exclusion.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	baseDir := filepath.Dir(absolutePath)
+
+	paths := []*string{
+		&config.ProjectDirectory,
+		&config.ServiceDirectory,
+		&config.ServicecallsDirectory,
+		&config.EnvironmentVariables,
+		&config.Output.File,
+	}
+	paths = append(paths, pathsOf(config.Manifests, config.Dotenv)...)
+	for _, profile := range config.Profiles {
+		if profile != nil {
+			paths = append(paths, &profile.EnvironmentVariables)
+			paths = append(paths, pathsOf(profile.Manifests, profile.Dotenv)...)
+		}
+	}
+
+	for _, pth := range paths {
+		if *pth != "" && !filepath.IsAbs(*pth) {
+			*pth = filepath.Join(baseDir, *pth)
+		}
+	}
+
+	return config, nil
+}
+
+// validate checks that the exclusion has a pattern, and that its patterns are valid
+func (exclusion Exclusion) validate() error {
+	patterns := []string{exclusion.Service, exclusion.Package, exclusion.URL, exclusion.Function}
+
+	hasPattern := false
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		hasPattern = true
+
+		if _, err := pathpkg.Match(pattern, ""); err != nil {
+			return fmt.Errorf("the ignored call pattern %q in the configuration file is invalid: %w", pattern, err)
+		}
+	}
+	if !hasPattern {
+		return fmt.Errorf("an ignored call in the configuration file needs a service, package, url or function")
+	}
+
+	return nil
+}
+
+// pathsOf returns pointers to the paths of the manifests and dotenv files
+func pathsOf(manifests []string, dotenv map[string][]string) []*string {
+	paths := make([]*string, 0, len(manifests))
+	for i := range manifests {
+		paths = append(paths, &manifests[i])
+	}
+	for _, files := range dotenv {
+		for i := range files {
+			paths = append(paths, &files[i])
+		}
+	}
+
+	return paths
+}
+
+// ApplyProfile replaces the sources of the environment with those that the profile sets, and adds its hosts and flags.
+// A profile that is not defined is only an error if the configuration defines any profiles, as a profile
+// also selects the .env.<profile> files of the services.
+func (config *Config) ApplyProfile(name string) error {
+	profile, ok := config.Profiles[name]
+	if !ok && len(config.Profiles) > 0 {
+		return fmt.Errorf("the profile %s is not defined in the configuration file", name)
+	} else if profile == nil {
+		return nil
+	}
+
+	if profile.EnvironmentVariables != "" {
+		config.EnvironmentVariables = profile.EnvironmentVariables
+	}
+	if len(profile.Manifests) > 0 {
+		config.Manifests = profile.Manifests
+	}
+
+	if config.Dotenv == nil {
+		config.Dotenv = make(map[string][]string)
+	}
+	for service, files := range profile.Dotenv {
+		config.Dotenv[service] = files
+	}
+
+	if config.Hosts == nil {
+		config.Hosts = make(map[string]string)
+	}
+	for host, service := range profile.Hosts {
+		config.Hosts[host] = service
+	}
+
+	if config.Flags == nil {
+		config.Flags = make(map[string]map[string]string)
+	}
+	for service, flags := range profile.Flags {
+		if config.Flags[service] == nil {
+			config.Flags[service] = make(map[string]string)
+		}
+		for name, value := range flags {
+			config.Flags[service][name] = value
+		}
+	}
+
+	return nil
+}
+
+// Find returns the path of the configuration file in the project directory, if there is one
+func Find(projectDir string) (string, bool, error) {
+	path := filepath.Join(projectDir, FileName)
+
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	return path, true, nil
+}
+
+// HostMappings combines the hosts and the aliases of the services into a single mapping from host to service
+func (config *Config) HostMappings() map[string]string {
+	hosts := make(map[string]string)
+	for service, aliases := range config.Aliases {
+		for _, alias := range aliases {
+			hosts[alias] = service
+		}
+	}
+
+	for host, service := range config.Hosts {
+		hosts[host] = service
+	}
+
+	return hosts
+}
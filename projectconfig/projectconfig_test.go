@@ -0,0 +1,198 @@
+// Package projectconfig
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package projectconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/preprocessing"
+)
+
+// writeConfig writes the content to a configuration file in a temporary directory and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), FileName)
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+serviceDirectory: ./svc
+environmentVariables: /etc/netdep/env.yaml
+output:
+  file: deps.json
+  format: json
+shallow: true
+discovery: config
+services:
+  - name: billing
+    path: billing/cmd/server
+serviceNames: [gomod, dockerfile]
+manifests: [deploy/rendered.yaml]
+ignore:
+  packages: [encoding/json]
+  services: [tools-*]
+calls:
+  client:
+    (*example.com/client.Client).Do: [1]
+  maxTraversalDepth: 5
+`)
+	baseDir := filepath.Dir(path)
+
+	config, err := Load(path)
+	assert.Nil(t, err)
+
+	// relative paths are resolved against the directory of the file, absolute paths are kept
+	assert.Equal(t, "", config.ProjectDirectory)
+	assert.Equal(t, filepath.Join(baseDir, "svc"), config.ServiceDirectory)
+	assert.Equal(t, "/etc/netdep/env.yaml", config.EnvironmentVariables)
+	assert.Equal(t, Output{File: filepath.Join(baseDir, "deps.json"), Format: "json"}, config.Output)
+
+	assert.True(t, *config.Shallow)
+	assert.Nil(t, config.Verbose)
+	assert.Equal(t, "config", config.Discovery)
+	assert.Equal(t, []preprocessing.ServicePattern{{Name: "billing", Path: "billing/cmd/server"}}, config.Services)
+	assert.Equal(t, []string{"gomod", "dockerfile"}, config.ServiceNames)
+	assert.Equal(t, []string{filepath.Join(baseDir, "deploy", "rendered.yaml")}, config.Manifests)
+	assert.Equal(t, Ignore{Packages: []string{"encoding/json"}, Services: []string{"tools-*"}}, config.Ignore)
+	assert.Equal(t, map[string][]int{"(*example.com/client.Client).Do": {1}}, config.Calls.Client)
+	assert.Equal(t, 5, config.Calls.MaxTraversalDepth)
+}
+
+func TestLoadServiceWithoutPath(t *testing.T) {
+	path := writeConfig(t, "services:\n  - name: billing\n")
+
+	_, err := Load(path)
+	assert.EqualError(t, err, "the service billing in the configuration file has no path")
+}
+
+func TestLoadDependencies(t *testing.T) {
+	config, err := Load(writeConfig(t, `
+dependencies:
+  - from: orders
+    to: users
+    protocol: gRPC
+  - from: orders
+    url: https://api.stripe.com/v1/charges
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []Dependency{
+		{From: "orders", To: "users", Protocol: "gRPC"},
+		{From: "orders", URL: "https://api.stripe.com/v1/charges"},
+	}, config.Dependencies)
+
+	_, err = Load(writeConfig(t, "dependencies:\n  - from: orders\n"))
+	assert.EqualError(t, err, "a dependency in the configuration file needs a from service, and a to service or url")
+}
+
+func TestLoadIgnoredCalls(t *testing.T) {
+	config, err := Load(writeConfig(t, `
+ignore:
+  calls:
+    - url: /healthz
+      reason: health checks are not dependencies
+    - service: orders
+      function: "*mock*"
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []Exclusion{
+		{URL: "/healthz", Reason: "health checks are not dependencies"},
+		{Service: "orders", Function: "*mock*"},
+	}, config.Ignore.Calls)
+
+	_, err = Load(writeConfig(t, "ignore:\n  calls:\n    - reason: nothing\n"))
+	assert.EqualError(t, err, "an ignored call in the configuration file needs a service, package, url or function")
+
+	_, err = Load(writeConfig(t, "ignore:\n  calls:\n    - url: /users/[\n"))
+	assert.EqualError(t, err, `the ignored call pattern "/users/[" in the configuration file is invalid: syntax error in pattern`)
+}
+
+func TestLoadInvalidFile(t *testing.T) {
+	_, err := Load(writeConfig(t, "services: billing\n"))
+	assert.NotNil(t, err)
+
+	_, err = Load(filepath.Join(t.TempDir(), FileName))
+	assert.NotNil(t, err)
+}
+
+func TestFind(t *testing.T) {
+	path := writeConfig(t, "")
+
+	found, ok, err := Find(filepath.Dir(path))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, path, found)
+
+	_, ok, err = Find(t.TempDir())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestHostMappings(t *testing.T) {
+	config := &Config{
+		Aliases: map[string][]string{"users": {"users.default.svc.cluster.local", "user-api"}},
+		Hosts:   map[string]string{"localhost:8081": "users", "user-api": "accounts"},
+	}
+
+	// hosts take precedence over aliases
+	assert.Equal(t, map[string]string{
+		"users.default.svc.cluster.local": "users",
+		"user-api":                        "accounts",
+		"localhost:8081":                  "users",
+	}, config.HostMappings())
+}
+
+func TestApplyProfile(t *testing.T) {
+	path := writeConfig(t, `
+environmentVariables: env/dev.yaml
+manifests: [deploy/dev.yaml]
+dotenv:
+  orders: [orders.env]
+hosts:
+  localhost:8081: users
+flags:
+  orders:
+    users-url: http://localhost:8081
+    billing-url: http://localhost:8082
+profiles:
+  prod:
+    environmentVariables: env/prod.yaml
+    dotenv:
+      users: [users.prod.env]
+    hosts:
+      users.example.com: users
+    flags:
+      orders:
+        users-url: http://users.example.com
+  staging:
+`)
+	baseDir := filepath.Dir(path)
+
+	config, err := Load(path)
+	assert.Nil(t, err)
+	assert.Nil(t, config.ApplyProfile("prod"))
+
+	// the profile replaces the sources it sets, and keeps the others
+	assert.Equal(t, filepath.Join(baseDir, "env", "prod.yaml"), config.EnvironmentVariables)
+	assert.Equal(t, []string{filepath.Join(baseDir, "deploy", "dev.yaml")}, config.Manifests)
+	assert.Equal(t, map[string][]string{
+		"orders": {filepath.Join(baseDir, "orders.env")},
+		"users":  {filepath.Join(baseDir, "users.prod.env")},
+	}, config.Dotenv)
+	assert.Equal(t, map[string]string{"localhost:8081": "users", "users.example.com": "users"}, config.Hosts)
+	assert.Equal(t, map[string]map[string]string{
+		"orders": {"users-url": "http://users.example.com", "billing-url": "http://localhost:8082"},
+	}, config.Flags)
+
+	assert.Nil(t, config.ApplyProfile("staging"))
+	assert.EqualError(t, config.ApplyProfile("qa"), "the profile qa is not defined in the configuration file")
+
+	// without profiles, a profile only selects the .env.<profile> files
+	assert.Nil(t, (&Config{}).ApplyProfile("qa"))
+}
@@ -0,0 +1,308 @@
+// Package server exposes the dependency graph of an analysis over HTTP, so that it can be queried by other tools
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+)
+
+// AnalyseFunc runs an analysis and returns the resulting dependency graph
+type AnalyseFunc func() (output.NodeGraph, error)
+
+// Edge is a call from one service to another, as it is returned by the API
+type Edge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	output.NetworkCall
+}
+
+// Status describes the dependency graph that is currently served
+type Status struct {
+	Services   int       `json:"services"`
+	Edges      int       `json:"edges"`
+	AnalysedAt time.Time `json:"analysedAt"`
+}
+
+// errorResponse is the body of responses to requests that failed
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server serves the dependency graph of the latest analysis.
+// Requests are served from the previous graph while a refresh is running.
+type Server struct {
+	analyse AnalyseFunc
+
+	// refreshMutex ensures that only a single analysis runs at a time
+	refreshMutex sync.Mutex
+
+	mutex         sync.RWMutex
+	graph         output.NodeGraph
+	adjacencyList output.AdjacencyList
+	analysedAt    time.Time
+}
+
+// New creates a Server that serves the graph of the given analysis, which is run once before New returns
+func New(analyse AnalyseFunc) (*Server, error) {
+	server := &Server{analyse: analyse}
+
+	if _, err := server.Refresh(); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// Refresh runs the analysis again and serves its result, unless it failed
+func (server *Server) Refresh() (Status, error) {
+	server.refreshMutex.Lock()
+	defer server.refreshMutex.Unlock()
+
+	graph, err := server.analyse()
+	if err != nil {
+		return Status{}, err
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.graph = graph
+	server.adjacencyList = output.ConstructAdjacencyList(graph)
+	server.analysedAt = time.Now()
+
+	return server.status(), nil
+}
+
+// status describes the current graph, and is to be called while holding the mutex
+func (server *Server) status() Status {
+	return Status{
+		Services:   len(server.graph.Nodes),
+		Edges:      len(server.graph.Edges),
+		AnalysedAt: server.analysedAt,
+	}
+}
+
+// Handler returns the handler of the API, which has the following endpoints:
+//	GET  /services                       all services
+//	GET  /services/{name}/dependencies   the calls of the service, grouped by the service they target
+//	GET  /services/{name}/dependents     the calls to the service, grouped by the service they originate from
+//	GET  /edges?protocol=NATS            all calls, optionally of a single protocol
+//	GET  /unresolved                     the calls of which the target could not be resolved
+//	GET  /cycles?protocols=sync          the circular dependencies, optionally over sync or async calls only
+//	POST /refresh                        runs the analysis again
+func (server *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services", server.handleServices)
+	mux.HandleFunc("/services/", server.handleService)
+	mux.HandleFunc("/edges", server.handleEdges)
+	mux.HandleFunc("/unresolved", server.handleUnresolved)
+	mux.HandleFunc("/cycles", server.handleCycles)
+	mux.HandleFunc("/refresh", server.handleRefresh)
+	return mux
+}
+
+// handleServices responds with all nodes of the graph, sorted by name
+func (server *Server) handleServices(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	server.mutex.RLock()
+	services := make([]*output.ServiceNode, len(server.graph.Nodes))
+	copy(services, server.graph.Nodes)
+	server.mutex.RUnlock()
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].ServiceName < services[j].ServiceName
+	})
+
+	writeJSON(writer, http.StatusOK, services)
+}
+
+// handleService responds with the dependencies or the dependents of a single service
+func (server *Server) handleService(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(request.URL.Path, "/services/"), "/")
+	const partCount = 2
+	if len(parts) != partCount || parts[0] == "" {
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("unknown endpoint: %s", request.URL.Path))
+		return
+	}
+
+	name := parts[0]
+
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+
+	dependencies, found := server.adjacencyList[name]
+	if !found {
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("unknown service: %s", name))
+		return
+	}
+
+	switch parts[1] {
+	case "dependencies":
+		writeJSON(writer, http.StatusOK, dependencies)
+	case "dependents":
+		writeJSON(writer, http.StatusOK, findDependents(server.adjacencyList, name))
+	default:
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("unknown endpoint: %s", request.URL.Path))
+	}
+}
+
+// findDependents returns the calls to the service, grouped by the service they originate from and sorted by its name
+func findDependents(adjacencyList output.AdjacencyList, name string) []output.ServiceCallList {
+	dependents := make([]output.ServiceCallList, 0)
+
+	for source, callLists := range adjacencyList {
+		for _, callList := range callLists {
+			if callList.Service == name {
+				dependents = append(dependents, output.ServiceCallList{
+					Service:       source,
+					Calls:         callList.Calls,
+					NumberOfCalls: callList.NumberOfCalls,
+				})
+			}
+		}
+	}
+
+	sort.Slice(dependents, func(i, j int) bool {
+		return dependents[i].Service < dependents[j].Service
+	})
+
+	return dependents
+}
+
+// handleEdges responds with all edges of the graph, or only those of the protocol given in the query
+func (server *Server) handleEdges(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	protocol := request.URL.Query().Get("protocol")
+
+	writeJSON(writer, http.StatusOK, server.findEdges(func(edge *output.ConnectionEdge) bool {
+		return protocol == "" || strings.EqualFold(edge.Call.Protocol, protocol)
+	}))
+}
+
+// handleUnresolved responds with the edges of which the target could not be resolved
+func (server *Server) handleUnresolved(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, server.findEdges((*output.ConnectionEdge).IsUnresolved))
+}
+
+// handleCycles responds with the circular dependencies of the graph, over the protocols given in the query
+func (server *Server) handleCycles(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	protocols := request.URL.Query().Get("protocols")
+	if protocols == "" {
+		protocols = output.AllProtocols
+	}
+	if !output.IsValidProtocolSelection(protocols) {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("invalid cycle protocols specified: %s", protocols))
+		return
+	}
+
+	server.mutex.RLock()
+	report := output.FindCycles(server.graph, protocols)
+	server.mutex.RUnlock()
+
+	writeJSON(writer, http.StatusOK, report)
+}
+
+// findEdges returns the edges that satisfy the filter, sorted by source, target, protocol and URL
+func (server *Server) findEdges(filter func(edge *output.ConnectionEdge) bool) []Edge {
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+
+	edges := make([]Edge, 0)
+	for _, edge := range server.graph.Edges {
+		if !filter(edge) {
+			continue
+		}
+
+		result := Edge{NetworkCall: edge.Call}
+		if edge.Source != nil {
+			result.Source = edge.Source.ServiceName
+		}
+		if edge.Target != nil {
+			result.Target = edge.Target.ServiceName
+		}
+
+		edges = append(edges, result)
+	}
+
+	sort.SliceStable(edges, func(i, j int) bool {
+		x, y := edges[i], edges[j]
+		if x.Source != y.Source {
+			return x.Source < y.Source
+		}
+		if x.Target != y.Target {
+			return x.Target < y.Target
+		}
+		if x.Protocol != y.Protocol {
+			return x.Protocol < y.Protocol
+		}
+		return x.URL < y.URL
+	})
+
+	return edges
+}
+
+// handleRefresh runs the analysis again, and responds with the status of the new graph
+func (server *Server) handleRefresh(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethod(writer, request, http.MethodPost) {
+		return
+	}
+
+	status, err := server.Refresh()
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, fmt.Sprintf("the analysis failed: %s", err))
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, status)
+}
+
+// allowMethod responds with an error if the method of the request is not the allowed method
+func allowMethod(writer http.ResponseWriter, request *http.Request, method string) bool {
+	if request.Method == method {
+		return true
+	}
+
+	writer.Header().Set("Allow", method)
+	writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method not allowed: %s", request.Method))
+	return false
+}
+
+// writeError responds with the status code and the message as JSON
+func writeError(writer http.ResponseWriter, statusCode int, message string) {
+	writeJSON(writer, statusCode, errorResponse{Error: message})
+}
+
+// writeJSON responds with the status code and the value as JSON
+func writeJSON(writer http.ResponseWriter, statusCode int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+
+	// the status code has been written, so an error can no longer be reported to the client
+	_ = json.NewEncoder(writer).Encode(value)
+}
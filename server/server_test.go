@@ -0,0 +1,233 @@
+// Package server
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+)
+
+// createTestGraph creates a graph in which A calls B over HTTP, B publishes to C over NATS,
+// and C makes a call of which the target is unknown. Its metrics are computed as when the graph is built.
+func createTestGraph() output.NodeGraph {
+	nodeA := &output.ServiceNode{ServiceName: "A", IsReferencing: true}
+	nodeB := &output.ServiceNode{ServiceName: "B", IsReferenced: true, IsReferencing: true}
+	nodeC := &output.ServiceNode{ServiceName: "C", IsReferenced: true, IsReferencing: true}
+	unknown := &output.ServiceNode{ServiceName: "UnknownService", IsUnknown: true, IsReferenced: true}
+
+	edge := func(source, target *output.ServiceNode, protocol, url string) *output.ConnectionEdge {
+		return &output.ConnectionEdge{
+			Call:   output.NetworkCall{Protocol: protocol, URL: url, Locations: []string{source.ServiceName + "/main.go:1"}},
+			Source: source,
+			Target: target,
+		}
+	}
+
+	graph := output.NodeGraph{
+		Nodes: []*output.ServiceNode{nodeC, nodeB, nodeA, unknown},
+		Edges: []*output.ConnectionEdge{
+			edge(nodeC, unknown, "HTTP", ""),
+			edge(nodeB, nodeC, "NATS", "CSubject"),
+			edge(nodeA, nodeB, "HTTP", "http://B:80/users"),
+		},
+	}
+	output.ComputeMetrics(graph)
+
+	return graph
+}
+
+// newTestServer creates a server of which the analysis returns the test graph, and counts its runs
+func newTestServer(t *testing.T) (*Server, *int) {
+	t.Helper()
+
+	runs := 0
+	server, err := New(func() (output.NodeGraph, error) {
+		runs++
+		return createTestGraph(), nil
+	})
+	assert.NoError(t, err)
+
+	return server, &runs
+}
+
+// request performs a request to the handler of the server and decodes the JSON response into value
+func request(t *testing.T, server *Server, method, target string, value interface{}) int {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), value))
+
+	return recorder.Code
+}
+
+func TestServices(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var services []output.ServiceNode
+	code := request(t, server, http.MethodGet, "/services", &services)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 4, len(services))
+	assert.Equal(t, "A", services[0].ServiceName)
+	assert.Equal(t, "UnknownService", services[3].ServiceName)
+	assert.True(t, services[3].IsUnknown)
+
+	// the metrics of the known services are included, with the transitive dependencies of A through B
+	assert.Equal(t, 1, services[0].Metrics.EfferentCoupling)
+	assert.Equal(t, []string{"B", "C"}, services[0].Metrics.TransitiveDependencies)
+	assert.Nil(t, services[3].Metrics)
+}
+
+func TestServiceDependencies(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var dependencies []output.ServiceCallList
+	code := request(t, server, http.MethodGet, "/services/A/dependencies", &dependencies)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, len(dependencies))
+	assert.Equal(t, "B", dependencies[0].Service)
+	assert.Equal(t, "http://B:80/users", dependencies[0].Calls[0].URL)
+}
+
+func TestServiceDependents(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var dependents []output.ServiceCallList
+	code := request(t, server, http.MethodGet, "/services/C/dependents", &dependents)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, len(dependents))
+	assert.Equal(t, "B", dependents[0].Service)
+	assert.Equal(t, "NATS", dependents[0].Calls[0].Protocol)
+
+	code = request(t, server, http.MethodGet, "/services/A/dependents", &dependents)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, dependents)
+}
+
+func TestServiceNotFound(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var response errorResponse
+	code := request(t, server, http.MethodGet, "/services/X/dependencies", &response)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "unknown service: X", response.Error)
+
+	code = request(t, server, http.MethodGet, "/services/A/calls", &response)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "unknown endpoint: /services/A/calls", response.Error)
+}
+
+func TestEdges(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var edges []Edge
+	code := request(t, server, http.MethodGet, "/edges", &edges)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"A", "B", "C"}, []string{edges[0].Source, edges[1].Source, edges[2].Source})
+
+	code = request(t, server, http.MethodGet, "/edges?protocol=nats", &edges)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []Edge{{
+		Source:      "B",
+		Target:      "C",
+		NetworkCall: output.NetworkCall{Protocol: "NATS", URL: "CSubject", Locations: []string{"B/main.go:1"}},
+	}}, edges)
+}
+
+func TestUnresolved(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var edges []Edge
+	code := request(t, server, http.MethodGet, "/unresolved", &edges)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, len(edges))
+	assert.Equal(t, "C", edges[0].Source)
+	assert.Equal(t, "UnknownService", edges[0].Target)
+}
+
+func TestCycles(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var report output.CycleReport
+	code := request(t, server, http.MethodGet, "/cycles", &report)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, report.Cycles)
+
+	// C starts calling A, which closes the cycle A -> B -> C over both HTTP and NATS
+	graph := createTestGraph()
+	nodeC, nodeA := graph.Nodes[0], graph.Nodes[2]
+	graph.Edges = append(graph.Edges, &output.ConnectionEdge{Call: output.NetworkCall{Protocol: "HTTP", URL: "http://A:80/"}, Source: nodeC, Target: nodeA})
+	server.analyse = func() (output.NodeGraph, error) {
+		return graph, nil
+	}
+	_, err := server.Refresh()
+	assert.NoError(t, err)
+
+	code = request(t, server, http.MethodGet, "/cycles", &report)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, len(report.Cycles))
+	assert.Equal(t, []string{"A", "B", "C"}, report.Cycles[0].Services)
+
+	code = request(t, server, http.MethodGet, "/cycles?protocols=sync", &report)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, report.Cycles)
+
+	var response errorResponse
+	code = request(t, server, http.MethodGet, "/cycles?protocols=grpc", &response)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid cycle protocols specified: grpc", response.Error)
+}
+
+func TestRefresh(t *testing.T) {
+	server, runs := newTestServer(t)
+
+	var response errorResponse
+	code := request(t, server, http.MethodGet, "/refresh", &response)
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	assert.Equal(t, 1, *runs)
+
+	var status Status
+	code = request(t, server, http.MethodPost, "/refresh", &status)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, *runs)
+	assert.Equal(t, 4, status.Services)
+	assert.Equal(t, 3, status.Edges)
+}
+
+func TestRefreshFailureKeepsGraph(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.analyse = func() (output.NodeGraph, error) {
+		return output.NodeGraph{}, errors.New("invalid project directory")
+	}
+
+	var response errorResponse
+	code := request(t, server, http.MethodPost, "/refresh", &response)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "the analysis failed: invalid project directory", response.Error)
+
+	var services []output.ServiceNode
+	request(t, server, http.MethodGet, "/services", &services)
+	assert.Equal(t, 4, len(services))
+}
+
+func TestNewFails(t *testing.T) {
+	_, err := New(func() (output.NodeGraph, error) {
+		return output.NodeGraph{}, errors.New("no services to analyse were found")
+	})
+
+	assert.EqualError(t, err, "no services to analyse were found")
+}
@@ -0,0 +1,124 @@
+// Package diagnostics collects the problems that are encountered during the stages of an analysis,
+// so that these can be reported instead of stopping the analysis
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package diagnostics
+
+import (
+	"errors"
+	"fmt"
+	"go/scanner"
+	"sync"
+)
+
+// Severity indicates how severe a Diagnostic is
+type Severity string
+
+const (
+	Warning Severity = "warning" // Warning means the result may be incomplete
+	Error   Severity = "error"   // Error means part of the project could not be analysed
+)
+
+// The stages in which diagnostics are recorded
+const (
+	StagePreprocessing = "preprocessing"
+	StageDiscovery     = "discovery"
+	StageCache         = "cache"
+	StageAnnotations   = "annotations"
+)
+
+// Diagnostic is a problem that was encountered during the analysis, but did not stop it
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Stage    string   `json:"stage"`
+	Service  string   `json:"service,omitempty"`
+	Position string   `json:"position,omitempty"` // Position is the file:line the diagnostic refers to, if any
+	Message  string   `json:"message"`
+}
+
+// String formats the diagnostic for printing
+func (diagnostic Diagnostic) String() string {
+	text := fmt.Sprintf("%s in %s", diagnostic.Severity, diagnostic.Stage)
+	if diagnostic.Service != "" {
+		text += fmt.Sprintf(" of service %s", diagnostic.Service)
+	}
+	if diagnostic.Position != "" {
+		text += fmt.Sprintf(" at %s", diagnostic.Position)
+	}
+
+	return fmt.Sprintf("%s: %s", text, diagnostic.Message)
+}
+
+// Collector records the diagnostics of a stage or service. It is safe for concurrent use.
+// A nil *Collector discards all diagnostics, which is useful in tests.
+type Collector struct {
+	mutex       sync.Mutex
+	diagnostics []Diagnostic
+}
+
+// NewCollector creates an empty Collector
+func NewCollector() *Collector {
+	return &Collector{diagnostics: make([]Diagnostic, 0)}
+}
+
+// Add records the diagnostic
+func (collector *Collector) Add(diagnostic Diagnostic) {
+	if collector == nil {
+		return
+	}
+
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	collector.diagnostics = append(collector.diagnostics, diagnostic)
+}
+
+// Warningf records a warning with a formatted message
+func (collector *Collector) Warningf(stage, service, position, format string, args ...interface{}) {
+	collector.Add(Diagnostic{
+		Severity: Warning,
+		Stage:    stage,
+		Service:  service,
+		Position: position,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Errorf records an error with a formatted message
+func (collector *Collector) Errorf(stage, service, position, format string, args ...interface{}) {
+	collector.Add(Diagnostic{
+		Severity: Error,
+		Stage:    stage,
+		Service:  service,
+		Position: position,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// FileError records an error about a file that could not be used, such as a file that cannot be parsed.
+// The position is taken from the (first) syntax error if there is one, or else is the path of the file.
+func (collector *Collector) FileError(stage, service, path string, err error) {
+	position, message := path, err.Error()
+
+	var errorList scanner.ErrorList
+	if errors.As(err, &errorList) && len(errorList) > 0 {
+		position = fmt.Sprintf("%s:%d", errorList[0].Pos.Filename, errorList[0].Pos.Line)
+		message = errorList[0].Msg
+		if len(errorList) > 1 {
+			message += fmt.Sprintf(" (and %d more errors)", len(errorList)-1)
+		}
+	}
+
+	collector.Errorf(stage, service, position, "%s", message)
+}
+
+// Diagnostics returns the recorded diagnostics, in the order in which they were recorded
+func (collector *Collector) Diagnostics() []Diagnostic {
+	if collector == nil {
+		return make([]Diagnostic, 0)
+	}
+
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	return append(make([]Diagnostic, 0, len(collector.diagnostics)), collector.diagnostics...)
+}
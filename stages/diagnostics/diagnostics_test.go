@@ -0,0 +1,75 @@
+// Package diagnostics
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+
+package diagnostics
+
+import (
+	"errors"
+	"go/parser"
+	"go/token"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector()
+	collector.Warningf(StageDiscovery, "service-1", "main.go:3", "%d calls could not be resolved", 2)
+	collector.Errorf(StagePreprocessing, "", "", "the servicecalls package cannot be read")
+
+	assert.Equal(t, []Diagnostic{
+		{Severity: Warning, Stage: StageDiscovery, Service: "service-1", Position: "main.go:3", Message: "2 calls could not be resolved"},
+		{Severity: Error, Stage: StagePreprocessing, Message: "the servicecalls package cannot be read"},
+	}, collector.Diagnostics())
+}
+
+func TestCollectorConcurrently(t *testing.T) {
+	collector := NewCollector()
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			collector.Warningf(StageDiscovery, "service-1", "", "warning")
+		}()
+	}
+	waitGroup.Wait()
+
+	assert.Equal(t, 10, len(collector.Diagnostics()))
+}
+
+func TestNilCollector(t *testing.T) {
+	var collector *Collector
+	collector.Errorf(StageDiscovery, "service-1", "", "discarded")
+
+	assert.Empty(t, collector.Diagnostics())
+}
+
+func TestFileError(t *testing.T) {
+	_, parseErr := parser.ParseFile(token.NewFileSet(), "svc/service-1/main.go", "package main\n\nfunc main( {\n}\n", 0)
+
+	collector := NewCollector()
+	collector.FileError(StageDiscovery, "service-1", "svc/service-1/main.go", parseErr)
+	collector.FileError(StageDiscovery, "service-1", "svc/service-1/missing.go", errors.New("file does not exist"))
+
+	diagnostics := collector.Diagnostics()
+	assert.Equal(t, "svc/service-1/main.go:3", diagnostics[0].Position)
+	assert.Contains(t, diagnostics[0].Message, "expected")
+	assert.Equal(t, Diagnostic{
+		Severity: Error,
+		Stage:    StageDiscovery,
+		Service:  "service-1",
+		Position: "svc/service-1/missing.go",
+		Message:  "file does not exist",
+	}, diagnostics[1])
+}
+
+func TestDiagnosticString(t *testing.T) {
+	diagnostic := Diagnostic{Severity: Error, Stage: StageDiscovery, Service: "service-1", Position: "main.go:3", Message: "expected ')'"}
+	assert.Equal(t, "error in discovery of service service-1 at main.go:3: expected ')'", diagnostic.String())
+
+	diagnostic = Diagnostic{Severity: Warning, Stage: StageCache, Message: "the cache is read-only"}
+	assert.Equal(t, "warning in cache: the cache is read-only", diagnostic.String())
+}
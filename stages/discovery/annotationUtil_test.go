@@ -58,6 +58,7 @@ func TestReplaceTargetsAnnotations(t *testing.T) {
 		MethodName:      "a1",
 		RequestLocation: "http://localhost:50/get",
 		IsResolved:      true,
+		IsAnnotated:     true,
 		ServiceName:     "c1",
 		TargetSvc:       "",
 		Trace: []callanalyzer.CallTargetTrace{
@@ -140,6 +141,7 @@ func TestResolveAnnotationClientUrl(t *testing.T) {
 		MethodName:      "a",
 		RequestLocation: "http://localhost:50/get",
 		IsResolved:      true,
+		IsAnnotated:     true,
 		ServiceName:     "c",
 		TargetSvc:       "",
 		Trace: []callanalyzer.CallTargetTrace{
@@ -176,6 +178,7 @@ func TestResolveAnnotationClientTargetSvc(t *testing.T) {
 		MethodName:      "a",
 		RequestLocation: "",
 		IsResolved:      true,
+		IsAnnotated:     true,
 		ServiceName:     "c",
 		TargetSvc:       "service2",
 		Trace: []callanalyzer.CallTargetTrace{
@@ -212,6 +215,7 @@ func TestResolveAnnotationClientBoth(t *testing.T) {
 		MethodName:      "a",
 		RequestLocation: "http://localhost:50/get",
 		IsResolved:      true,
+		IsAnnotated:     true,
 		ServiceName:     "c",
 		TargetSvc:       "service2",
 		Trace: []callanalyzer.CallTargetTrace{
@@ -248,6 +252,7 @@ func TestResolveAnnotationEndpointUrl(t *testing.T) {
 		MethodName:      "a",
 		RequestLocation: "http://localhost:50/get",
 		IsResolved:      true,
+		IsAnnotated:     true,
 		ServiceName:     "c",
 		TargetSvc:       "",
 		Trace: []callanalyzer.CallTargetTrace{
@@ -262,3 +267,121 @@ func TestResolveAnnotationEndpointUrl(t *testing.T) {
 
 	assert.Equal(t, expectedTarget, target)
 }
+
+func TestMarkPublicEndpoints(t *testing.T) {
+	newEndpoint := func(line string) *callanalyzer.CallTarget {
+		return &callanalyzer.CallTarget{
+			RequestLocation: "/ping",
+			IsResolved:      true,
+			ServiceName:     "c",
+			Trace:           []callanalyzer.CallTargetTrace{{FileName: "d", PositionInFile: line}},
+		}
+	}
+	endpoints := []*callanalyzer.CallTarget{newEndpoint("5"), newEndpoint("10"), newEndpoint("15")}
+
+	annotations := map[string]map[callanalyzer.Position]string{
+		"c": {
+			{Filename: "d", Line: 4}:  "public",
+			{Filename: "d", Line: 9}:  "endpoint url=/ping public=true",
+			{Filename: "d", Line: 14}: "endpoint url=/ping",
+		},
+	}
+
+	config := callanalyzer.DefaultConfigForFindingHTTPCalls()
+	config.SetAnnotations(annotations)
+
+	err := callanalyzer.MarkPublicEndpoints(endpoints, &config)
+	assert.Nil(t, err)
+	assert.True(t, endpoints[0].IsPublic)
+	assert.True(t, endpoints[1].IsPublic)
+	assert.False(t, endpoints[2].IsPublic)
+}
+
+func TestParseAnnotation(t *testing.T) {
+	annotation, err := callanalyzer.ParseAnnotation(`client url="http://users/v1?limit=10&q=a b" targetSvc=users`)
+	assert.Nil(t, err)
+	assert.Equal(t, "client", annotation.Type)
+	assert.Equal(t, map[string]string{"url": "http://users/v1?limit=10&q=a b", "targetSvc": "users"}, annotation.Params)
+
+	annotation, err = callanalyzer.ParseAnnotation("endpoint url=/search?q=1")
+	assert.Nil(t, err)
+	assert.Equal(t, "/search?q=1", annotation.Params["url"])
+
+	annotation, err = callanalyzer.ParseAnnotation("client-wrapper urlArg=1 targetSvc=users")
+	assert.Nil(t, err)
+	assert.Equal(t, "client-wrapper", annotation.Type)
+	assert.Equal(t, map[string]string{"urlArg": "1", "targetSvc": "users"}, annotation.Params)
+
+	annotation, err = callanalyzer.ParseAnnotation("host http://users:8080")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://users:8080"}, annotation.Args)
+
+	tests := []struct {
+		value string
+		err   string
+	}{
+		{value: "", err: "the annotation has no type"},
+		{value: "clinet url=/users", err: `unknown annotation type "clinet", expected one of: client, client-wrapper, depends, endpoint, host, ignore, public, publish, subscribe`},
+		{value: "client targetsvc=users", err: "unknown key targetsvc of the client annotation, did you mean targetSvc?"},
+		{value: "client uri=/users", err: "unknown key uri of the client annotation, expected one of: url, targetSvc"},
+		{value: "client url=/a url=/b", err: "the key url is given more than once"},
+		{value: "client url=", err: "the key url has no value"},
+		{value: `client url="/users`, err: "the quoted value of url is not terminated"},
+		{value: "client http://users/", err: `the value "http://users/" has no key, expected key=value`},
+		{value: "client", err: "the client annotation needs a url or targetSvc"},
+		{value: "endpoint url=/ping public=yes", err: `the value of public must be true or false, not "yes"`},
+		{value: "public now=true", err: "unknown key now, the public annotation has no parameters"},
+		{value: "host", err: "the host annotation needs a single URL"},
+		{value: "depends protocol=gRPC", err: "the depends annotation needs a target or url"},
+		{value: "client-wrapper", err: "the client-wrapper annotation needs a urlArg or targetSvc"},
+		{value: "client-wrapper urlArg=path", err: `the value of urlArg must be the index of a parameter, not "path"`},
+		{value: "publish protocol=Kafka", err: "the publish annotation needs a subject"},
+		{value: "subscribe topic=orders", err: "unknown key topic of the subscribe annotation, expected one of: subject, protocol"},
+		{value: "ignore scope=function", err: `the scope of an ignore annotation can only be file, not "function"`},
+	}
+
+	for _, test := range tests {
+		_, err := callanalyzer.ParseAnnotation(test.value)
+		assert.EqualError(t, err, test.err, test.value)
+	}
+}
+
+func TestResolveAnnotationInvalid(t *testing.T) {
+	target := &callanalyzer.CallTarget{MethodName: "a", ServiceName: "c"}
+
+	callanalyzer.ResolveAnnotation("client targetsvc=users", target)
+
+	assert.False(t, target.IsResolved)
+	assert.False(t, target.IsAnnotated)
+	assert.Equal(t, "", target.TargetSvc)
+}
+
+func TestAnnotationString(t *testing.T) {
+	annotation := callanalyzer.Annotation{
+		Type:   "client",
+		Params: map[string]string{"targetSvc": "users", "url": "http://users/?q=a b"},
+	}
+
+	assert.Equal(t, `client url="http://users/?q=a b" targetSvc=users`, annotation.String())
+
+	parsed, err := callanalyzer.ParseAnnotation(annotation.String())
+	assert.Nil(t, err)
+	assert.Equal(t, annotation.Params, parsed.Params)
+}
+
+func TestSuppressionReason(t *testing.T) {
+	target := &callanalyzer.CallTarget{ServiceName: "orders", RequestLocation: "http://users:8080/healthz"}
+
+	// without a configuration, nothing is suppressed
+	var config *callanalyzer.AnalyserConfig
+	assert.Equal(t, "", config.SuppressionReason(target, callanalyzer.CallPath{Functions: []string{"main", "userDB.Update"}}))
+
+	config = &callanalyzer.AnalyserConfig{}
+	config.AddExclusion(callanalyzer.Exclusion{Service: "orders", URL: "/healthz"})
+	config.AddExclusion(callanalyzer.Exclusion{Package: "example.com/shop/mocks", Reason: "a test double"})
+
+	assert.Equal(t, "excluded by service orders, url /healthz", config.SuppressionReason(target, callanalyzer.CallPath{}))
+	assert.Equal(t, "", config.SuppressionReason(&callanalyzer.CallTarget{ServiceName: "users", RequestLocation: "/healthz/x"}, callanalyzer.CallPath{}))
+	assert.Equal(t, "a test double", config.SuppressionReason(&callanalyzer.CallTarget{ServiceName: "users"},
+		callanalyzer.CallPath{Packages: []string{"example.com/shop", "example.com/shop/mocks"}}))
+}
@@ -13,8 +13,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/fatih/color"
-
 	"golang.org/x/tools/go/ssa"
 )
 
@@ -31,9 +29,15 @@ type CallTarget struct {
 	PackageName     string            // PackageName is the name of the package the method belongs to
 	MethodName      string            // MethodName is the name of the call (i.e. name of function or some other target)
 	RequestLocation string            // RequestLocation is the URL of the entity
+	PartialLocation string            // PartialLocation is the URL of an unresolved entity, with the reasons why parts were not resolved
 	IsResolved      bool              // IsResolved defines a flag describing whether the RequestLocation was resolved
 	ServiceName     string            // ServiceName is the name of the service in which the call is made
 	TargetSvc       string            // TargetSvc is the targeted service (in case the CallTarget is a client)
+	IsPublic        bool              // IsPublic marks an endpoint that is meant for consumers outside the project
+	IsDeclared      bool              // IsDeclared marks a dependency that is declared rather than discovered in the code
+	IsAnnotated     bool              // IsAnnotated marks a target that was resolved using an annotation
+	Protocol        string            // Protocol is the protocol of a declared dependency, HTTP if it is empty
+	Suppressed      string            // Suppressed is the reason that the target is left out of the dependency graph, if it is
 	Trace           []CallTargetTrace // Trace defines a stack trace for the call
 }
 
@@ -53,6 +57,9 @@ func (trace *CallTarget) TraceAsStringArray() []string {
 type SubstitutionConfig struct {
 	substitutionCalls map[string]InterestingCall // substitutionCalls defines a map of function signature to call
 	serviceEnv        map[string]string          // serviceEnv holds the mapping of environment names to values
+	serviceFlags      map[string]string          // serviceFlags holds the values of the command-line flags of the service
+	ignoreList        map[string]bool            // ignoreList holds the packages of which the functions are not resolved
+	state             *substitutionState         // state is shared while resolving the parameters of a single call
 }
 
 // TargetsCollection holds the output structures that are to be returned by the
@@ -95,15 +102,14 @@ func getCallInformation(frame *Frame, fn *ssa.Function) *CallTarget {
 	functionName, packageName := getFunctionQualifiers(fn)
 	callTarget := defaultCallTarget(packageName, functionName)
 
-	callTarget.ServiceName = frame.pkg.String()[strings.LastIndex(frame.pkg.String(), "/")+1:]
+	callTarget.ServiceName = frame.serviceName
 
 	// add trace
 	for _, tracedCall := range frame.trace {
 		filePath, position := getPositionFromPos(tracedCall.Pos(), frame.pkg.Prog)
 
 		newTrace := CallTargetTrace{
-			// split package name and take the last item to get the service name
-			FileName:       filePath[strings.LastIndex(filePath, fmt.Sprintf("%s%s%s", string(os.PathSeparator), callTarget.ServiceName, string(os.PathSeparator)))+1:],
+			FileName:       ServiceFileName(filePath, frame.serviceDir, callTarget.ServiceName),
 			PositionInFile: position,
 		}
 
@@ -131,6 +137,7 @@ func analyzeCallToFunction(call *ssa.CallCommon, fn *ssa.Function, frame *Frame,
 	// copy trace and append current call
 	copy(newFrame.trace, frame.trace)
 	newFrame.trace = append(newFrame.trace, call)
+	newFrame.functions = append(append(make([]*ssa.Function, 0, len(frame.functions)+1), frame.functions...), fn)
 
 	// define offset when function was resolved to an invocation and the first parameter does not exist
 	// this is the case for functions like `func (o obj) name (arg string) {}`
@@ -144,9 +151,13 @@ func analyzeCallToFunction(call *ssa.CallCommon, fn *ssa.Function, frame *Frame,
 	// Keep a reference to the parent frame
 	newFrame.parent = frame
 
-	_, isInterestingClient := config.interestingCallsClient[qualifiedFunctionNameOfTarget]
+	interestingClient, isInterestingClient := config.interestingCallsClient[qualifiedFunctionNameOfTarget]
+	if !isInterestingClient {
+		// a function annotated as client wrapper becomes interesting, so its URL is resolved at each caller
+		interestingClient, isInterestingClient = frame.wrappers.interestingCall(call, fn, frame)
+	}
 	if isInterestingClient {
-		handleInterestingClientCall(call, fn, config, &newFrame)
+		handleInterestingClientCall(call, fn, interestingClient, config, &newFrame)
 		wasInteresting = true
 	}
 
@@ -207,12 +218,10 @@ func getHostFromAnnotation(call *ssa.CallCommon, frame *Frame, config *AnalyserC
 
 	annotations := config.annotations[serviceName]
 	// look for annotated hostname
-	for _, annotation := range annotations {
-		if strings.HasPrefix(annotation, "host") {
-			// if annotation is incorrectly formatted (eg. "hostsomething") the split will return ""
-			// and the url will not be substituted from annotation
-			host := strings.Join(strings.Split(annotation, "host ")[1:], "")
-			resolvedURL, err := url.Parse(host)
+	for _, ann := range annotations {
+		annotation, err := ParseAnnotation(ann)
+		if err == nil && annotation.Type == "host" {
+			resolvedURL, err := url.Parse(annotation.Args[0])
 			if err != nil {
 				return target.RequestLocation
 			}
@@ -259,17 +268,21 @@ func handleInterestingServerCall(call *ssa.CallCommon, fn *ssa.Function, config
 			// Since the environment can vary on a per-service basis,
 			// a substConfig is created for the specific service
 			substitutionConfig := getSubstConfig(config, callTarget.ServiceName)
-			variables, callTarget.IsResolved = resolveParameters(call.Args, interestingStuffServer.interestingArgs, frame, substitutionConfig)
+			var partial []string
+			variables, partial, callTarget.IsResolved = resolveParameters(call.Args, interestingStuffServer.interestingArgs, frame, substitutionConfig)
 			// TODO: parse the url
 			callTarget.RequestLocation = strings.Join(variables, "")
+			if !callTarget.IsResolved {
+				callTarget.PartialLocation = strings.Join(partial, "")
+			}
 		}
 	}
 
 	callTarget.RequestLocation = getHostFromAnnotation(call, frame, config, callTarget)
+	callTarget.Suppressed = config.SuppressionReason(callTarget, callPathOf(frame, config.annotations[callTarget.ServiceName]))
 
 	if !callTarget.IsResolved && config.verbose {
-		color.Yellow("Could not resolve variable(s) for call to " + qualifiedFunctionNameOfTarget)
-		PrintTraceToCall(frame, config)
+		reportUnresolvedCall(qualifiedFunctionNameOfTarget, frame, config)
 	}
 
 	// Additional information about the call
@@ -282,6 +295,9 @@ func getSubstConfig(config *AnalyserConfig, service string) SubstitutionConfig {
 	return SubstitutionConfig{
 		config.substitutionCalls,
 		config.environment[service],
+		config.flags[service],
+		config.ignoreList,
+		newSubstitutionState(),
 	}
 }
 
@@ -300,9 +316,8 @@ func defaultCallTarget(packageName, functionName string) *CallTarget {
 // handleInterestingServerCall collects the information about a supplied http client call
 // and adds this information to the targetClient data structure. If possible, also calls the function to resolve
 // the parameters of the function call.
-func handleInterestingClientCall(call *ssa.CallCommon, fn *ssa.Function, config *AnalyserConfig, frame *Frame) {
+func handleInterestingClientCall(call *ssa.CallCommon, fn *ssa.Function, interestingStuffClient InterestingCall, config *AnalyserConfig, frame *Frame) {
 	qualifiedFunctionNameOfTarget, _ := getFunctionQualifiers(fn)
-	interestingStuffClient := config.interestingCallsClient[qualifiedFunctionNameOfTarget]
 
 	if interestingStuffClient.action != Output {
 		return
@@ -318,14 +333,27 @@ func handleInterestingClientCall(call *ssa.CallCommon, fn *ssa.Function, config
 		// Since the environment can vary on a per-service basis,
 		// a substConfig is created for the specific service
 		substitutionConfig := getSubstConfig(config, callTarget.ServiceName)
-		variables, callTarget.IsResolved = resolveParameters(call.Args, interestingStuffClient.interestingArgs, frame, substitutionConfig)
+		var partial []string
+		variables, partial, callTarget.IsResolved = resolveParameters(call.Args, interestingStuffClient.interestingArgs, frame, substitutionConfig)
 		// TODO: parse the url
 		callTarget.RequestLocation = strings.Join(variables, "")
+		if !callTarget.IsResolved {
+			callTarget.PartialLocation = strings.Join(partial, "")
+		}
+	}
+	if interestingStuffClient.targetSvc != "" {
+		// the target of an annotated client wrapper is known, even when its URL is not
+		if !callTarget.IsResolved {
+			callTarget.RequestLocation = ""
+		}
+		callTarget.TargetSvc = interestingStuffClient.targetSvc
+		callTarget.IsResolved = true
+		callTarget.IsAnnotated = true
 	}
+	callTarget.Suppressed = config.SuppressionReason(callTarget, callPathOf(frame, config.annotations[callTarget.ServiceName]))
 
 	if !callTarget.IsResolved && config.verbose {
-		color.Yellow("Could not resolve variable(s) for call to " + qualifiedFunctionNameOfTarget)
-		PrintTraceToCall(frame, config)
+		reportUnresolvedCall(qualifiedFunctionNameOfTarget, frame, config)
 	}
 
 	frame.targetsCollection.clientTargets = append(frame.targetsCollection.clientTargets, callTarget)
@@ -399,16 +427,22 @@ func AnalysePackageCalls(pkg *ssa.Package, config *AnalyserConfig) ([]*CallTarge
 		return nil, nil, fmt.Errorf("no main function found in package %v", pkg)
 	}
 
+	serviceName := config.serviceNameOf(pkg)
 	baseFrame := Frame{
-		trace: make([]*ssa.CallCommon, 0),
+		trace:     make([]*ssa.CallCommon, 0),
+		functions: []*ssa.Function{initFunction},
 		// Reference to the final list of all _targets of the entire package
-		pkg:     pkg,
-		visited: make(map[*ssa.CallCommon]bool),
-		params:  make(map[*ssa.Parameter]*ssa.Value),
-		globals: make(map[*ssa.Global]*ssa.Value),
+		pkg:            pkg,
+		modulePackages: modulePackages(pkg),
+		serviceName:    serviceName,
+		serviceDir:     config.serviceDirs[serviceName],
+		visited:        make(map[*ssa.CallCommon]bool),
+		params:         make(map[*ssa.Parameter]*ssa.Value),
+		globals:        make(map[*ssa.Global]*ssa.Value),
 		// for the init function we should only pass once
 		// as we don't expect to find a functional call in the setup
 		singlePass: true,
+		wrappers:   newClientWrappers(config.annotations[serviceName]),
 		// targetsCollection is a pointer to the global target collection.
 		targetsCollection: &TargetsCollection{
 			make([]*CallTarget, 0),
@@ -429,6 +463,7 @@ func AnalysePackageCalls(pkg *ssa.Package, config *AnalyserConfig) ([]*CallTarge
 	// rest visited
 	baseFrame.visited = make(map[*ssa.CallCommon]bool)
 	baseFrame.singlePass = false
+	baseFrame.functions = []*ssa.Function{mainFunction}
 
 	// Visit each of the block of the main function
 	visitBlocks(mainFunction.Blocks, &baseFrame, config)
@@ -1,5 +1,13 @@
 package callanalyzer
 
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
 // DiscoveryAction indicates what to do when encountering
 // a certain call. Used in interestingCalls
 type DiscoveryAction int64
@@ -7,6 +15,17 @@ type DiscoveryAction int64
 const (
 	Output DiscoveryAction = iota
 	Substitute
+	// SubstituteConfigKey substitutes a call that reads a configuration key, such as viper.GetString("users.url"),
+	// with the environment variable of the key (USERS_URL) or the default that is set for the key
+	SubstituteConfigKey
+	// SubstituteFlag substitutes a call that defines a command-line flag, such as flag.String("users-url", "http://users", ""),
+	// with the value of the flag, which is its default unless it is set for the service. The interesting args are
+	// the name and the default value.
+	SubstituteFlag
+	// SubstituteFlagVar binds a command-line flag to a variable, such as flag.StringVar(&usersURL, "users-url", "http://users", ""),
+	// so reading the variable is substituted with the value of the flag. The interesting args are the pointer to the
+	// variable, the name and the default value.
+	SubstituteFlagVar
 )
 
 // defaultMaxTraversalDepth is the default max traversal depth for the analyser
@@ -21,6 +40,7 @@ const defaultMaxTraceDepth = 8
 type InterestingCall struct {
 	action          DiscoveryAction
 	interestingArgs []int
+	targetSvc       string // targetSvc is the service that the calls target, as annotated for a client wrapper
 }
 
 // Position holds information about the filename and line of an object of interest,
@@ -44,9 +64,21 @@ type AnalyserConfig struct {
 	// environment: map[service name]map[variable name]value
 	environment map[string]map[string]string
 
+	// flags: map[service name]map[flag name]value, which override the defaults of the flags
+	flags map[string]map[string]string
+
 	// annotations: map of discovered annotations
 	annotations map[string]map[Position]string
 
+	// serviceNames: map[directory of a main package]service name
+	serviceNames map[string]string
+
+	// serviceDirs: map[service name]directory of the service, from which the files of calls are named
+	serviceDirs map[string]string
+
+	// exclusions leave the calls and endpoints that match them out of the dependency graph
+	exclusions []Exclusion
+
 	// ignoreList is a set of function names to not recurse into
 	ignoreList        map[string]bool
 	verbose           bool
@@ -63,10 +95,85 @@ func (a *AnalyserConfig) SetEnv(envMap map[string]map[string]string) {
 	a.environment = envMap
 }
 
+// SetFlags sets the values of the command-line flags of each service, which override the defaults in the code
+func (a *AnalyserConfig) SetFlags(flags map[string]map[string]string) {
+	a.flags = flags
+}
+
 func (a *AnalyserConfig) SetAnnotations(annotations map[string]map[Position]string) {
 	a.annotations = annotations
 }
 
+// SetServiceNames sets the names of the services, keyed by the directories of their main packages.
+// Services of which the directory is not set are named after the last element of the path of their main package.
+func (a *AnalyserConfig) SetServiceNames(serviceNames map[string]string) {
+	a.serviceNames = serviceNames
+}
+
+// SetServiceDirectories sets the directories of the services, keyed by their names, so the files in which calls are made
+// are reported relative to them
+func (a *AnalyserConfig) SetServiceDirectories(serviceDirs map[string]string) {
+	a.serviceDirs = serviceDirs
+}
+
+// ServiceDirectory returns the directory of the service, or an empty string if it is not known
+func (a *AnalyserConfig) ServiceDirectory(serviceName string) string {
+	if a == nil {
+		return ""
+	}
+
+	return a.serviceDirs[serviceName]
+}
+
+// serviceNameOf returns the name of the service of which the package is the main package
+func (a *AnalyserConfig) serviceNameOf(pkg *ssa.Package) string {
+	if mainFunction := pkg.Func("main"); mainFunction != nil && mainFunction.Pos().IsValid() {
+		dir := filepath.Dir(pkg.Prog.Fset.Position(mainFunction.Pos()).Filename)
+		if name, ok := a.serviceNames[dir]; ok {
+			return name
+		}
+	}
+
+	return pkg.String()[strings.LastIndex(pkg.String(), "/")+1:]
+}
+
+// AddInterestingClientCall makes the analyser output the calls to the function with the qualified name,
+// such as "(*net/http.Client).Get", of which the arguments at the given indices hold the target
+func (a *AnalyserConfig) AddInterestingClientCall(qualifiedName string, targetArgs []int) {
+	a.interestingCallsClient[qualifiedName] = InterestingCall{action: Output, interestingArgs: targetArgs}
+}
+
+// AddInterestingServerCall makes the analyser output the calls to the function with the qualified name,
+// such as "net/http.HandleFunc", of which the arguments at the given indices hold the endpoint
+func (a *AnalyserConfig) AddInterestingServerCall(qualifiedName string, endpointArgs []int) {
+	a.interestingCallsServer[qualifiedName] = InterestingCall{action: Output, interestingArgs: endpointArgs}
+}
+
+// AddIgnoredPackage makes the analyser not recurse into the functions of the package
+func (a *AnalyserConfig) AddIgnoredPackage(pkg string) {
+	a.ignoreList[pkg] = true
+}
+
+// SetMaxTraversalDepth is a setter for maxTraversalDepth
+func (a *AnalyserConfig) SetMaxTraversalDepth(depth int) {
+	a.maxTraversalDepth = depth
+}
+
+// Fingerprint returns a description of the configuration that changes whenever the behaviour of the analyser changes.
+// The environment, flags, annotations, service names and directories and verbosity are left out, as these do not depend on the configuration itself.
+func (a *AnalyserConfig) Fingerprint() string {
+	config := *a
+	config.environment = nil
+	config.flags = nil
+	config.annotations = nil
+	config.serviceNames = nil
+	config.serviceDirs = nil
+	config.verbose = false
+
+	// maps are printed in key order, so the fingerprint is stable
+	return fmt.Sprintf("%+v", config)
+}
+
 // DefaultConfigForFindingHTTPCalls returns the default config
 // for locating calls
 func DefaultConfigForFindingHTTPCalls() AnalyserConfig {
@@ -98,13 +205,30 @@ func DefaultConfigForFindingHTTPCalls() AnalyserConfig {
 		},
 
 		substitutionCalls: map[string]InterestingCall{
-			"os.Getenv": {action: Substitute, interestingArgs: []int{0}}, // TODO: implement env var substitution
+			"os.Getenv":                                 {action: Substitute, interestingArgs: []int{0}},
+			"os.LookupEnv":                              {action: Substitute, interestingArgs: []int{0}},
+			"github.com/spf13/viper.GetString":          {action: SubstituteConfigKey, interestingArgs: []int{0}},
+			"(*github.com/spf13/viper.Viper).GetString": {action: SubstituteConfigKey, interestingArgs: []int{1}},
+
+			"flag.String":                                  {action: SubstituteFlag, interestingArgs: []int{0, 1}},
+			"(*flag.FlagSet).String":                       {action: SubstituteFlag, interestingArgs: []int{1, 2}},
+			"flag.StringVar":                               {action: SubstituteFlagVar, interestingArgs: []int{0, 1, 2}},
+			"(*flag.FlagSet).StringVar":                    {action: SubstituteFlagVar, interestingArgs: []int{1, 2, 3}},
+			"github.com/spf13/pflag.String":                {action: SubstituteFlag, interestingArgs: []int{0, 1}},
+			"github.com/spf13/pflag.StringP":               {action: SubstituteFlag, interestingArgs: []int{0, 2}},
+			"(*github.com/spf13/pflag.FlagSet).String":     {action: SubstituteFlag, interestingArgs: []int{1, 2}},
+			"(*github.com/spf13/pflag.FlagSet).StringP":    {action: SubstituteFlag, interestingArgs: []int{1, 3}},
+			"github.com/spf13/pflag.StringVar":             {action: SubstituteFlagVar, interestingArgs: []int{0, 1, 2}},
+			"github.com/spf13/pflag.StringVarP":            {action: SubstituteFlagVar, interestingArgs: []int{0, 1, 3}},
+			"(*github.com/spf13/pflag.FlagSet).StringVar":  {action: SubstituteFlagVar, interestingArgs: []int{1, 2, 3}},
+			"(*github.com/spf13/pflag.FlagSet).StringVarP": {action: SubstituteFlagVar, interestingArgs: []int{1, 2, 4}},
 		},
 
 		maxTraversalDepth: defaultMaxTraversalDepth,
 		maxTraceDepth:     defaultMaxTraceDepth,
 		verbose:           false,
 
+		exclusions: make([]Exclusion, 0),
 		ignoreList: map[string]bool{
 			"fmt":                  true,
 			"reflect":              true,
@@ -0,0 +1,250 @@
+/*
+Package callanalyzer defines call scanning methods
+Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+*/
+
+package callanalyzer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Annotation is a parsed "//netdep:<type> key=value ..." comment. Values may be double-quoted,
+// so they can hold spaces, and hold everything after the first = of their parameter otherwise.
+type Annotation struct {
+	Type   string
+	Params map[string]string
+	Args   []string // Args are the values without a key, such as the URL of a host annotation
+}
+
+// annotationKeys are the keys of the parameters of each type of annotation
+var annotationKeys = map[string][]string{
+	"client":         {"url", "targetSvc"},
+	"client-wrapper": {"urlArg", "targetSvc"},
+	"endpoint":       {"url", "public"},
+	"public":         {},
+	"host":           {},
+	"depends":        {"target", "protocol", "url"},
+	"ignore":         {"scope", "reason"},
+	"publish":        {"subject", "protocol"},
+	"subscribe":      {"subject", "protocol"},
+}
+
+// ParseAnnotation parses the value of an annotation, which is the text after "//netdep:",
+// and checks that its type, keys and values are valid
+func ParseAnnotation(value string) (Annotation, error) {
+	annotation := Annotation{Params: make(map[string]string)}
+
+	tokens, err := tokenizeAnnotation(value)
+	if err != nil {
+		return annotation, err
+	}
+	if len(tokens) == 0 || tokens[0].hasKey {
+		return annotation, fmt.Errorf("the annotation has no type")
+	}
+
+	annotation.Type = tokens[0].value
+	keys, ok := annotationKeys[annotation.Type]
+	if !ok {
+		return annotation, fmt.Errorf("unknown annotation type %q, expected one of: %s", annotation.Type, strings.Join(annotationTypes(), ", "))
+	}
+
+	for _, param := range tokens[1:] {
+		if !param.hasKey {
+			annotation.Args = append(annotation.Args, param.value)
+			continue
+		}
+
+		if !containsString(keys, param.key) {
+			return annotation, unknownKeyError(annotation.Type, param.key, keys)
+		}
+		if _, exists := annotation.Params[param.key]; exists {
+			return annotation, fmt.Errorf("the key %s is given more than once", param.key)
+		}
+		if param.value == "" {
+			return annotation, fmt.Errorf("the key %s has no value", param.key)
+		}
+		annotation.Params[param.key] = param.value
+	}
+
+	return annotation, annotation.validate()
+}
+
+// String formats the annotation as the text after "//netdep:", quoting the values that ParseAnnotation
+// would not read back as they are
+func (annotation Annotation) String() string {
+	parts := []string{annotation.Type}
+
+	format := func(value string) string {
+		if value == "" || strings.HasPrefix(value, `"`) || strings.IndexFunc(value, unicode.IsSpace) >= 0 {
+			return strconv.Quote(value)
+		}
+		return value
+	}
+
+	for _, key := range annotationKeys[annotation.Type] {
+		if value, ok := annotation.Params[key]; ok {
+			parts = append(parts, key+"="+format(value))
+		}
+	}
+	for _, arg := range annotation.Args {
+		parts = append(parts, format(arg))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// validate checks that the annotation has the parameters that its type requires
+func (annotation Annotation) validate() error {
+	if annotation.Type == "host" {
+		if len(annotation.Args) != 1 {
+			return fmt.Errorf("the host annotation needs a single URL")
+		}
+		return nil
+	}
+	if len(annotation.Args) > 0 {
+		return fmt.Errorf("the value %q has no key, expected key=value", annotation.Args[0])
+	}
+
+	switch annotation.Type {
+	case "client":
+		if annotation.Params["url"] == "" && annotation.Params["targetSvc"] == "" {
+			return fmt.Errorf("the client annotation needs a url or targetSvc")
+		}
+	case "client-wrapper":
+		if urlArg, ok := annotation.Params["urlArg"]; ok {
+			if index, err := strconv.Atoi(urlArg); err != nil || index < 0 {
+				return fmt.Errorf("the value of urlArg must be the index of a parameter, not %q", urlArg)
+			}
+		} else if annotation.Params["targetSvc"] == "" {
+			return fmt.Errorf("the client-wrapper annotation needs a urlArg or targetSvc")
+		}
+	case "endpoint":
+		if public, ok := annotation.Params["public"]; ok && public != "true" && public != "false" {
+			return fmt.Errorf("the value of public must be true or false, not %q", public)
+		}
+		if annotation.Params["url"] == "" && annotation.Params["public"] == "" {
+			return fmt.Errorf("the endpoint annotation needs a url")
+		}
+	case "depends":
+		if annotation.Params["target"] == "" && annotation.Params["url"] == "" {
+			return fmt.Errorf("the depends annotation needs a target or url")
+		}
+	case "publish", "subscribe":
+		if annotation.Params["subject"] == "" {
+			return fmt.Errorf("the %s annotation needs a subject", annotation.Type)
+		}
+	case "ignore":
+		// the line or function that is ignored follows from the position of the annotation
+		if scope, ok := annotation.Params["scope"]; ok && scope != "file" {
+			return fmt.Errorf("the scope of an ignore annotation can only be file, not %q", scope)
+		}
+	}
+
+	return nil
+}
+
+// annotationToken is a key=value parameter, or a value without a key
+type annotationToken struct {
+	key    string
+	value  string
+	hasKey bool
+}
+
+// tokenizeAnnotation splits the annotation into its whitespace-separated tokens, unquoting quoted values
+func tokenizeAnnotation(value string) ([]annotationToken, error) {
+	tokens := make([]annotationToken, 0)
+
+	rest := strings.TrimSpace(value)
+	for rest != "" {
+		token := annotationToken{}
+
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+		// a value without a key, such as a URL, may hold a = as well
+		if separator := strings.Index(rest[:end], "="); separator >= 0 && isAnnotationKey(rest[:separator]) {
+			token.key = rest[:separator]
+			token.hasKey = true
+			rest = rest[separator+1:]
+		} else if separator == 0 {
+			return nil, fmt.Errorf("a value has no key, expected key=value")
+		}
+
+		if strings.HasPrefix(rest, `"`) {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, fmt.Errorf("the quoted value of %s is not terminated", token.key)
+			}
+			token.value, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+			if rest != "" && !unicode.IsSpace(rune(rest[0])) {
+				return nil, fmt.Errorf("the quoted value of %s is followed by %q", token.key, strings.Fields(rest)[0])
+			}
+		} else {
+			end = strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			token.value = rest[:end]
+			rest = rest[end:]
+		}
+
+		tokens = append(tokens, token)
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	}
+
+	return tokens, nil
+}
+
+// isAnnotationKey checks whether the text can be the key of a parameter, which consists of letters, digits, - and _
+func isAnnotationKey(text string) bool {
+	for _, char := range text {
+		if !unicode.IsLetter(char) && !unicode.IsDigit(char) && char != '-' && char != '_' {
+			return false
+		}
+	}
+
+	return text != ""
+}
+
+// unknownKeyError describes a key that the type of annotation does not have, suggesting the key that was meant
+func unknownKeyError(annType, key string, keys []string) error {
+	for _, known := range keys {
+		if strings.EqualFold(known, key) {
+			return fmt.Errorf("unknown key %s of the %s annotation, did you mean %s?", key, annType, known)
+		}
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("unknown key %s, the %s annotation has no parameters", key, annType)
+	}
+	return fmt.Errorf("unknown key %s of the %s annotation, expected one of: %s", key, annType, strings.Join(keys, ", "))
+}
+
+// annotationTypes returns the types of annotations in alphabetical order
+func annotationTypes() []string {
+	types := make([]string, 0, len(annotationKeys))
+	for annType := range annotationKeys {
+		types = append(types, annType)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// containsString checks whether the list holds the value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
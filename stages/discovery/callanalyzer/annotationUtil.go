@@ -6,10 +6,13 @@ Copyright © 2022 TW Group 13C, Weave BV, TU Delft
 package callanalyzer
 
 import (
+	"sort"
 	"strconv"
-	"strings"
 )
 
+// DeclaredMethodName is the method name of the targets of declared dependencies, which have no call site
+const DeclaredMethodName = "netdep:depends"
+
 // ReplaceTargetsAnnotations replaces each unresolved callanalyzer.CallTarget with new a new target containing data
 // obtained from the annotations (if they exist).
 func ReplaceTargetsAnnotations(callTargets *[]*CallTarget, config *AnalyserConfig) error {
@@ -31,39 +34,138 @@ func ReplaceTargetsAnnotations(callTargets *[]*CallTarget, config *AnalyserConfi
 			if ann, ex := config.annotations[callTarget.ServiceName][pos]; ex {
 				ResolveAnnotation(ann, callTarget)
 			}
+			// the exclusions of the URL are matched against the URL of the annotation
+			if callTarget.IsAnnotated && callTarget.Suppressed == "" {
+				callTarget.Suppressed = config.SuppressionReason(callTarget, CallPath{})
+			}
 		}
 	}
 	return nil
 }
 
+// MarkPublicEndpoints sets IsPublic for each endpoint that is annotated as public, either with
+// "//netdep:public" or with "//netdep:endpoint ... public=true".
+func MarkPublicEndpoints(endpoints []*CallTarget, config *AnalyserConfig) error {
+	if config == nil || config.annotations == nil {
+		return nil
+	}
+
+	for _, endpoint := range endpoints {
+		if len(endpoint.Trace) == 0 {
+			continue
+		}
+
+		line, err := strconv.Atoi(endpoint.Trace[0].PositionInFile)
+		if err != nil {
+			return err
+		}
+		pos := Position{
+			Filename: endpoint.Trace[0].FileName,
+			Line:     line - 1,
+		}
+
+		if ann, ex := config.annotations[endpoint.ServiceName][pos]; ex && isPublicAnnotation(ann) {
+			endpoint.IsPublic = true
+		}
+	}
+	return nil
+}
+
+// isPublicAnnotation checks whether the annotation value marks an endpoint as public
+func isPublicAnnotation(ann string) bool {
+	annotation, err := ParseAnnotation(ann)
+	if err != nil {
+		return false
+	}
+
+	return annotation.Type == "public" || annotation.Type == "endpoint" && annotation.Params["public"] == "true"
+}
+
+// DeclaredDependencies returns a client target for each "//netdep:depends target=... protocol=... url=..." annotation,
+// which declares a dependency of which the call cannot be discovered, such as one made by a generated client.
+// Annotations that cannot be parsed are left out. The targets are ordered by service and position.
+func DeclaredDependencies(annotations map[string]map[Position]string) []*CallTarget {
+	targets := make([]*CallTarget, 0)
+
+	for serviceName, serviceAnnotations := range annotations {
+		for pos, ann := range serviceAnnotations {
+			annotation, err := ParseAnnotation(ann)
+			if err != nil || annotation.Type != "depends" {
+				continue
+			}
+
+			params := annotation.Params
+
+			trace := []CallTargetTrace{{FileName: pos.Filename, PositionInFile: strconv.Itoa(pos.Line)}}
+			targets = append(targets, NewDeclaredTarget(serviceName, params["target"], params["protocol"], params["url"], trace))
+		}
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		x, y := targets[i], targets[j]
+		if x.ServiceName != y.ServiceName {
+			return x.ServiceName < y.ServiceName
+		}
+		if x.Trace[0].FileName != y.Trace[0].FileName {
+			return x.Trace[0].FileName < y.Trace[0].FileName
+		}
+
+		xLine, _ := strconv.Atoi(x.Trace[0].PositionInFile)
+		yLine, _ := strconv.Atoi(y.Trace[0].PositionInFile)
+		return xLine < yLine
+	})
+
+	return targets
+}
+
+// NewDeclaredTarget returns the client target of a declared dependency of the service on the target service or url
+func NewDeclaredTarget(serviceName, targetSvc, protocol, url string, trace []CallTargetTrace) *CallTarget {
+	target := defaultCallTarget("", DeclaredMethodName)
+	target.ServiceName = serviceName
+	target.TargetSvc = targetSvc
+	target.RequestLocation = url
+	target.Protocol = protocol
+	target.IsResolved = true
+	target.IsDeclared = true
+	if trace != nil {
+		target.Trace = trace
+	}
+
+	return target
+}
+
 // ResolveAnnotation populates the fields (RequestLocation or TargetSvc)
 // of a CallTarget by extracting them from the annotation value string.
 // Annotation format is currently:
 // 1) "//netdep:client url=... targetSvc=..."
 // 2) "//netdep:endpoint url=..."
+// Annotations that cannot be parsed are ignored, see ParseAnnotation.
 func ResolveAnnotation(ann string, target *CallTarget) {
-	annType := strings.Split(ann, " ")[0]
-	annData := strings.Split(ann, " ")[1:]
+	annotation, err := ParseAnnotation(ann)
+	if err != nil {
+		return
+	}
 
-	switch annType {
+	switch annotation.Type {
 	case "client":
 		// client type can have url=... and targetSvc=...
-		for _, param := range annData {
-			if strings.Split(param, "=")[0] == "url" {
-				target.IsResolved = true
-				target.RequestLocation = strings.Split(param, "=")[1]
-			} else if strings.Split(param, "=")[0] == "targetSvc" {
-				target.IsResolved = true
-				target.TargetSvc = strings.Split(param, "=")[1]
-			}
+		if url, ok := annotation.Params["url"]; ok {
+			target.RequestLocation = url
+		}
+		if targetSvc, ok := annotation.Params["targetSvc"]; ok {
+			target.TargetSvc = targetSvc
 		}
 	case "endpoint":
 		// endpoint type can have url=...
-		for _, param := range annData {
-			if strings.Split(param, "=")[0] == "url" {
-				target.IsResolved = true
-				target.RequestLocation = strings.Split(param, "=")[1]
-			}
+		url, ok := annotation.Params["url"]
+		if !ok {
+			return
 		}
+		target.RequestLocation = url
+	default:
+		return
 	}
+
+	target.IsResolved = true
+	target.IsAnnotated = true
 }
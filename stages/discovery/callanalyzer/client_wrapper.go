@@ -0,0 +1,99 @@
+/*
+Package callanalyzer defines call scanning methods
+Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+*/
+
+package callanalyzer
+
+import (
+	"strconv"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// clientWrappers finds the functions of a service that are annotated with "//netdep:client-wrapper urlArg=... targetSvc=...",
+// of which the calls are analysed as client calls instead of the calls made within them
+type clientWrappers struct {
+	annotations map[Position]string
+	files       map[string]bool                  // files are the files that hold a client-wrapper annotation
+	functions   map[*ssa.Function]*clientWrapper // functions caches whether a function is a client wrapper, nil if it is not
+}
+
+// clientWrapper is the annotation of a client wrapper
+type clientWrapper struct {
+	urlArg    int // urlArg is the index of the parameter holding the URL, not counting the receiver, or -1 if it is not given
+	targetSvc string
+}
+
+// newClientWrappers returns the client wrappers of the service, using its annotations
+func newClientWrappers(annotations map[Position]string) *clientWrappers {
+	wrappers := &clientWrappers{
+		annotations: annotations,
+		files:       make(map[string]bool),
+		functions:   make(map[*ssa.Function]*clientWrapper),
+	}
+
+	for pos, ann := range annotations {
+		if annotation, err := ParseAnnotation(ann); err == nil && annotation.Type == "client-wrapper" {
+			wrappers.files[pos.Filename] = true
+		}
+	}
+
+	return wrappers
+}
+
+// interestingCall returns the interesting call of a call to the function if the function is a client wrapper.
+// The annotation is looked for in the doc comment of the function, only when its file holds a client-wrapper annotation.
+func (wrappers *clientWrappers) interestingCall(call *ssa.CallCommon, fn *ssa.Function, frame *Frame) (InterestingCall, bool) {
+	if wrappers == nil || len(wrappers.files) == 0 {
+		return InterestingCall{}, false
+	}
+
+	wrapper, ok := wrappers.functions[fn]
+	if !ok {
+		wrapper = wrappers.find(fn, frame.serviceDir, frame.serviceName)
+		wrappers.functions[fn] = wrapper
+	}
+	if wrapper == nil {
+		return InterestingCall{}, false
+	}
+
+	interesting := InterestingCall{action: Output, interestingArgs: []int{}, targetSvc: wrapper.targetSvc}
+	if wrapper.urlArg >= 0 {
+		// the arguments of a static call to a method start with the receiver
+		argIndex := wrapper.urlArg + len(call.Args) - fn.Signature.Params().Len()
+		if argIndex < 0 || argIndex >= len(call.Args) {
+			return InterestingCall{}, false
+		}
+		interesting.interestingArgs = []int{argIndex}
+	}
+
+	return interesting, true
+}
+
+// find returns the client-wrapper annotation in the doc comment of the function, or nil if it has none
+func (wrappers *clientWrappers) find(fn *ssa.Function, serviceDir, serviceName string) *clientWrapper {
+	syntax := fn.Syntax()
+	if syntax == nil || !syntax.Pos().IsValid() {
+		return nil
+	}
+	if !wrappers.files[ServiceFileName(fn.Prog.Fset.Position(syntax.Pos()).Filename, serviceDir, serviceName)] {
+		return nil
+	}
+
+	for _, pos := range docCommentLines(fn, serviceDir, serviceName, wrappers.annotations) {
+		annotation, err := ParseAnnotation(wrappers.annotations[pos])
+		if err != nil || annotation.Type != "client-wrapper" {
+			continue
+		}
+
+		wrapper := &clientWrapper{urlArg: -1, targetSvc: annotation.Params["targetSvc"]}
+		if urlArg, ok := annotation.Params["urlArg"]; ok {
+			// the value is checked when the annotation is parsed
+			wrapper.urlArg, _ = strconv.Atoi(urlArg)
+		}
+		return wrapper
+	}
+
+	return nil
+}
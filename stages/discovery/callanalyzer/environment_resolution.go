@@ -0,0 +1,388 @@
+/*
+Package callanalyzer defines call scanning methods
+Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+*/
+
+package callanalyzer
+
+import (
+	"fmt"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/ssa"
+)
+
+// maxReturnDepth is the number of nested function calls that are followed to resolve a returned value
+const maxReturnDepth = 8
+
+// envconfigProcessCalls are the calls of github.com/kelseyhightower/envconfig that fill a struct from the environment
+var envconfigProcessCalls = map[string]bool{
+	"github.com/kelseyhightower/envconfig.Process":     true,
+	"github.com/kelseyhightower/envconfig.MustProcess": true,
+}
+
+// viperDefaultCalls are the calls of github.com/spf13/viper that set the default value of a configuration key
+var viperDefaultCalls = map[string]int{
+	"github.com/spf13/viper.SetDefault":          0,
+	"(*github.com/spf13/viper.Viper).SetDefault": 1,
+}
+
+// substitutionState is shared while resolving the parameters of a single call
+type substitutionState struct {
+	visiting        map[ssa.Value]bool // visiting holds the values that are being resolved, to stop at cycles
+	returnDepth     int                // returnDepth is the number of nested function calls that is being followed
+	environmentHits int                // environmentHits counts the values that were taken from the environment or flags
+}
+
+// newSubstitutionState returns an empty substitutionState
+func newSubstitutionState() *substitutionState {
+	return &substitutionState{visiting: make(map[ssa.Value]bool)}
+}
+
+// enter marks the value as being resolved, and returns false if it already was
+func (state *substitutionState) enter(value ssa.Value) bool {
+	if state == nil {
+		return true
+	}
+	if state.visiting[value] {
+		return false
+	}
+
+	state.visiting[value] = true
+	return true
+}
+
+// leave marks the value as resolved
+func (state *substitutionState) leave(value ssa.Value) {
+	if state != nil {
+		delete(state.visiting, value)
+	}
+}
+
+// hits returns the number of values that were taken from the environment so far
+func (state *substitutionState) hits() int {
+	if state == nil {
+		return 0
+	}
+	return state.environmentHits
+}
+
+// lookupEnvironment returns the value of an environment variable of the service
+func (substConf SubstitutionConfig) lookupEnvironment(name string) (string, bool) {
+	value, ok := substConf.serviceEnv[name]
+	if ok && substConf.state != nil {
+		substConf.state.environmentHits++
+	}
+
+	return value, ok
+}
+
+// resolveAlternatives resolves a value that is one of several values, such as an environment variable with a
+// fallback. A value that is taken from the environment is preferred, otherwise the values that were resolved
+// are the coded defaults, which are only used if they agree.
+func resolveAlternatives(alternatives []ssa.Value, fr *Frame, substConf SubstitutionConfig) (string, bool) {
+	defaults := make([]string, 0)
+
+	for i := range alternatives {
+		hitsBefore := substConf.state.hits()
+		value, isResolved := resolveValue(&alternatives[i], fr, substConf)
+		if !isResolved {
+			continue
+		}
+		if substConf.state.hits() > hitsBefore {
+			return value, true
+		}
+
+		defaults = append(defaults, value)
+	}
+
+	if len(defaults) == 0 {
+		return "unknown: none of the values was resolved", false
+	}
+	for _, value := range defaults[1:] {
+		if value != defaults[0] {
+			return "unknown: the variable has several values", false
+		}
+	}
+
+	return defaults[0], true
+}
+
+// resolveConfigKey resolves a configuration key, as read by viper, from the environment variable of the key
+// (users.url is read from USERS_URL) or else from the default that is set for the key
+func resolveConfigKey(key string, fr *Frame, substConf SubstitutionConfig) (string, bool) {
+	for _, name := range []string{key, strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))} {
+		if value, ok := substConf.lookupEnvironment(name); ok {
+			return value, true
+		}
+	}
+
+	if fr != nil {
+		for _, defaultValue := range findConfigDefaults(key, fr.modulePackages) {
+			if value, isResolved := resolveValue(&defaultValue, fr, substConf); isResolved {
+				return value, true
+			}
+		}
+	}
+
+	return fmt.Sprintf("unknown: configuration key %s not set", key), false
+}
+
+// findConfigDefaults returns the values that are set as the default of a configuration key in the packages
+// of the service, see modulePackages
+func findConfigDefaults(key string, packages []*ssa.Package) []ssa.Value {
+	defaults := make([]ssa.Value, 0)
+
+	calls := findProjectCalls(packages, func(call *ssa.CallCommon, qualifiedName string) bool {
+		keyIdx, isDefault := viperDefaultCalls[qualifiedName]
+		if !isDefault || keyIdx+1 >= len(call.Args) {
+			return false
+		}
+
+		defaultKey, isResolved := resolveValue(&call.Args[keyIdx], nil, SubstitutionConfig{})
+		return isResolved && defaultKey == key
+	})
+	for _, call := range calls {
+		defaults = append(defaults, call.Args[viperDefaultCalls[call.StaticCallee().RelString(nil)]+1])
+	}
+
+	return defaults
+}
+
+// findProjectCalls returns the static calls that match, in the functions of the packages
+func findProjectCalls(packages []*ssa.Package, match func(call *ssa.CallCommon, qualifiedName string) bool) []*ssa.CallCommon {
+	calls := make([]*ssa.CallCommon, 0)
+
+	for _, pkg := range packages {
+		for _, member := range pkg.Members {
+			if fn, ok := member.(*ssa.Function); ok {
+				calls = append(calls, findCallsInFunction(fn, match)...)
+			}
+		}
+	}
+
+	return calls
+}
+
+// findCallsInFunction returns the static calls in the function, and in its anonymous functions, that match
+func findCallsInFunction(fn *ssa.Function, match func(call *ssa.CallCommon, qualifiedName string) bool) []*ssa.CallCommon {
+	calls := make([]*ssa.CallCommon, 0)
+
+	for _, anonFn := range fn.AnonFuncs {
+		calls = append(calls, findCallsInFunction(anonFn, match)...)
+	}
+
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(ssa.CallInstruction)
+			if !ok {
+				continue
+			}
+
+			callee := call.Common().StaticCallee()
+			if callee != nil && match(call.Common(), callee.RelString(nil)) {
+				calls = append(calls, call.Common())
+			}
+		}
+	}
+
+	return calls
+}
+
+// modulePackages returns the main package of a service and the packages of its module that it imports, directly or
+// indirectly, in which the calls that configure the service are looked up. Other services that are built in the same
+// program, and libraries outside the module, are left out.
+func modulePackages(pkg *ssa.Package) []*ssa.Package {
+	if pkg == nil || pkg.Pkg == nil {
+		return nil
+	}
+
+	modulePath := modulePathOf(pkg)
+	inModule := func(path string) bool {
+		if modulePath == "" {
+			// without a go.mod file, the packages of the project are those of which the path starts with the same element
+			return strings.Split(path, "/")[0] == strings.Split(pkg.Pkg.Path(), "/")[0]
+		}
+		return path == modulePath || strings.HasPrefix(path, modulePath+"/")
+	}
+
+	packages := []*ssa.Package{pkg}
+	visited := map[*types.Package]bool{pkg.Pkg: true}
+	imports := pkg.Pkg.Imports()
+	for len(imports) > 0 {
+		imported := imports[0]
+		imports = imports[1:]
+		if visited[imported] || !inModule(imported.Path()) {
+			continue
+		}
+		visited[imported] = true
+
+		if importedPkg := pkg.Prog.Package(imported); importedPkg != nil {
+			packages = append(packages, importedPkg)
+		}
+		imports = append(imports, imported.Imports()...)
+	}
+
+	return packages
+}
+
+// modulePathOf returns the module path of the go.mod file in the directory of the package or the nearest directory
+// above it, or an empty string if there is none
+func modulePathOf(pkg *ssa.Package) string {
+	dir := ""
+	for _, member := range pkg.Members {
+		if member.Pos().IsValid() {
+			dir = filepath.Dir(pkg.Prog.Fset.Position(member.Pos()).Filename)
+			break
+		}
+	}
+
+	for dir != "" && dir != "." {
+		if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			return modfile.ModulePath(data)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return ""
+}
+
+// resolveReturnValue resolves a value returned by a function of the project, by resolving the values it returns
+// with its parameters bound to the arguments of the call
+func resolveReturnValue(call *ssa.Call, index int, fr *Frame, substConf SubstitutionConfig) (string, bool) {
+	fn := call.Call.StaticCallee()
+	if fn == nil || fn.Blocks == nil {
+		return "unknown: the called function was not resolved", false
+	}
+	if fn.Package() != nil && fn.Package().Pkg != nil && substConf.ignoreList[fn.Package().Pkg.Path()] {
+		return "unknown: the called function is ignored", false
+	}
+	if substConf.state == nil || substConf.state.returnDepth >= maxReturnDepth {
+		return "unknown: the called function is nested too deep", false
+	}
+
+	childFrame := Frame{params: make(map[*ssa.Parameter]*ssa.Value), parent: fr}
+	if fr != nil {
+		childFrame.globals = fr.globals
+		childFrame.pkg = fr.pkg
+		childFrame.modulePackages = fr.modulePackages
+		childFrame.serviceName = fr.serviceName
+		childFrame.serviceDir = fr.serviceDir
+	}
+	offset := len(fn.Params) - len(call.Call.Args)
+	for i, par := range fn.Params[offset:] {
+		childFrame.params[par] = &call.Call.Args[i]
+	}
+
+	results := make([]ssa.Value, 0)
+	for _, block := range fn.Blocks {
+		if ret, ok := block.Instrs[len(block.Instrs)-1].(*ssa.Return); ok && index < len(ret.Results) {
+			results = append(results, ret.Results[index])
+		}
+	}
+
+	substConf.state.returnDepth++
+	defer func() { substConf.state.returnDepth-- }()
+
+	return resolveAlternatives(results, &childFrame, substConf)
+}
+
+// resolveTaggedField resolves a field of a configuration struct that is filled from the environment
+// by github.com/kelseyhightower/envconfig or github.com/caarlos0/env, using the struct tags of the field.
+// A field of which the environment variable is not set resolves to its default tag.
+func resolveTaggedField(structValue ssa.Value, fieldIdx int, substConf SubstitutionConfig) (string, bool) {
+	structType, ok := derefType(structValue.Type()).Underlying().(*types.Struct)
+	if !ok || fieldIdx >= structType.NumFields() {
+		return "unknown: the field was not resolved", false
+	}
+
+	field := structType.Field(fieldIdx)
+	tag := reflect.StructTag(structType.Tag(fieldIdx))
+
+	names := make([]string, 0)
+	if name, ok := tag.Lookup("env"); ok {
+		names = append(names, strings.Split(name, ",")[0])
+	}
+
+	prefix, isProcessed := findEnvconfigPrefix(structValue)
+	if name, ok := tag.Lookup("envconfig"); ok || isProcessed {
+		if !ok {
+			name = field.Name()
+		}
+		if prefix != "" {
+			names = append(names, strings.ToUpper(prefix+"_"+name))
+		}
+		names = append(names, strings.ToUpper(name))
+	}
+
+	for _, name := range names {
+		if value, ok := substConf.lookupEnvironment(name); ok {
+			return value, true
+		}
+	}
+
+	for _, defaultTag := range []string{"default", "envDefault"} {
+		if value, ok := tag.Lookup(defaultTag); ok {
+			return value, true
+		}
+	}
+
+	if len(names) == 0 {
+		return "unknown: the field is not read from the environment", false
+	}
+	return fmt.Sprintf("unknown: environment variable %s not set", names[0]), false
+}
+
+// findEnvconfigPrefix returns the prefix with which envconfig fills the struct, and whether it is filled by envconfig
+func findEnvconfigPrefix(structValue ssa.Value) (string, bool) {
+	referrers := structValue.Referrers()
+	if referrers == nil {
+		return "", false
+	}
+
+	// the struct is passed to envconfig as an interface
+	instrs := append([]ssa.Instruction{}, *referrers...)
+	for _, referrer := range *referrers {
+		if converted, ok := referrer.(*ssa.MakeInterface); ok && converted.Referrers() != nil {
+			instrs = append(instrs, *converted.Referrers()...)
+		}
+	}
+
+	for _, referrer := range instrs {
+		call, ok := referrer.(*ssa.Call)
+		if !ok {
+			continue
+		}
+
+		callee := call.Call.StaticCallee()
+		if callee == nil || !envconfigProcessCalls[callee.RelString(nil)] || len(call.Call.Args) == 0 {
+			continue
+		}
+
+		prefix, _ := resolveValue(&call.Call.Args[0], nil, SubstitutionConfig{})
+		if strings.HasPrefix(prefix, "unknown:") {
+			prefix = ""
+		}
+		return prefix, true
+	}
+
+	return "", false
+}
+
+// derefType returns the type that a pointer type points to, or the type itself
+func derefType(typ types.Type) types.Type {
+	if pointer, ok := typ.Underlying().(*types.Pointer); ok {
+		return pointer.Elem()
+	}
+	return typ
+}
@@ -0,0 +1,247 @@
+/*
+Package callanalyzer defines call scanning methods
+Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+*/
+
+package callanalyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Exclusion leaves the calls and endpoints that match all of its patterns out of the dependency graph, such as
+// health checks and test doubles. The patterns may contain wildcards as supported by path.Match, and are ignored when empty.
+// The URL pattern matches the full URL or only its path.
+//
+// The Function pattern matches the package-qualified names of the SSA form, such as example.com/shop/orders.ping
+// or (*example.com/shop/orders.userDB).Update for a method. As a wildcard does not match a slash, the path of the
+// package is spelled out, as in (*example.com/shop/orders.userDB).*. Servicecalls are only matched by the receiver
+// and the name of the called method, such as userDB.Update for s.userDB.Update().
+type Exclusion struct {
+	Service  string // Service matches the name of the service that makes the call or registers the endpoint
+	Package  string // Package matches the path of a package of the functions on the path to the call
+	URL      string // URL matches the URL of the call or endpoint
+	Function string // Function matches the qualified name of a function on the path to the call, or of the called function
+	Reason   string // Reason is listed with the suppressed calls
+}
+
+// CallPath describes where a call is made, to decide whether it is suppressed
+type CallPath struct {
+	Functions []string   // Functions are the qualified names of the functions on the path to the call, and of the called function
+	Packages  []string   // Packages are the paths of the packages of the Functions
+	Lines     []Position // Lines are the positions at which an ignore annotation applies to the call
+}
+
+// matches checks whether the target matches all patterns of the exclusion
+func (exclusion Exclusion) matches(target *CallTarget, callPath CallPath) bool {
+	if exclusion.Service == "" && exclusion.Package == "" && exclusion.URL == "" && exclusion.Function == "" {
+		return false
+	}
+
+	return matchesPattern(exclusion.Service, target.ServiceName) && matchesAnyPattern(exclusion.URL, urlsOf(target.RequestLocation)) &&
+		matchesAnyPattern(exclusion.Function, callPath.Functions) && matchesAnyPattern(exclusion.Package, callPath.Packages)
+}
+
+// urlsOf returns the request location together with its path, so that a pattern such as /healthz matches
+// http://orders:8080/healthz as well, as a wildcard does not match the slashes of the host
+func urlsOf(location string) []string {
+	urls := []string{location}
+	if parsedURL, err := url.Parse(location); err == nil && parsedURL.Host != "" && parsedURL.Path != "" {
+		urls = append(urls, parsedURL.Path)
+	}
+
+	return urls
+}
+
+// description describes the patterns of the exclusion, for when it has no reason
+func (exclusion Exclusion) description() string {
+	patterns := make([]string, 0)
+	for _, pattern := range []struct{ key, value string }{
+		{"service", exclusion.Service}, {"package", exclusion.Package}, {"url", exclusion.URL}, {"function", exclusion.Function},
+	} {
+		if pattern.value != "" {
+			patterns = append(patterns, fmt.Sprintf("%s %s", pattern.key, pattern.value))
+		}
+	}
+
+	return fmt.Sprintf("excluded by %s", strings.Join(patterns, ", "))
+}
+
+// matchesPattern checks whether the value matches the pattern, which matches everything when it is empty
+func matchesPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
+
+// matchesAnyPattern checks whether any of the values matches the pattern, which matches everything when it is empty
+func matchesAnyPattern(pattern string, values []string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	for _, value := range values {
+		if matchesPattern(pattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddExclusion leaves the calls and endpoints that match the exclusion out of the dependency graph
+func (a *AnalyserConfig) AddExclusion(exclusion Exclusion) {
+	a.exclusions = append(a.exclusions, exclusion)
+}
+
+// SuppressionReason returns the reason that the target is left out of the dependency graph, or "" if it is not.
+// A target is suppressed by an exclusion that it matches, or by a "//netdep:ignore" annotation above one of the
+// lines of its path, above one of the functions on its path, or with scope=file in one of the files of its path.
+// Without a configuration, nothing is suppressed.
+func (a *AnalyserConfig) SuppressionReason(target *CallTarget, callPath CallPath) string {
+	if a == nil {
+		return ""
+	}
+
+	files := make(map[string]bool)
+	for _, pos := range callPath.Lines {
+		files[pos.Filename] = true
+
+		annotation, err := ParseAnnotation(a.annotations[target.ServiceName][pos])
+		if err == nil && annotation.Type == "ignore" && annotation.Params["scope"] == "" {
+			return ignoreReason(annotation, pos)
+		}
+	}
+
+	for pos, ann := range a.annotations[target.ServiceName] {
+		if !files[pos.Filename] {
+			continue
+		}
+
+		annotation, err := ParseAnnotation(ann)
+		if err == nil && annotation.Type == "ignore" && annotation.Params["scope"] == "file" {
+			return ignoreReason(annotation, pos)
+		}
+	}
+
+	for _, exclusion := range a.exclusions {
+		if !exclusion.matches(target, callPath) {
+			continue
+		}
+
+		if exclusion.Reason != "" {
+			return exclusion.Reason
+		}
+		return exclusion.description()
+	}
+
+	return ""
+}
+
+// ignoreReason returns the reason of an ignore annotation
+func ignoreReason(annotation Annotation, pos Position) string {
+	if reason := annotation.Params["reason"]; reason != "" {
+		return reason
+	}
+
+	return fmt.Sprintf("ignored by the annotation at %s:%d", pos.Filename, pos.Line)
+}
+
+// callPathOf describes the path to a call that is discovered in the frame: the functions that were entered to reach it,
+// the lines above the calls that were made on the way and the doc comments of the functions
+func callPathOf(frame *Frame, annotations map[Position]string) CallPath {
+	callPath := CallPath{
+		Functions: make([]string, 0, len(frame.functions)),
+		Packages:  make([]string, 0, len(frame.functions)),
+		Lines:     make([]Position, 0),
+	}
+
+	for _, tracedCall := range frame.trace {
+		filePath, position := getPositionFromPos(tracedCall.Pos(), frame.pkg.Prog)
+		if line, err := strconv.Atoi(position); err == nil {
+			callPath.Lines = append(callPath.Lines, Position{Filename: ServiceFileName(filePath, frame.serviceDir, frame.serviceName), Line: line - 1})
+		}
+	}
+
+	for _, fn := range frame.functions {
+		callPath.Functions = append(callPath.Functions, fn.RelString(nil))
+		if fn.Package() != nil && fn.Package().Pkg != nil {
+			callPath.Packages = append(callPath.Packages, fn.Package().Pkg.Path())
+		}
+
+		callPath.Lines = append(callPath.Lines, docCommentLines(fn, frame.serviceDir, frame.serviceName, annotations)...)
+	}
+
+	return callPath
+}
+
+// docCommentLines returns the positions of the lines of the doc comment of a function, so that an ignore
+// annotation in it applies to the calls made in the function. As the SSA form does not keep the syntax of
+// its functions, the file is parsed again, but only when one of the annotations could be in the doc comment.
+func docCommentLines(fn *ssa.Function, serviceDir, serviceName string, annotations map[Position]string) []Position {
+	syntax := fn.Syntax()
+	if syntax == nil || !syntax.Pos().IsValid() {
+		return nil
+	}
+
+	declaration := fn.Prog.Fset.Position(syntax.Pos())
+	fileName := ServiceFileName(declaration.Filename, serviceDir, serviceName)
+
+	hasAnnotation := false
+	for pos := range annotations {
+		hasAnnotation = hasAnnotation || pos.Filename == fileName && pos.Line < declaration.Line
+	}
+	if !hasAnnotation {
+		return nil
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, declaration.Filename, nil, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Doc == nil || fset.Position(funcDecl.Pos()).Line != declaration.Line {
+			continue
+		}
+
+		lines := make([]Position, 0, len(funcDecl.Doc.List))
+		for _, comment := range funcDecl.Doc.List {
+			lines = append(lines, Position{Filename: fileName, Line: fset.Position(comment.Pos()).Line})
+		}
+		return lines
+	}
+
+	return nil
+}
+
+// ServiceFileName returns the path of a file relative to the parent of the directory of the service, such as
+// "service-1/main.go", which is how the files of calls and annotations are reported. It does not depend on where the
+// project is, nor on the source of the name of the service. When the directory of the service is not known, the path
+// is taken from the last directory that is named after the service.
+func ServiceFileName(filePath, serviceDir, serviceName string) string {
+	if serviceDir != "" {
+		if relativePath, err := filepath.Rel(serviceDir, filePath); err == nil {
+			return filepath.Join(filepath.Base(serviceDir), relativePath)
+		}
+	}
+
+	separator := string(os.PathSeparator)
+	return filePath[strings.LastIndex(filePath, separator+serviceName+separator)+1:]
+}
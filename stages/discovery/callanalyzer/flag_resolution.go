@@ -0,0 +1,76 @@
+/*
+Package callanalyzer defines call scanning methods
+Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+*/
+
+package callanalyzer
+
+import (
+	"fmt"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// resolveFlag resolves a command-line flag, defined by a call with the given arguments, to the value
+// that is set for the service, or else to its default
+func resolveFlag(args []ssa.Value, nameIdx, defaultIdx int, fr *Frame, substConf SubstitutionConfig) (string, bool) {
+	if nameIdx >= len(args) || defaultIdx >= len(args) {
+		return "unknown: the flag was not resolved", false
+	}
+
+	name, isResolved := resolveValue(&args[nameIdx], fr, substConf)
+	if !isResolved {
+		return "unknown: the name of the flag was not resolved", false
+	}
+
+	if value, ok := substConf.serviceFlags[name]; ok {
+		if substConf.state != nil {
+			substConf.state.environmentHits++
+		}
+		return value, true
+	}
+
+	if value, isResolved := resolveValue(&args[defaultIdx], fr, substConf); isResolved {
+		return value, true
+	}
+	return fmt.Sprintf("unknown: the default of flag %s was not resolved", name), false
+}
+
+// resolveFlagVariable resolves a variable that is bound to a command-line flag, such as by flag.StringVar(&usersURL, ...).
+// The calls that bind a global variable are looked up in the packages of the service, as a package that is shared with
+// other services built in the same program can hold a variable that each service binds to a flag of its own.
+// It returns false if the variable is not bound to a flag.
+func resolveFlagVariable(pointer ssa.Value, fr *Frame, substConf SubstitutionConfig) (string, bool, bool) {
+	match := func(call *ssa.CallCommon, qualifiedName string) bool {
+		flagCall, ok := substConf.substitutionCalls[qualifiedName]
+		return ok && flagCall.action == SubstituteFlagVar && flagCall.interestingArgs[0] < len(call.Args) &&
+			call.Args[flagCall.interestingArgs[0]] == pointer
+	}
+
+	calls := make([]*ssa.CallCommon, 0)
+	switch variable := pointer.(type) {
+	case *ssa.Alloc:
+		if variable.Referrers() == nil {
+			break
+		}
+		for _, referrer := range *variable.Referrers() {
+			call, ok := referrer.(ssa.CallInstruction)
+			if ok && call.Common().StaticCallee() != nil && match(call.Common(), call.Common().StaticCallee().RelString(nil)) {
+				calls = append(calls, call.Common())
+			}
+		}
+	case *ssa.Global:
+		// globals have no referrers, so the calls that bind them are looked up in the packages of the service
+		if fr != nil {
+			calls = findProjectCalls(fr.modulePackages, match)
+		}
+	}
+
+	if len(calls) == 0 {
+		return "", false, false
+	}
+
+	flagCall := substConf.substitutionCalls[calls[0].StaticCallee().RelString(nil)]
+	value, isResolved := resolveFlag(calls[0].Args, flagCall.interestingArgs[1], flagCall.interestingArgs[2], fr, substConf)
+	return value, isResolved, true
+}
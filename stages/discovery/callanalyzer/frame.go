@@ -5,13 +5,18 @@ import "golang.org/x/tools/go/ssa"
 // Frame is a struct for keeping track of the traversal packages while looking for interesting functions
 type Frame struct {
 	trace             []*ssa.CallCommon             // trace is a stack trace of previous calls.
+	functions         []*ssa.Function               // functions are the functions that were entered, starting with main or init
 	visited           map[*ssa.CallCommon]bool      // visited is shared between frames and keeps track of which nodes have been visited
 	params            map[*ssa.Parameter]*ssa.Value // params maps a parameter inside a function to a argument value given in another frame
 	globals           map[*ssa.Global]*ssa.Value    // globals keeps a map the values associated with global variables
 	pkg               *ssa.Package                  // pkg references the service package
+	modulePackages    []*ssa.Package                // modulePackages are the packages of the service in which configuring calls are looked up
+	serviceName       string                        // serviceName is the name of the service that is analysed
+	serviceDir        string                        // serviceDir is the directory of the service, empty if it is not known
 	parent            *Frame                        // parent is necessary to recursively resolve variables (in different scopes)
 	targetsCollection *TargetsCollection            // targetsCollection is a reference to the collection of found calls
 	singlePass        bool                          // singlePass defines if we should check visited or trace for performance
+	wrappers          *clientWrappers               // wrappers are the client wrappers of the service, shared between frames
 }
 
 // hasVisited returns whether the block has already been trace.
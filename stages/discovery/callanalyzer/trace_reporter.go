@@ -1,11 +1,25 @@
 package callanalyzer
 
 import (
+	"sync"
+
 	"github.com/fatih/color"
 
 	"golang.org/x/tools/go/ssa"
 )
 
+// reportMutex prevents the reports of services that are analysed concurrently from interleaving
+var reportMutex sync.Mutex
+
+// reportUnresolvedCall logs that the variables of a call could not be resolved, together with its stack trace
+func reportUnresolvedCall(qualifiedFunctionName string, frame *Frame, config *AnalyserConfig) {
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+
+	color.Yellow("Could not resolve variable(s) for call to " + qualifiedFunctionName)
+	PrintTraceToCall(frame, config)
+}
+
 // PrintTraceToCall logs a stack trace for the current frame
 func PrintTraceToCall(frame *Frame, config *AnalyserConfig) {
 	traces := len(frame.trace)
@@ -40,8 +40,11 @@ func resolveParameter(par *ssa.Parameter, fr *Frame) (*ssa.Value, *Frame) {
 // resolveValue Resolves a supplied ssa.Value, only in the cases that are supported by the tool:
 // - string concatenation (see BinOp),
 // - string literal
-// - call to os.GetEnv
-// - other InterestingCalls with the action Substitute.
+// - call to os.GetEnv and os.LookupEnv
+// - other InterestingCalls with the action Substitute or SubstituteConfigKey
+// - command-line flags, which resolve to their default unless they are set for the service
+// - values with a fallback (see Phi) and values returned by functions of the project
+// - fields of configuration structs with envconfig or env struct tags.
 // It also returns a bool which indicates whether the variable was resolved.
 func resolveValue(value *ssa.Value, fr *Frame, substConf SubstitutionConfig) (string, bool) {
 	if value == nil {
@@ -59,6 +62,9 @@ func resolveValue(value *ssa.Value, fr *Frame, substConf SubstitutionConfig) (st
 
 		return "unknown: the parameter was not resolved", false
 	case *ssa.Global:
+		if fr == nil {
+			return "unknown: the global was not resolved", false
+		}
 		if globalValue, ok := fr.globals[val]; ok {
 			return resolveValue(globalValue, fr, substConf)
 		}
@@ -66,6 +72,12 @@ func resolveValue(value *ssa.Value, fr *Frame, substConf SubstitutionConfig) (st
 		return "unknown: the global was not resolved", false
 
 	case *ssa.UnOp:
+		if val.Op == token.MUL {
+			if flagValue, isResolved, isFlag := resolveFlagVariable(val.X, fr, substConf); isFlag {
+				return flagValue, isResolved
+			}
+		}
+
 		return resolveValue(&val.X, fr, substConf)
 
 	case *ssa.BinOp:
@@ -82,54 +94,88 @@ func resolveValue(value *ssa.Value, fr *Frame, substConf SubstitutionConfig) (st
 			return "unknown: only ADD binary operation is supported", false
 		}
 	case *ssa.Const:
+		if val.Value == nil {
+			// the zero value of a type that is not a basic type, such as nil
+			return "unknown: not a string constant", false
+		}
+
 		switch val.Value.Kind() { //nolint:exhaustive
 		case constant.String:
 			return constant.StringVal(val.Value), true
 		default:
 			return "unknown: not a string constant", false
 		}
+	case *ssa.MakeInterface:
+		return resolveValue(&val.X, fr, substConf)
 	case *ssa.Call:
-		return handleSubstitutableCall(val, substConf)
+		return handleSubstitutableCall(val, 0, fr, substConf)
+	case *ssa.Extract:
+		call, ok := val.Tuple.(*ssa.Call)
+		if !ok {
+			return "unknown: the parameter was not resolved", false
+		}
+		return handleSubstitutableCall(call, val.Index, fr, substConf)
+	case *ssa.Phi:
+		if !substConf.state.enter(val) {
+			return "unknown: the variable depends on itself", false
+		}
+		defer substConf.state.leave(val)
+
+		return resolveAlternatives(val.Edges, fr, substConf)
+	case *ssa.FieldAddr:
+		return resolveTaggedField(val.X, val.Field, substConf)
+	case *ssa.Field:
+		return resolveTaggedField(val.X, val.Field, substConf)
 	default:
 		return "unknown: the parameter was not resolved", false
 	}
 }
 
 // handleSubstitutableCall handles substitution for calls that can't be easily resolved
-// for example `os.getEnv()`
-func handleSubstitutableCall(val *ssa.Call, substConf SubstitutionConfig) (string, bool) {
+// for example `os.getEnv()`. The index is the result of the call that is used.
+// Calls that are not substituted are resolved by the value that the called function returns.
+func handleSubstitutableCall(val *ssa.Call, index int, fr *Frame, substConf SubstitutionConfig) (string, bool) {
 	unknownCallError := "unknown: substitutable call that is not supported"
-	switch fnCallType := val.Call.Value.(type) {
-	case *ssa.Function:
-		{
-			qualifiedFunctionNameOfTarget := fnCallType.RelString(nil)
-			if substConf.substitutionCalls[qualifiedFunctionNameOfTarget].action == Substitute {
-				switch argOfReplaceableCall := val.Call.Args[0].(type) {
-				case *ssa.Const:
-					{
-						envVarName := constant.StringVal(argOfReplaceableCall.Value)
-						envVarVal, ok := substConf.serviceEnv[envVarName]
-						if ok {
-							return envVarVal, true
-						} else {
-							return fmt.Sprintf("unknown: environment variable %s not set", envVarName), false
-						}
-					}
-				default:
-					return unknownCallError, false
-				}
-			}
+	fnCallType, ok := val.Call.Value.(*ssa.Function)
+	if !ok {
+		return unknownCallError, false
+	}
+
+	substitutionCall, isSubstitution := substConf.substitutionCalls[fnCallType.RelString(nil)]
+	if !isSubstitution {
+		return resolveReturnValue(val, index, fr, substConf)
+	}
+	if index != 0 || len(substitutionCall.interestingArgs) == 0 || substitutionCall.interestingArgs[0] >= len(val.Call.Args) {
+		return unknownCallError, false
+	}
+	if substitutionCall.action == SubstituteFlag && len(substitutionCall.interestingArgs) > 1 {
+		return resolveFlag(val.Call.Args, substitutionCall.interestingArgs[0], substitutionCall.interestingArgs[1], fr, substConf)
+	}
+
+	name, isResolved := resolveValue(&val.Call.Args[substitutionCall.interestingArgs[0]], fr, substConf)
+	if !isResolved {
+		return unknownCallError, false
+	}
+
+	switch substitutionCall.action { //nolint:exhaustive
+	case Substitute:
+		if envVarVal, ok := substConf.lookupEnvironment(name); ok {
+			return envVarVal, true
 		}
+		return fmt.Sprintf("unknown: environment variable %s not set", name), false
+	case SubstituteConfigKey:
+		return resolveConfigKey(name, fr, substConf)
 	default:
 		return unknownCallError, false
 	}
-	return unknownCallError, false
 }
 
 // resolveParameters iterates over the parameters, resolving those where possible.
-// It also keeps track of whether all variables could be resolved or not.
-func resolveParameters(parameters []ssa.Value, positions []int, fr *Frame, serviceEnv SubstitutionConfig) ([]string, bool) {
+// It also keeps track of whether all variables could be resolved or not, and returns the partial resolution,
+// which holds the reason that a variable was not resolved in its place (e.g. "http://users/unknown: ...").
+func resolveParameters(parameters []ssa.Value, positions []int, fr *Frame, serviceEnv SubstitutionConfig) ([]string, []string, bool) {
 	stringParameters := make([]string, len(positions))
+	partialParameters := make([]string, len(positions))
 	wasResolved := true
 
 	for i, idx := range positions {
@@ -140,10 +186,11 @@ func resolveParameters(parameters []ssa.Value, positions []int, fr *Frame, servi
 			} else {
 				wasResolved = false
 			}
+			partialParameters[i] = variable
 		}
 	}
 
-	return stringParameters, wasResolved
+	return stringParameters, partialParameters, wasResolved
 }
 
 // resolveGinAddrSlice is a hardcoded solution to resolve the port address of a Run command from the "github.com/gin-gonic/gin" library.
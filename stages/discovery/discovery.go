@@ -6,7 +6,6 @@ import (
 	"golang.org/x/tools/go/ssa"
 
 	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
-	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
 )
 
 /*
@@ -15,6 +14,7 @@ Refer to the Project plan, chapter 5.3 for more information.
 */
 
 // DiscoverAll creates a combined list of all discovered calls in the given packages.
+// Use FilterUnresolvedTargets on the result to find the targets that need an annotation.
 func DiscoverAll(packages []*ssa.Package, config *callanalyzer.AnalyserConfig) ([]*callanalyzer.CallTarget, []*callanalyzer.CallTarget, error) {
 	allClientTargets := make([]*callanalyzer.CallTarget, 0)
 	allServerTargets := make([]*callanalyzer.CallTarget, 0)
@@ -41,11 +41,10 @@ func DiscoverAll(packages []*ssa.Package, config *callanalyzer.AnalyserConfig) (
 	if err != nil {
 		return nil, nil, err
 	}
-
-	// Filter the targets which are still unresolved and send them to the output stage
-	// To print annotation location suggestions for the user
-	unresolvedTargets := filterUnresolvedTargets(&allClientTargets, &allServerTargets)
-	output.PrintAnnotationSuggestions(unresolvedTargets)
+	err = callanalyzer.MarkPublicEndpoints(allServerTargets, config)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	return allClientTargets, allServerTargets, nil
 }
@@ -64,18 +63,18 @@ func Discover(pkg *ssa.Package, config *callanalyzer.AnalyserConfig) ([]*callana
 	}
 }
 
-// filterUnresolvedTargets filters both client and server targets and returns a list of unresolved targets which is later
+// FilterUnresolvedTargets filters both client and server targets and returns a list of unresolved targets which is later
 // passed on to the output stage to print annotation suggestions.
-func filterUnresolvedTargets(clientTargets *[]*callanalyzer.CallTarget, serverTargets *[]*callanalyzer.CallTarget) []*callanalyzer.CallTarget {
+func FilterUnresolvedTargets(clientTargets, serverTargets []*callanalyzer.CallTarget) []*callanalyzer.CallTarget {
 	unresolvedTargets := make([]*callanalyzer.CallTarget, 0)
 
-	for _, client := range *clientTargets {
+	for _, client := range clientTargets {
 		if !client.IsResolved {
 			unresolvedTargets = append(unresolvedTargets, client)
 		}
 	}
 
-	for _, server := range *serverTargets {
+	for _, server := range serverTargets {
 		if !server.IsResolved {
 			unresolvedTargets = append(unresolvedTargets, server)
 		}
@@ -25,7 +25,7 @@ func discoverAllServices(projectDir string, services []string, config *callanaly
 	for _, serviceDir := range services {
 		// load packages
 		fmt.Printf("Building service %s\n", serviceDir)
-		packagesInService, err := preprocessing.LoadAndBuildPackages(projectDir, serviceDir)
+		packagesInService, err := preprocessing.LoadAndBuildPackages(projectDir, serviceDir, nil)
 		if err != nil {
 			continue
 		}
@@ -60,7 +60,7 @@ func TestDiscovery(t *testing.T) {
 
 func TestDiscoveryBasicCall(t *testing.T) {
 	projDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "basic_call")
-	initial, _ := preprocessing.LoadAndBuildPackages(projDir, projDir)
+	initial, _ := preprocessing.LoadAndBuildPackages(projDir, projDir, nil)
 	resC, _, _ := DiscoverAll(initial, nil)
 
 	assert.Equal(t, 1, len(resC), "Expect 1 interesting call")
@@ -69,7 +69,7 @@ func TestDiscoveryBasicCall(t *testing.T) {
 
 func TestDiscoveryBasicHandle(t *testing.T) {
 	projDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "basic_handle")
-	initial, _ := preprocessing.LoadAndBuildPackages(projDir, projDir)
+	initial, _ := preprocessing.LoadAndBuildPackages(projDir, projDir, nil)
 	_, resS, _ := DiscoverAll(initial, nil)
 
 	assert.Equal(t, 2, len(resS), "Expect 2 interesting calls")
@@ -78,7 +78,7 @@ func TestDiscoveryBasicHandle(t *testing.T) {
 
 func TestDiscoveryBasicHandleFunc(t *testing.T) {
 	projDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "basic_handlefunc")
-	initial, _ := preprocessing.LoadAndBuildPackages(projDir, projDir)
+	initial, _ := preprocessing.LoadAndBuildPackages(projDir, projDir, nil)
 	_, resS, _ := DiscoverAll(initial, nil)
 
 	assert.Equal(t, 2, len(resS), "Expect 2 interesting calls")
@@ -87,7 +87,7 @@ func TestDiscoveryBasicHandleFunc(t *testing.T) {
 
 func TestDiscoveryGinHandle(t *testing.T) {
 	projDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "gin_handle")
-	initial, _ := preprocessing.LoadAndBuildPackages(projDir, projDir)
+	initial, _ := preprocessing.LoadAndBuildPackages(projDir, projDir, nil)
 	_, resS, _ := DiscoverAll(initial, nil)
 
 	assert.Equal(t, 2, len(resS), "Expect 2 interesting calls")
@@ -110,7 +110,7 @@ func TestWrappedNestedUnknown(t *testing.T) {
 	analyseConfig := callanalyzer.DefaultConfigForFindingHTTPCalls()
 	analyseConfig.SetVerbose(true)
 
-	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir)
+	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir, nil)
 	res, _, _ := DiscoverAll(initial, &analyseConfig)
 
 	assert.Equal(t, "nested_unknown", res[0].ServiceName, "Expected service name nested_unknown.go")
@@ -119,7 +119,7 @@ func TestWrappedNestedUnknown(t *testing.T) {
 
 func TestDiscoveryHandleFuncCallBack(t *testing.T) {
 	projDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "handlefunc_callback")
-	services, _ := preprocessing.LoadAndBuildPackages(projDir, projDir)
+	services, _ := preprocessing.LoadAndBuildPackages(projDir, projDir, nil)
 	resC, resS, _ := DiscoverAll(services, nil)
 
 	assert.Equal(t, 1, len(resS), "Expect 1 interesting calls")
@@ -132,7 +132,7 @@ func TestDiscoveryHandleFuncCallBack(t *testing.T) {
 
 func TestDiscoveryHandleFuncCallBackAnon(t *testing.T) {
 	projDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "handlefunc_anon_callback")
-	services, _ := preprocessing.LoadAndBuildPackages(projDir, projDir)
+	services, _ := preprocessing.LoadAndBuildPackages(projDir, projDir, nil)
 	resC, resS, _ := DiscoverAll(services, nil)
 
 	assert.Equal(t, 1, len(resS), "Expect 1 interesting calls")
@@ -145,7 +145,7 @@ func TestDiscoveryHandleFuncCallBackAnon(t *testing.T) {
 
 func TestDiscoveryDependencyInCall(t *testing.T) {
 	projDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "dependency_in_call")
-	services, _ := preprocessing.LoadAndBuildPackages(projDir, projDir)
+	services, _ := preprocessing.LoadAndBuildPackages(projDir, projDir, nil)
 	resC, resS, _ := DiscoverAll(services, nil)
 
 	assert.Equal(t, 0, len(resS), "Expect 0 interesting calls")
@@ -153,13 +153,14 @@ func TestDiscoveryDependencyInCall(t *testing.T) {
 	assert.Equal(t, "net/http.Get", resC[0].MethodName, "Expect net/http.Get to be called")
 	assert.Equal(t, "net/http.Get", resC[1].MethodName, "Expect net/http.Get to be called")
 	assert.Equal(t, "https://example.com", resC[0].RequestLocation, "Expect example.com")
-	assert.Equal(t, "", resC[1].RequestLocation, "Expected empty")
-	assert.Equal(t, false, resC[1].IsResolved, "Expected not to resolve")
+	// the value returned by the function is resolved
+	assert.Equal(t, "/endpoint", resC[1].RequestLocation, "Expect /endpoint")
+	assert.Equal(t, true, resC[1].IsResolved, "Expected to resolve")
 }
 
 func TestWrappedClientCall(t *testing.T) {
 	svcDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "wrapped_client")
-	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir)
+	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir, nil)
 	res, _, _ := DiscoverAll(initial, nil)
 
 	assert.Equal(t, "wrapped_client", res[0].ServiceName, "Expected service name interface_call.go")
@@ -174,7 +175,7 @@ func TestWrappedClientCall(t *testing.T) {
 
 func TestWrappedInterfaceCall(t *testing.T) {
 	svcDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "interface_call")
-	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir)
+	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir, nil)
 	res, _, _ := DiscoverAll(initial, nil)
 
 	assert.Equal(t, "interface_call", res[0].ServiceName, "Expected service name interface_call.go")
@@ -194,7 +195,7 @@ func TestGetEnvCall(t *testing.T) {
 
 	config := callanalyzer.DefaultConfigForFindingHTTPCalls()
 	config.SetEnv(env)
-	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir)
+	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir, nil)
 	res, _, _ := DiscoverAll(initial, &config)
 
 	assert.Equal(t, "env_variable", res[0].ServiceName, "Expected service name env_variable.go")
@@ -206,7 +207,7 @@ func TestGetEnvCall(t *testing.T) {
 func TestGinHandleCall(t *testing.T) {
 	svcDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "gin_handle")
 
-	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir)
+	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir, nil)
 	DiscoverAll(initial, nil)
 }
 
@@ -214,7 +215,7 @@ func TestGinHandleCall(t *testing.T) {
 func TestGlobalVariableCall(t *testing.T) {
 	svcDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "global_variable")
 
-	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir)
+	initial, _ := preprocessing.LoadAndBuildPackages(helpers.RootDir, svcDir, nil)
 	res, _, _ := DiscoverAll(initial, nil)
 
 	assert.Equal(t, "global_variable", res[0].ServiceName, "Expected service name global_variable.go")
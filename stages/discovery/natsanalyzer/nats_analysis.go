@@ -9,10 +9,12 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/fatih/color"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
 )
 
 // NatsCall is a data structure to hold either consumer
@@ -30,18 +32,18 @@ type NatsCall struct {
 	FileName string
 	// Line of code
 	PositionInFile string
+	// Whether the call is declared by an annotation rather than discovered in the code
+	IsDeclared bool
 }
 
 // FindNATSCalls exposes natsanalyzer API. It receives service directory path
 // as an argument and iterates over each file searching for non-test .go files
 //
 // Each .go file is then passed to findDependencies, which returns a list of
-// consumers and producers as NatsCall.
-func FindNATSCalls(serviceDir string) ([]*NatsCall, []*NatsCall, error) {
+// consumers and producers as NatsCall. Files that cannot be read or parsed are recorded in the collector.
+func FindNATSCalls(serviceDir string, collector *diagnostics.Collector) ([]*NatsCall, []*NatsCall, error) {
 	consumers := make([]*NatsCall, 0)
 	producers := make([]*NatsCall, 0)
-	var err error
-	config := defaultNatsConfig()
 
 	files, err := os.ReadDir(serviceDir)
 	if err != nil {
@@ -50,28 +52,105 @@ func FindNATSCalls(serviceDir string) ([]*NatsCall, []*NatsCall, error) {
 
 	for _, file := range files {
 		if file.IsDir() {
-			servicePath := filepath.Join(serviceDir, file.Name())
-			fileErr := filepath.Walk(servicePath, func(path string, info fs.FileInfo, e error) error {
-				if e != nil {
-					color.Yellow("Error in NATS analysis: %s", e)
-				}
+			cons, prod := FindServiceNATSCalls(filepath.Join(serviceDir, file.Name()), file.Name(), collector)
+			consumers = append(consumers, cons...)
+			producers = append(producers, prod...)
+		}
+	}
 
-				if filepath.Ext(info.Name()) == ".go" && !strings.HasSuffix(info.Name(), "_test.go") {
-					cons, prod := findDependencies(path, file.Name(), config)
-					consumers = append(consumers, cons...)
-					producers = append(producers, prod...)
-				}
+	return consumers, producers, nil
+}
+
+// FindServiceNATSCalls finds the consumers and producers in the non-test .go files of a single service.
+// Files that cannot be read or parsed are recorded in the collector and skipped.
+func FindServiceNATSCalls(servicePath string, serviceName string, collector *diagnostics.Collector) ([]*NatsCall, []*NatsCall) {
+	consumers := make([]*NatsCall, 0)
+	producers := make([]*NatsCall, 0)
+	config := defaultNatsConfig()
 
+	_ = filepath.Walk(servicePath, func(path string, info fs.FileInfo, e error) error {
+		if e != nil {
+			collector.FileError(diagnostics.StageDiscovery, serviceName, path, e)
+			return nil
+		}
+
+		if filepath.Ext(info.Name()) == ".go" && !strings.HasSuffix(info.Name(), "_test.go") {
+			cons, prod, err := findDependencies(path, serviceName, config)
+			if err != nil {
+				collector.FileError(diagnostics.StageDiscovery, serviceName, path, err)
 				return nil
-			})
+			}
+
+			for _, call := range append(cons, prod...) {
+				call.FileName = callanalyzer.ServiceFileName(call.FileName, servicePath, serviceName)
+			}
+
+			consumers = append(consumers, cons...)
+			producers = append(producers, prod...)
+		}
+
+		return nil
+	})
+
+	return consumers, producers
+}
+
+// AnnotatedCalls returns a consumer for each "//netdep:subscribe subject=... protocol=..." annotation and a producer
+// for each "//netdep:publish subject=... protocol=..." annotation, which declare messaging calls that are not discovered.
+// The protocol defaults to NATS. Annotations that cannot be parsed are left out. The calls are ordered by service and position.
+func AnnotatedCalls(annotations map[string]map[callanalyzer.Position]string) ([]*NatsCall, []*NatsCall) {
+	consumers := make([]*NatsCall, 0)
+	producers := make([]*NatsCall, 0)
+	config := defaultNatsConfig()
+
+	for serviceName, serviceAnnotations := range annotations {
+		for pos, ann := range serviceAnnotations {
+			annotation, err := callanalyzer.ParseAnnotation(ann)
+			if err != nil || annotation.Type != "publish" && annotation.Type != "subscribe" {
+				continue
+			}
+
+			call := &NatsCall{
+				Communication:  config.communication,
+				MethodName:     "netdep:" + annotation.Type,
+				Subject:        annotation.Params["subject"],
+				ServiceName:    serviceName,
+				FileName:       pos.Filename,
+				PositionInFile: strconv.Itoa(pos.Line),
+				IsDeclared:     true,
+			}
+			if protocol := annotation.Params["protocol"]; protocol != "" {
+				call.Communication = protocol
+			}
 
-			if fileErr != nil {
-				color.Yellow("Error while traversing services for NATS analysis: %s", fileErr)
+			if annotation.Type == "publish" {
+				producers = append(producers, call)
+			} else {
+				consumers = append(consumers, call)
 			}
 		}
 	}
 
-	return consumers, producers, nil
+	sortCalls(consumers)
+	sortCalls(producers)
+	return consumers, producers
+}
+
+// sortCalls orders the calls by service, file and line
+func sortCalls(calls []*NatsCall) {
+	sort.Slice(calls, func(i, j int) bool {
+		x, y := calls[i], calls[j]
+		if x.ServiceName != y.ServiceName {
+			return x.ServiceName < y.ServiceName
+		}
+		if x.FileName != y.FileName {
+			return x.FileName < y.FileName
+		}
+
+		xLine, _ := strconv.Atoi(x.PositionInFile)
+		yLine, _ := strconv.Atoi(y.PositionInFile)
+		return xLine < yLine
+	})
 }
 
 // findDependencies goes over a specified service and collects
@@ -79,14 +158,14 @@ func FindNATSCalls(serviceDir string) ([]*NatsCall, []*NatsCall, error) {
 //
 // Currently the consumers are identified by a "Subscribe" pattern
 // and producers are identified by "NotifyMsg".
-func findDependencies(servicePath string, serviceName string, config NatsAnalysisConfig) ([]*NatsCall, []*NatsCall) {
+func findDependencies(servicePath string, serviceName string, config NatsAnalysisConfig) ([]*NatsCall, []*NatsCall, error) {
 	producers := make([]*NatsCall, 0)
 	consumers := make([]*NatsCall, 0)
 
 	fs := token.NewFileSet()
 	f, err := parser.ParseFile(fs, servicePath, nil, parser.ParseComments)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
 	ast.Inspect(f, func(node ast.Node) bool {
@@ -136,7 +215,7 @@ func findDependencies(servicePath string, serviceName string, config NatsAnalysi
 		return true
 	})
 
-	return consumers, producers
+	return consumers, producers, nil
 }
 
 // findSubject returns a name of the subject from the arguments.
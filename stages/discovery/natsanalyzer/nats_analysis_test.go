@@ -1,21 +1,73 @@
 package natsanalyzer
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
 	"lab.weave.nl/internships/tud-2022/netDep/helpers"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
 )
 
 func TestFindNATSCalls(t *testing.T) {
 	svcDir := filepath.Join(helpers.RootDir, "test", "sample", "nats", "svc")
-	consumers, producers, _ := FindNATSCalls(svcDir)
+	collector := diagnostics.NewCollector()
+	consumers, producers, _ := FindNATSCalls(svcDir, collector)
 
 	assert.Equal(t, len(consumers), 1)
 	assert.Equal(t, len(producers), 1)
 	assert.Equal(t, consumers[0].Subject, "SnapshotStartdateChangedSubject")
 	assert.Equal(t, producers[0].Subject, "SnapshotStartdateChangedSubject")
 	assert.Equal(t, producers[0].ServiceName, "snapshot")
+	assert.Empty(t, collector.Diagnostics())
+}
+
+func TestFindServiceNATSCallsInvalidFile(t *testing.T) {
+	svcDir := t.TempDir()
+	invalidFile := filepath.Join(svcDir, "invalid.go")
+	assert.Nil(t, os.WriteFile(invalidFile, []byte("package main\n\nfunc main() {\n"), 0o600))
+
+	collector := diagnostics.NewCollector()
+	consumers, producers := FindServiceNATSCalls(svcDir, "invalid", collector)
+
+	assert.Empty(t, consumers)
+	assert.Empty(t, producers)
+	assert.Equal(t, []diagnostics.Diagnostic{{
+		Severity: diagnostics.Error,
+		Stage:    diagnostics.StageDiscovery,
+		Service:  "invalid",
+		Position: invalidFile + ":3",
+		Message:  "expected '}', found 'EOF'",
+	}}, collector.Diagnostics())
+}
+
+func TestAnnotatedCalls(t *testing.T) {
+	annotations := map[string]map[callanalyzer.Position]string{
+		"orders": {
+			{Filename: "orders/main.go", Line: 12}: "publish subject=orders.created protocol=Kafka",
+			{Filename: "orders/main.go", Line: 4}:  "publish subject=OrderCreatedSubject",
+			{Filename: "orders/main.go", Line: 8}:  "client url=http://users:8080/",
+		},
+		"billing": {
+			{Filename: "billing/main.go", Line: 3}: "subscribe subject=OrderCreatedSubject",
+			{Filename: "billing/main.go", Line: 5}: "subscribe protocol=NATS",
+		},
+	}
+
+	consumers, producers := AnnotatedCalls(annotations)
+
+	assert.Equal(t, []*NatsCall{{
+		Communication: "NATS", MethodName: "netdep:subscribe", Subject: "OrderCreatedSubject",
+		ServiceName: "billing", FileName: "billing/main.go", PositionInFile: "3", IsDeclared: true,
+	}}, consumers)
+	assert.Equal(t, []*NatsCall{{
+		Communication: "NATS", MethodName: "netdep:publish", Subject: "OrderCreatedSubject",
+		ServiceName: "orders", FileName: "orders/main.go", PositionInFile: "4", IsDeclared: true,
+	}, {
+		Communication: "Kafka", MethodName: "netdep:publish", Subject: "orders.created",
+		ServiceName: "orders", FileName: "orders/main.go", PositionInFile: "12", IsDeclared: true,
+	}}, producers)
 }
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
 	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
 )
 
@@ -20,8 +21,8 @@ type IntCall struct {
 }
 
 // ParseServiceCallsPackage iterates through all the go files in the servicecalls package (files ending in -service.go !!) and
-// scans all the method names defined in the interfaces.
-func ParseServiceCallsPackage(serviceCallsDir string) (map[IntCall]string, *[]*callanalyzer.CallTarget, error) {
+// scans all the method names defined in the interfaces. Files that cannot be parsed are recorded in the collector.
+func ParseServiceCallsPackage(serviceCallsDir string, collector *diagnostics.Collector) (map[IntCall]string, *[]*callanalyzer.CallTarget, error) {
 	serviceCalls := make(map[IntCall]string)
 	serverTargets := make([]*callanalyzer.CallTarget, 0)
 
@@ -38,7 +39,10 @@ func ParseServiceCallsPackage(serviceCallsDir string) (map[IntCall]string, *[]*c
 	for _, file := range files {
 		if filepath.Ext(file.Name()) == ".go" && strings.HasSuffix(file.Name(), "-service.go") {
 			serviceName := file.Name()[:len(file.Name())-11]
-			ParseInterfaces(filepath.Join(serviceCallsDir, file.Name()), serviceName, serviceCalls, &serverTargets)
+			path := filepath.Join(serviceCallsDir, file.Name())
+			if err := ParseInterfaces(path, serviceName, serviceCalls, &serverTargets); err != nil {
+				collector.FileError(diagnostics.StagePreprocessing, "", path, err)
+			}
 		}
 	}
 
@@ -47,7 +51,11 @@ func ParseServiceCallsPackage(serviceCallsDir string) (map[IntCall]string, *[]*c
 
 // LoadServiceCalls scans all the files of a given service directory and returns a list of
 // clientTargets based on the method names found in the servicecalls package.
-func LoadServiceCalls(servicePath string, serviceName string, internalCalls map[IntCall]string, clientTargets *[]*callanalyzer.CallTarget) error {
+// The config decides which calls are suppressed, a nil config only uses the default exclusions.
+// Files that cannot be parsed are recorded in the collector and skipped.
+func LoadServiceCalls(servicePath string, serviceName string, internalCalls map[IntCall]string, clientTargets *[]*callanalyzer.CallTarget,
+	config *callanalyzer.AnalyserConfig, collector *diagnostics.Collector,
+) error {
 	files, err := os.ReadDir(servicePath)
 	if err != nil {
 		return err
@@ -56,14 +64,16 @@ func LoadServiceCalls(servicePath string, serviceName string, internalCalls map[
 	for _, file := range files {
 		if filepath.Ext(file.Name()) == ".go" && !strings.HasSuffix(file.Name(), "_test.go") && !strings.HasSuffix(file.Name(), "pb.go") {
 			// If the file is a .go file - parse it
-			currClientTargets, err := ParseMethods(filepath.Join(servicePath, file.Name()), internalCalls, serviceName)
+			path := filepath.Join(servicePath, file.Name())
+			currClientTargets, err := ParseMethods(path, internalCalls, serviceName, config)
 			if err != nil {
-				return err
+				collector.FileError(diagnostics.StageDiscovery, serviceName, path, err)
+				continue
 			}
 			*clientTargets = append(*clientTargets, *currClientTargets...)
 		} else if file.IsDir() {
 			// If the file is a directory - recursively look for .go files inside it
-			err := LoadServiceCalls(filepath.Join(servicePath, file.Name()), serviceName, internalCalls, clientTargets)
+			err := LoadServiceCalls(filepath.Join(servicePath, file.Name()), serviceName, internalCalls, clientTargets, config, collector)
 			if err != nil {
 				return err
 			}
@@ -5,12 +5,14 @@ Copyright © 2022 TW Group 13C, Weave BV, TU Delft
 package servicecallsanalyzer
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
 	"lab.weave.nl/internships/tud-2022/netDep/helpers"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
 	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
 )
 
@@ -26,24 +28,39 @@ func TestLoadServiceCalls(t *testing.T) {
 
 	intCalls[intCall] = "serviceA"
 
-	LoadServiceCalls(svcDir, "object_call", intCalls, &clientTargets)
+	LoadServiceCalls(svcDir, "object_call", intCalls, &clientTargets, nil, nil)
 
 	assert.Equal(t, 1, len(clientTargets))
 	assert.Equal(t, "FirstMethod", clientTargets[0].MethodName)
 }
 
+// TestParseMethodsSkipsDatabaseCalls checks that methods called on a receiver ending with DB are not taken to be
+// servicecalls, as their names are often as generic as those of the servicecalls
+func TestParseMethodsSkipsDatabaseCalls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handler.go")
+	content := "package main\n\nimport \"example.com/shop/servicecalls\"\n\nvar _ servicecalls.Client\n\n" +
+		"func (s *server) handle() {\n\ts.client.Update(1)\n\ts.userDB.Update(1)\n}\n"
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+
+	clientTargets, err := ParseMethods(path, map[IntCall]string{{Name: "Update", NumParams: 1}: "users"}, "orders", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(*clientTargets))
+	assert.Equal(t, "8", (*clientTargets)[0].Trace[0].PositionInFile)
+	assert.Equal(t, "", (*clientTargets)[0].Suppressed)
+}
+
 func TestLoadServiceCallsInvalidPath(t *testing.T) {
 	intCalls := make(map[IntCall]string)
 	clientTargets := make([]*callanalyzer.CallTarget, 0)
 
-	err := LoadServiceCalls("invalidPath", "serviceName", intCalls, &clientTargets)
+	err := LoadServiceCalls("invalidPath", "serviceName", intCalls, &clientTargets, nil, nil)
 	assert.NotNil(t, err)
 }
 
 func TestFindServiceCalls(t *testing.T) {
 	serviceCallsDir := filepath.Join(helpers.RootDir, "test", "sample", "servicecalls")
 
-	internalCalls, _, _ := ParseServiceCallsPackage(serviceCallsDir)
+	internalCalls, _, _ := ParseServiceCallsPackage(serviceCallsDir, nil)
 
 	posOne := IntCall{
 		Name:      "FirstMethod",
@@ -67,7 +84,7 @@ func TestFindServiceCalls(t *testing.T) {
 
 func TestFindServiceCallsEmptyDir(t *testing.T) {
 	serviceCallsDir := ""
-	internalCalls, serverTargets, _ := ParseServiceCallsPackage(serviceCallsDir)
+	internalCalls, serverTargets, _ := ParseServiceCallsPackage(serviceCallsDir, nil)
 
 	assert.Equal(t, 0, len(internalCalls))
 	assert.Equal(t, 0, len(*serverTargets))
@@ -75,9 +92,25 @@ func TestFindServiceCallsEmptyDir(t *testing.T) {
 
 func TestFindServiceCallsInvalidDir(t *testing.T) {
 	serviceCallsDir := "invalidDir"
-	internalCalls, serverTargets, err := ParseServiceCallsPackage(serviceCallsDir)
+	internalCalls, serverTargets, err := ParseServiceCallsPackage(serviceCallsDir, nil)
 
 	assert.Equal(t, 0, len(internalCalls))
 	assert.Equal(t, 0, len(*serverTargets))
 	assert.NotNil(t, err)
 }
+
+func TestFindServiceCallsInvalidFile(t *testing.T) {
+	serviceCallsDir := t.TempDir()
+	invalidFile := filepath.Join(serviceCallsDir, "broken-service.go")
+	assert.Nil(t, os.WriteFile(invalidFile, []byte("package servicecalls\n\ntype Broken interface {\n"), 0o600))
+
+	collector := diagnostics.NewCollector()
+	internalCalls, serverTargets, err := ParseServiceCallsPackage(serviceCallsDir, collector)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(internalCalls))
+	assert.Equal(t, 0, len(*serverTargets))
+	assert.Equal(t, 1, len(collector.Diagnostics()))
+	assert.Equal(t, diagnostics.StagePreprocessing, collector.Diagnostics()[0].Stage)
+	assert.Equal(t, invalidFile+":3", collector.Diagnostics()[0].Position)
+}
@@ -15,11 +15,11 @@ import (
 )
 
 // ParseInterfaces parses the given file, finds and collects all methods defined in interfaces
-func ParseInterfaces(path string, serviceName string, serviceCalls map[IntCall]string, serverTargets *[]*callanalyzer.CallTarget) {
+func ParseInterfaces(path string, serviceName string, serviceCalls map[IntCall]string, serverTargets *[]*callanalyzer.CallTarget) error {
 	fs := token.NewFileSet()
 	f, err := parser.ParseFile(fs, path, nil, parser.ParseComments)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	ast.Inspect(f, func(n ast.Node) bool {
 		// Find Function Call Statements
@@ -50,10 +50,13 @@ func ParseInterfaces(path string, serviceName string, serviceCalls map[IntCall]s
 		}
 		return true
 	})
+
+	return nil
 }
 
 // ParseMethods parses the given file, finds and collects all interesting methods (interesting = found in the servicecalls package).
-func ParseMethods(path string, calls map[IntCall]string, serviceName string) (*[]*callanalyzer.CallTarget, error) {
+// The calls that are excluded by the configuration, or ignored by an annotation, are marked as suppressed.
+func ParseMethods(path string, calls map[IntCall]string, serviceName string, config *callanalyzer.AnalyserConfig) (*[]*callanalyzer.CallTarget, error) {
 	fs := token.NewFileSet()
 	f, err := parser.ParseFile(fs, path, nil, parser.ParseComments)
 	if err != nil {
@@ -73,55 +76,91 @@ func ParseMethods(path string, calls map[IntCall]string, serviceName string) (*[
 		return &clientTargets, nil
 	}
 
-	ast.Inspect(f, func(n ast.Node) bool {
-		// Find Function Call Statements
-		funcCall, ok := n.(*ast.CallExpr)
-		if !ok {
-			return true
-		}
-		mthd, ok := funcCall.Fun.(*ast.SelectorExpr)
-		if !ok {
-			return true
-		}
+	for _, decl := range f.Decls {
+		funcDecl, _ := decl.(*ast.FuncDecl)
 
-		// Retrieve the selector which appears before the function call
-		// Ex: selector.FunctionCall()
-		sel, ok1 := mthd.X.(*ast.SelectorExpr)
+		ast.Inspect(decl, func(n ast.Node) bool {
+			// Find Function Call Statements
+			funcCall, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			mthd, ok := funcCall.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+
+			// If there's a selector - ensure it doesn't end with DB, as that introduces
+			// some false positives with very generic method names such as "Update", "Get", "Delete"
+			if sel, ok := mthd.X.(*ast.SelectorExpr); ok && strings.HasSuffix(sel.Sel.Name, "DB") {
+				return true
+			}
+
+			clientTarget := checkInterestingCall(fs, mthd, funcCall, calls, serviceName)
+			if clientTarget != nil {
+				serviceDir := config.ServiceDirectory(serviceName)
+				clientTarget.Trace[0].FileName = callanalyzer.ServiceFileName(clientTarget.Trace[0].FileName, serviceDir, serviceName)
+				clientTarget.Suppressed = config.SuppressionReason(clientTarget, callPathOf(fs, mthd, funcDecl, serviceDir, serviceName))
+				clientTargets = append(clientTargets, clientTarget)
+			}
+			return true
+		})
+	}
 
-		// If there's a selector - ensure it doesn't end with DB, as that introduces
-		// some false positives with very generic method names such as "Update", "Get", "Delete"
-		if !ok1 || (ok1 && !strings.HasSuffix(sel.Sel.Name, "DB")) {
-			checkInterestingCall(fs, mthd, funcCall, calls, serviceName, &clientTargets)
-		}
-		return true
-	})
 	return &clientTargets, nil
 }
 
-// checkInterestingCall checks whether the given call is one of the calls found in the serviceCalls package.
-func checkInterestingCall(fs *token.FileSet, mthd *ast.SelectorExpr, funcCall *ast.CallExpr, calls map[IntCall]string, serviceName string, clientTargets *[]*callanalyzer.CallTarget) {
+// checkInterestingCall checks whether the given call is one of the calls found in the serviceCalls package,
+// and returns its client target if it is.
+func checkInterestingCall(fs *token.FileSet, mthd *ast.SelectorExpr, funcCall *ast.CallExpr, calls map[IntCall]string, serviceName string) *callanalyzer.CallTarget {
 	intCall := IntCall{
 		Name:      mthd.Sel.Name,
 		NumParams: len(funcCall.Args),
 	}
 	_, ex := calls[intCall]
 	// If the call is one of the servicecalls
-	if ex {
-		// Create a new client target
-		clientTarget := &callanalyzer.CallTarget{
-			PackageName:     "servicecalls",
-			MethodName:      mthd.Sel.Name,
-			RequestLocation: mthd.Sel.Name,
-			IsResolved:      true,
-			ServiceName:     serviceName,
-			Trace: []callanalyzer.CallTargetTrace{
-				{
-					FileName:       fs.Position(mthd.Sel.NamePos).Filename,
-					PositionInFile: strconv.Itoa(fs.Position(mthd.Sel.NamePos).Line),
-				},
+	if !ex {
+		return nil
+	}
+
+	// Create a new client target
+	return &callanalyzer.CallTarget{
+		PackageName:     "servicecalls",
+		MethodName:      mthd.Sel.Name,
+		RequestLocation: mthd.Sel.Name,
+		IsResolved:      true,
+		ServiceName:     serviceName,
+		Trace: []callanalyzer.CallTargetTrace{
+			{
+				FileName:       fs.Position(mthd.Sel.NamePos).Filename,
+				PositionInFile: strconv.Itoa(fs.Position(mthd.Sel.NamePos).Line),
 			},
-		}
+		},
+	}
+}
+
+// callPathOf describes where a method is called: the function is named after the selector which appears before
+// the method (such as userDB.Update for s.userDB.Update()), and ignore annotations apply on the line above the call
+// and in the doc comment of the function in which it is made
+func callPathOf(fs *token.FileSet, mthd *ast.SelectorExpr, funcDecl *ast.FuncDecl, serviceDir, serviceName string) callanalyzer.CallPath {
+	callPath := callanalyzer.CallPath{Functions: make([]string, 0, 1), Lines: make([]callanalyzer.Position, 0)}
 
-		*clientTargets = append(*clientTargets, clientTarget)
+	switch receiver := mthd.X.(type) {
+	case *ast.SelectorExpr:
+		callPath.Functions = append(callPath.Functions, receiver.Sel.Name+"."+mthd.Sel.Name)
+	case *ast.Ident:
+		callPath.Functions = append(callPath.Functions, receiver.Name+"."+mthd.Sel.Name)
 	}
+
+	position := fs.Position(mthd.Sel.NamePos)
+	fileName := callanalyzer.ServiceFileName(position.Filename, serviceDir, serviceName)
+	callPath.Lines = append(callPath.Lines, callanalyzer.Position{Filename: fileName, Line: position.Line - 1})
+
+	if funcDecl != nil && funcDecl.Doc != nil {
+		for _, comment := range funcDecl.Doc.List {
+			callPath.Lines = append(callPath.Lines, callanalyzer.Position{Filename: fileName, Line: fs.Position(comment.Pos()).Line})
+		}
+	}
+
+	return callPath
 }
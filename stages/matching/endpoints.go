@@ -0,0 +1,106 @@
+// Package matching constructs a graph from the found calls in the discovery stage
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package matching
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+	"lab.weave.nl/internships/tud-2022/netDep/structures"
+)
+
+// serviceURL identifies a URL under which an endpoint of a service can be called
+type serviceURL struct {
+	service string
+	url     string
+}
+
+// findCalledURLs collects the URLs that are called by the client calls, together with the service they target.
+// Calls of a service to itself are not taken into account, as these are not part of the dependency graph either.
+func findCalledURLs(calls []*callanalyzer.CallTarget, endpointMap map[string]string, hosts map[string]string) map[serviceURL]bool {
+	calledURLs := make(map[serviceURL]bool)
+
+	for _, call := range calls {
+		targetServiceName, isResolved := findTargetNodeName(call, endpointMap, hosts)
+		if !isResolved || targetServiceName == call.ServiceName {
+			continue
+		}
+
+		calledURLs[serviceURL{service: targetServiceName, url: call.RequestLocation}] = true
+
+		// an annotated target service can be combined with a full URL, of which only the path identifies the endpoint
+		if parsedURL, err := url.Parse(call.RequestLocation); err == nil && parsedURL.Host != "" {
+			calledURLs[serviceURL{service: targetServiceName, url: parsedURL.Path}] = true
+		}
+	}
+
+	return calledURLs
+}
+
+// isPublicRoute checks whether the route of the endpoint matches one of the public route patterns.
+// Patterns are either a route ("/health") or a route of a specific service ("service-1:/health"),
+// and may contain wildcards as supported by path.Match.
+func isPublicRoute(endpoint *callanalyzer.CallTarget, publicRoutes []string) bool {
+	for _, pattern := range publicRoutes {
+		servicePattern, routePattern := "*", pattern
+		if parts := strings.SplitN(pattern, ":", 2); len(parts) == 2 && !strings.HasPrefix(pattern, ":") { //nolint:gomnd
+			servicePattern, routePattern = parts[0], parts[1]
+		}
+
+		serviceMatches, err := path.Match(servicePattern, endpoint.ServiceName)
+		if err != nil || !serviceMatches {
+			continue
+		}
+
+		if routeMatches, err := path.Match(routePattern, endpoint.RequestLocation); err == nil && routeMatches {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FindUnusedEndpoints finds the endpoints that are not matched by any client call, grouped by service.
+// Port definitions, unresolved endpoints, endpoints annotated as public and endpoints
+// matching one of the publicRoutes patterns are left out.
+func FindUnusedEndpoints(dependencies *structures.Dependencies, publicRoutes []string) map[string][]output.UnusedEndpoint {
+	unusedEndpoints := make(map[string][]output.UnusedEndpoint)
+	if dependencies == nil {
+		return unusedEndpoints
+	}
+
+	portMap := createBasicPortMap(dependencies.Endpoints)
+	calledURLs := findCalledURLs(dependencies.Calls, createEndpointMap(dependencies.Endpoints), dependencies.Hosts)
+
+	for _, endpoint := range dependencies.Endpoints {
+		isPortDefinition := len(endpoint.RequestLocation) >= 1 && endpoint.RequestLocation[0] == ':'
+		if !endpoint.IsResolved || endpoint.IsPublic || isPortDefinition || isPublicRoute(endpoint, publicRoutes) {
+			continue
+		}
+
+		port, ok := portMap[endpoint.ServiceName]
+		if !ok {
+			port = ":80"
+		}
+
+		isCalled := false
+		for _, endpointURL := range endpointURLs(endpoint, port) {
+			if calledURLs[serviceURL{service: endpoint.ServiceName, url: endpointURL}] {
+				isCalled = true
+				break
+			}
+		}
+
+		if !isCalled {
+			unusedEndpoints[endpoint.ServiceName] = append(unusedEndpoints[endpoint.ServiceName], output.UnusedEndpoint{
+				Route:     endpoint.RequestLocation,
+				Locations: endpoint.TraceAsStringArray(),
+			})
+		}
+	}
+
+	return unusedEndpoints
+}
@@ -0,0 +1,59 @@
+package matching
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+	"lab.weave.nl/internships/tud-2022/netDep/structures"
+)
+
+// endpoint creates a resolved endpoint of the service, registered at the given line of main.go
+func endpoint(service, route, line string) *callanalyzer.CallTarget {
+	return &callanalyzer.CallTarget{
+		RequestLocation: route,
+		IsResolved:      true,
+		ServiceName:     service,
+		Trace:           []callanalyzer.CallTargetTrace{{FileName: service + "/main.go", PositionInFile: line}},
+	}
+}
+
+func TestFindUnusedEndpoints(t *testing.T) {
+	public := endpoint("Node2", "/webhook", "14")
+	public.IsPublic = true
+	unresolved := endpoint("Node2", "", "15")
+	unresolved.IsResolved = false
+
+	dependencies := &structures.Dependencies{
+		Calls: []*callanalyzer.CallTarget{
+			{RequestLocation: "http://Node2:8080/used", IsResolved: true, ServiceName: "Node1"},
+			{RequestLocation: "http://node-3.internal/annotated", IsResolved: true, ServiceName: "Node1", TargetSvc: "Node3"},
+			// calls of a service to itself are not part of the graph
+			{RequestLocation: "http://Node3:80/self", IsResolved: true, ServiceName: "Node3"},
+		},
+		Endpoints: []*callanalyzer.CallTarget{
+			endpoint("Node2", ":8080", "10"),
+			endpoint("Node2", "/used", "11"),
+			endpoint("Node2", "/unused", "12"),
+			endpoint("Node2", "/health", "13"),
+			public,
+			unresolved,
+			endpoint("Node3", "/annotated", "20"),
+			endpoint("Node3", "/self", "21"),
+			endpoint("Node3", "/api/v1", "22"),
+		},
+	}
+
+	unused := FindUnusedEndpoints(dependencies, []string{"/health", "Node3:/api/*"})
+
+	assert.Equal(t, map[string][]output.UnusedEndpoint{
+		"Node2": {{Route: "/unused", Locations: []string{"Node2/main.go:12"}}},
+		"Node3": {{Route: "/self", Locations: []string{"Node3/main.go:21"}}},
+	}, unused)
+}
+
+func TestFindUnusedEndpointsNil(t *testing.T) {
+	assert.Empty(t, FindUnusedEndpoints(nil, nil))
+}
@@ -4,7 +4,9 @@ package matching
 
 import (
 	"fmt"
+	"net/url"
 	"sort"
+	"strings"
 
 	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/natsanalyzer"
 	"lab.weave.nl/internships/tud-2022/netDep/structures"
@@ -80,22 +82,24 @@ func createEndpointMap(endpoints []*callanalyzer.CallTarget) map[string]string {
 			portMap[call.ServiceName] = ":80"
 		}
 
-		port := portMap[call.ServiceName]
-
-		if call.RequestLocation == "" || call.RequestLocation[0] == '/' {
-			// register request
-			endpointURL := fmt.Sprintf("http://%s%s%s", call.ServiceName, port, call.RequestLocation)
-			endpointMap[endpointURL] = call.ServiceName
-		} else if call.PackageName == "servicecalls" {
-			endpointURL := call.RequestLocation
+		for _, endpointURL := range endpointURLs(call, portMap[call.ServiceName]) {
 			endpointMap[endpointURL] = call.ServiceName
 		}
-		endpointMap[call.RequestLocation] = call.ServiceName
 	}
 
 	return endpointMap
 }
 
+// endpointURLs returns the URLs under which an endpoint can be called, given the port of its service
+func endpointURLs(call *callanalyzer.CallTarget, port string) []string {
+	if call.RequestLocation == "" || call.RequestLocation[0] == '/' {
+		// register request
+		return []string{fmt.Sprintf("http://%s%s%s", call.ServiceName, port, call.RequestLocation), call.RequestLocation}
+	}
+
+	return []string{call.RequestLocation}
+}
+
 // CreateDependencyGraph creates the nodes and edges of a dependency graph, given the discovered calls and endpoints
 func CreateDependencyGraph(dependencies *structures.Dependencies) output.NodeGraph {
 	if dependencies == nil {
@@ -119,7 +123,7 @@ func CreateDependencyGraph(dependencies *structures.Dependencies) output.NodeGra
 	for _, call := range dependencies.Calls {
 		sourceNode := serviceMap[call.ServiceName]
 		sourceNode.IsReferencing = true
-		targetServiceName, isResolved := findTargetNodeName(call, endpointMap)
+		targetServiceName, isResolved := findTargetNodeName(call, endpointMap, dependencies.Hosts)
 
 		var targetNode *output.ServiceNode
 
@@ -150,6 +154,10 @@ func CreateDependencyGraph(dependencies *structures.Dependencies) output.NodeGra
 		url := call.RequestLocation
 		methodName := ""
 
+		if call.Protocol != "" {
+			protocol = call.Protocol
+		}
+
 		// If the call was discovered via servicecalls package scanning
 		// Edit the values with the servicecalls specific data
 		if call.PackageName == "servicecalls" {
@@ -165,6 +173,7 @@ func CreateDependencyGraph(dependencies *structures.Dependencies) output.NodeGra
 				Arguments:  nil,
 				MethodName: methodName,
 				Locations:  call.TraceAsStringArray(),
+				Declared:   call.IsDeclared,
 			},
 			Source: sourceNode,
 			Target: targetNode,
@@ -192,10 +201,10 @@ func sortNodes(nodes *[]*output.ServiceNode) {
 
 // findTargetNodeName returns a name of the target service
 // If call was unresolved in discovery stage it by default returns false
-// If call was resolved, but the endpointMap does not contain the URL,
+// If call was resolved, but neither the endpointMap contains the URL nor the host of the URL is mapped to a service,
 // then empty string and false is returned.
 // Otherwise, a name of the target service is returned.
-func findTargetNodeName(call *callanalyzer.CallTarget, endpointMap map[string]string) (string, bool) {
+func findTargetNodeName(call *callanalyzer.CallTarget, endpointMap map[string]string, hosts map[string]string) (string, bool) {
 	if !call.IsResolved {
 		return "", false
 	}
@@ -206,9 +215,31 @@ func findTargetNodeName(call *callanalyzer.CallTarget, endpointMap map[string]st
 
 	// TODO improve matching, compare URL
 	// TODO handle dynamic urls like "/_var"
-	targetServiceName, hasTarget := endpointMap[call.RequestLocation]
+	if targetServiceName, hasTarget := endpointMap[call.RequestLocation]; hasTarget {
+		return targetServiceName, true
+	}
+
+	return findMappedService(call.RequestLocation, hosts)
+}
+
+// findMappedService returns the service that the host of the URL is mapped to.
+// The host together with its port is looked up first, and then the host on its own.
+func findMappedService(requestLocation string, hosts map[string]string) (string, bool) {
+	if len(hosts) == 0 {
+		return "", false
+	}
+
+	parsedURL, err := url.Parse(requestLocation)
+	if err != nil || parsedURL.Host == "" {
+		return "", false
+	}
+
+	if service, ok := hosts[parsedURL.Host]; ok {
+		return service, true
+	}
 
-	return targetServiceName, hasTarget
+	service, ok := hosts[parsedURL.Hostname()]
+	return service, ok
 }
 
 // extendWithNats extends the Connection Edges data structure
@@ -236,7 +267,8 @@ func extendWithNats(consumers []*natsanalyzer.NatsCall, producers []*natsanalyze
 	for _, producer := range producers {
 		hasConsumer := false
 		for _, consumer := range consumers {
-			if producer.Subject == consumer.Subject {
+			// a subject is only consumed by subscribers using the same protocol, such as a Kafka topic by Kafka consumers
+			if producer.Subject == consumer.Subject && strings.EqualFold(producer.Communication, consumer.Communication) {
 				hasConsumer = true
 				edge := &output.ConnectionEdge{
 					Call: output.NetworkCall{
@@ -246,6 +278,7 @@ func extendWithNats(consumers []*natsanalyzer.NatsCall, producers []*natsanalyze
 						Arguments: nil,
 						// TODO: handle stack trace?
 						Locations: []string{fmt.Sprintf("%s:%s", producer.FileName, producer.PositionInFile)},
+						Declared:  producer.IsDeclared,
 					},
 					// Always hits, because services was populated using consumers and producers
 					Source: services[producer.ServiceName],
@@ -265,6 +298,7 @@ func extendWithNats(consumers []*natsanalyzer.NatsCall, producers []*natsanalyze
 					Arguments: nil,
 					// TODO: handle stack trace?
 					Locations: []string{fmt.Sprintf("%s:%s", producer.FileName, producer.PositionInFile)},
+					Declared:  producer.IsDeclared,
 				},
 				// Always hits, because services was populated using consumers and producers
 				Source: services[producer.ServiceName],
@@ -333,6 +333,76 @@ func TestWithUnknownService(t *testing.T) {
 	}
 }
 
+func TestCreateDependencyGraphWithHosts(t *testing.T) {
+	dependencies := &structures.Dependencies{
+		Calls: []*callanalyzer.CallTarget{
+			{RequestLocation: "http://users.internal:8080/users", IsResolved: true, ServiceName: "orders"},
+			{RequestLocation: "http://users-api/users", IsResolved: true, ServiceName: "orders"},
+			{RequestLocation: "http://billing.internal/invoices", IsResolved: true, ServiceName: "orders"},
+		},
+		Endpoints: []*callanalyzer.CallTarget{
+			{RequestLocation: "/users", IsResolved: true, ServiceName: "users"},
+		},
+		Hosts: map[string]string{
+			"users.internal:8080": "users",
+			"users-api":           "users",
+			"billing.internal":    "billing", // billing is not one of the analysed services
+		},
+	}
+
+	graph := CreateDependencyGraph(dependencies)
+
+	assert.Equal(t, 3, len(graph.Edges))
+	assert.Equal(t, "users", graph.Edges[0].Target.ServiceName)
+	assert.Equal(t, "users", graph.Edges[1].Target.ServiceName)
+	assert.Equal(t, "UnknownService", graph.Edges[2].Target.ServiceName)
+}
+
+func TestCreateDependencyGraphWithDeclaredDependencies(t *testing.T) {
+	dependencies := &structures.Dependencies{
+		Calls: []*callanalyzer.CallTarget{
+			callanalyzer.NewDeclaredTarget("orders", "users", "", "/v1/users", nil),
+			callanalyzer.NewDeclaredTarget("orders", "", "NATS", "/payments", nil),
+		},
+		Endpoints: []*callanalyzer.CallTarget{
+			{RequestLocation: "/v1/users", IsResolved: true, ServiceName: "users"},
+			{RequestLocation: "/payments", IsResolved: true, ServiceName: "payments"},
+		},
+	}
+
+	graph := CreateDependencyGraph(dependencies)
+
+	assert.Equal(t, 2, len(graph.Edges))
+	assert.Equal(t, "users", graph.Edges[0].Target.ServiceName)
+	assert.Equal(t, "HTTP", graph.Edges[0].Call.Protocol)
+	assert.True(t, graph.Edges[0].Call.Declared)
+	assert.Equal(t, "payments", graph.Edges[1].Target.ServiceName)
+	assert.Equal(t, "NATS", graph.Edges[1].Call.Protocol)
+	assert.True(t, graph.Edges[1].Call.Declared)
+}
+
+func TestFindMappedService(t *testing.T) {
+	hosts := map[string]string{"users.internal:8080": "users", "users.internal": "users-v1"}
+
+	tests := []struct {
+		url     string
+		service string
+		ok      bool
+	}{
+		{url: "http://users.internal:8080/users", service: "users", ok: true},
+		{url: "http://users.internal/users", service: "users-v1", ok: true},
+		{url: "http://users.internal:9090/users", service: "users-v1", ok: true},
+		{url: "http://billing.internal/invoices", ok: false},
+		{url: "/users", ok: false},
+	}
+
+	for _, test := range tests {
+		service, ok := findMappedService(test.url, hosts)
+		assert.Equal(t, test.service, service, test.url)
+		assert.Equal(t, test.ok, ok, test.url)
+	}
+}
+
 func TestNatsExtension(t *testing.T) {
 	call1 := &natsanalyzer.NatsCall{
 		Communication:  "NATS",
@@ -414,3 +484,32 @@ func TestNatsExtension(t *testing.T) {
 	assert.Equal(t, edges[2].Call.URL, "AyoSubject")
 	assert.Equal(t, edges[2].Target.ServiceName, "UnknownService")
 }
+
+func TestNatsExtensionDeclaredCalls(t *testing.T) {
+	consumers := []*natsanalyzer.NatsCall{
+		{Communication: "NATS", Subject: "orders", ServiceName: "billing", FileName: "billing/main.go", PositionInFile: "3"},
+	}
+	producers := []*natsanalyzer.NatsCall{
+		{Communication: "Kafka", Subject: "orders", ServiceName: "orders", FileName: "orders/main.go", PositionInFile: "4", IsDeclared: true},
+		{Communication: "nats", Subject: "orders", ServiceName: "orders", FileName: "orders/main.go", PositionInFile: "8", IsDeclared: true},
+	}
+
+	serviceMap := map[string]*output.ServiceNode{
+		"billing": {ServiceName: "billing"},
+		"orders":  {ServiceName: "orders"},
+	}
+
+	hasUnknown := false
+	nodes := make([]*output.ServiceNode, 0)
+
+	edges := extendWithNats(consumers, producers, &hasUnknown, serviceMap, &nodes)
+
+	// the Kafka topic is not consumed by the NATS subscriber of the same name
+	assert.Equal(t, 2, len(edges))
+	assert.Equal(t, "UnknownService", edges[0].Target.ServiceName)
+	assert.Equal(t, "Kafka", edges[0].Call.Protocol)
+	assert.True(t, edges[0].Call.Declared)
+	assert.Equal(t, "billing", edges[1].Target.ServiceName)
+	assert.Equal(t, []string{"orders/main.go:8"}, edges[1].Call.Locations)
+	assert.True(t, edges[1].Call.Declared)
+}
@@ -0,0 +1,325 @@
+// Package output defines the different ways of output in the tool
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package output
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// The protocol selections for which cycles can be detected
+const (
+	AllProtocols   = "all"   // AllProtocols considers every edge
+	SyncProtocols  = "sync"  // SyncProtocols only considers request-response calls, such as HTTP, gRPC and servicecalls
+	AsyncProtocols = "async" // AsyncProtocols only considers message-based communication, such as NATS
+)
+
+// maxReportedCycles limits the number of elementary cycles that are listed,
+// as their number can grow exponentially in densely connected graphs
+const maxReportedCycles = 1000
+
+// CycleHop is a single step of a cycle, together with the calls that form it
+type CycleHop struct {
+	Source string        `json:"source"`
+	Target string        `json:"target"`
+	Calls  []NetworkCall `json:"calls"`
+}
+
+// Cycle is a circular dependency between services
+type Cycle struct {
+	Services []string   `json:"services"`
+	Hops     []CycleHop `json:"hops"`
+}
+
+// CycleReport holds the strongly connected components of the dependency graph
+// (with more than one service) and the elementary cycles within them
+type CycleReport struct {
+	Protocols  string     `json:"protocols"`
+	Components [][]string `json:"components"`
+	Cycles     []Cycle    `json:"cycles"`
+	Truncated  bool       `json:"truncated,omitempty"`
+}
+
+// IsValidProtocolSelection checks whether the protocol selection is one of AllProtocols, SyncProtocols or AsyncProtocols
+func IsValidProtocolSelection(protocols string) bool {
+	return protocols == AllProtocols || protocols == SyncProtocols || protocols == AsyncProtocols
+}
+
+// IsAsyncProtocol returns whether the protocol is message-based
+func IsAsyncProtocol(protocol string) bool {
+	switch strings.ToUpper(protocol) {
+	case natsProtocol, "KAFKA", "AMQP", "MQTT":
+		return true
+	default:
+		return false
+	}
+}
+
+// isProtocolSelected returns whether a call using the protocol is part of the protocol selection
+func isProtocolSelected(protocol, protocols string) bool {
+	switch protocols {
+	case SyncProtocols:
+		return !IsAsyncProtocol(protocol)
+	case AsyncProtocols:
+		return IsAsyncProtocol(protocol)
+	default:
+		return true
+	}
+}
+
+// callGraph is an adjacency representation of the graph, restricted to known services and the selected protocols
+type callGraph struct {
+	services []string                            // services are sorted alphabetically
+	adjacent map[string][]string                 // adjacent maps a service to the (sorted) services it calls
+	calls    map[string]map[string][]NetworkCall // calls maps source and target to the calls between them
+}
+
+// newCallGraph creates a callGraph from the NodeGraph, only keeping edges of the selected protocols
+func newCallGraph(graph NodeGraph, protocols string) *callGraph {
+	callGraph := &callGraph{
+		services: make([]string, 0),
+		adjacent: make(map[string][]string),
+		calls:    make(map[string]map[string][]NetworkCall),
+	}
+
+	for _, node := range graph.Nodes {
+		if !node.IsUnknown {
+			callGraph.services = append(callGraph.services, node.ServiceName)
+		}
+	}
+	sort.Strings(callGraph.services)
+
+	for _, edge := range graph.Edges {
+		if edge.Source.IsUnknown || edge.Target.IsUnknown || !isProtocolSelected(edge.Call.Protocol, protocols) {
+			continue
+		}
+
+		source, target := edge.Source.ServiceName, edge.Target.ServiceName
+		if _, ok := callGraph.calls[source]; !ok {
+			callGraph.calls[source] = make(map[string][]NetworkCall)
+		}
+
+		if _, ok := callGraph.calls[source][target]; !ok {
+			callGraph.adjacent[source] = append(callGraph.adjacent[source], target)
+		}
+		callGraph.calls[source][target] = append(callGraph.calls[source][target], edge.Call)
+	}
+
+	for _, targets := range callGraph.adjacent {
+		sort.Strings(targets)
+	}
+
+	return callGraph
+}
+
+// tarjanState holds the bookkeeping of Tarjan's strongly connected components algorithm
+type tarjanState struct {
+	graph      *callGraph
+	index      map[string]int
+	lowLink    map[string]int
+	onStack    map[string]bool
+	stack      []string
+	nextIndex  int
+	components [][]string
+}
+
+// strongConnect visits a service, and collects the component of which it is the root
+func (state *tarjanState) strongConnect(service string) {
+	state.index[service] = state.nextIndex
+	state.lowLink[service] = state.nextIndex
+	state.nextIndex++
+	state.stack = append(state.stack, service)
+	state.onStack[service] = true
+
+	for _, target := range state.graph.adjacent[service] {
+		if _, visited := state.index[target]; !visited {
+			state.strongConnect(target)
+			if state.lowLink[target] < state.lowLink[service] {
+				state.lowLink[service] = state.lowLink[target]
+			}
+		} else if state.onStack[target] && state.index[target] < state.lowLink[service] {
+			state.lowLink[service] = state.index[target]
+		}
+	}
+
+	if state.lowLink[service] != state.index[service] {
+		return
+	}
+
+	component := make([]string, 0)
+	for {
+		top := state.stack[len(state.stack)-1]
+		state.stack = state.stack[:len(state.stack)-1]
+		state.onStack[top] = false
+		component = append(component, top)
+
+		if top == service {
+			break
+		}
+	}
+
+	sort.Strings(component)
+	state.components = append(state.components, component)
+}
+
+// stronglyConnectedComponents returns the components of the callGraph, each sorted alphabetically
+func (graph *callGraph) stronglyConnectedComponents() [][]string {
+	state := &tarjanState{
+		graph:   graph,
+		index:   make(map[string]int),
+		lowLink: make(map[string]int),
+		onStack: make(map[string]bool),
+		stack:   make([]string, 0),
+	}
+
+	for _, service := range graph.services {
+		if _, visited := state.index[service]; !visited {
+			state.strongConnect(service)
+		}
+	}
+
+	return state.components
+}
+
+// findCyclesInComponent lists the elementary cycles within a component. Each cycle is found exactly once,
+// starting from its alphabetically smallest service. Returns false if the search was cut off at limit cycles.
+func (graph *callGraph) findCyclesInComponent(component []string, limit int) ([][]string, bool) {
+	inComponent := make(map[string]bool)
+	for _, service := range component {
+		inComponent[service] = true
+	}
+
+	cycles := make([][]string, 0)
+	complete := true
+
+	var search func(start string, path []string, onPath map[string]bool)
+	search = func(start string, path []string, onPath map[string]bool) {
+		current := path[len(path)-1]
+
+		for _, target := range graph.adjacent[current] {
+			if len(cycles) >= limit {
+				complete = false
+				return
+			}
+
+			// only consider services within the component that come after the start,
+			// so that every cycle is reported from its smallest service only
+			if !inComponent[target] || target < start {
+				continue
+			}
+
+			if target == start {
+				cycle := make([]string, len(path))
+				copy(cycle, path)
+				cycles = append(cycles, cycle)
+			} else if !onPath[target] {
+				onPath[target] = true
+				search(start, append(path, target), onPath)
+				onPath[target] = false
+			}
+		}
+	}
+
+	for _, start := range component {
+		search(start, []string{start}, map[string]bool{start: true})
+	}
+
+	return cycles, complete
+}
+
+// toCycle creates a Cycle from the list of services that form it
+func (graph *callGraph) toCycle(services []string) Cycle {
+	hops := make([]CycleHop, 0, len(services))
+
+	for i, source := range services {
+		target := services[(i+1)%len(services)]
+		hops = append(hops, CycleHop{
+			Source: source,
+			Target: target,
+			Calls:  graph.calls[source][target],
+		})
+	}
+
+	return Cycle{
+		Services: services,
+		Hops:     hops,
+	}
+}
+
+// FindCycles finds the strongly connected components of the graph and lists each of the cycles,
+// only taking into account the calls of the selected protocols (AllProtocols, SyncProtocols or AsyncProtocols).
+// Unknown services are never part of a cycle.
+func FindCycles(graph NodeGraph, protocols string) CycleReport {
+	callGraph := newCallGraph(graph, protocols)
+
+	report := CycleReport{
+		Protocols:  protocols,
+		Components: make([][]string, 0),
+		Cycles:     make([]Cycle, 0),
+	}
+
+	for _, component := range callGraph.stronglyConnectedComponents() {
+		// a single service can not form a cycle, as self-references are not part of the graph
+		if len(component) > 1 {
+			report.Components = append(report.Components, component)
+		}
+	}
+
+	sort.Slice(report.Components, func(i, j int) bool {
+		return report.Components[i][0] < report.Components[j][0]
+	})
+
+	for _, component := range report.Components {
+		cycles, complete := callGraph.findCyclesInComponent(component, maxReportedCycles-len(report.Cycles))
+		for _, cycle := range cycles {
+			report.Cycles = append(report.Cycles, callGraph.toCycle(cycle))
+		}
+
+		if !complete {
+			report.Truncated = true
+			break
+		}
+	}
+
+	return report
+}
+
+// PrintCycles prints the circular dependencies that were found
+func PrintCycles(report CycleReport) {
+	if len(report.Cycles) == 0 {
+		return
+	}
+
+	color.Yellow("Found %d circular dependencies (protocols: %s):", len(report.Cycles), report.Protocols)
+	for _, cycle := range report.Cycles {
+		color.Yellow("\t%s", cycle)
+
+		for _, hop := range cycle.Hops {
+			for _, call := range hop.Calls {
+				color.HiWhite("\t\t%s -> %s: %s", hop.Source, hop.Target, formatCall(call))
+			}
+		}
+	}
+
+	if report.Truncated {
+		color.Yellow("\tOnly the first %d cycles are listed", maxReportedCycles)
+	}
+}
+
+// String formats the cycle as "a -> b -> a"
+func (c Cycle) String() string {
+	return strings.Join(c.Services, " -> ") + " -> " + c.Services[0]
+}
+
+// formatCall describes a call using its protocol, URL or method, and locations
+func formatCall(call NetworkCall) string {
+	target := call.URL
+	if target == "" {
+		target = call.MethodName
+	}
+
+	return fmt.Sprintf("[%s] %s %s", call.Protocol, target, strings.Join(call.Locations, ", "))
+}
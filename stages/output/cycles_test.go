@@ -0,0 +1,96 @@
+// Package output
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+
+package output
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createCyclicTestGraph creates a graph with the HTTP cycles A -> B -> A and A -> B -> C -> A,
+// a NATS cycle C -> D -> C, and an edge from D to an unknown service
+func createCyclicTestGraph() NodeGraph {
+	nodeA := &ServiceNode{ServiceName: "A"}
+	nodeB := &ServiceNode{ServiceName: "B"}
+	nodeC := &ServiceNode{ServiceName: "C"}
+	nodeD := &ServiceNode{ServiceName: "D"}
+	unknown := &ServiceNode{ServiceName: "UnknownService", IsUnknown: true}
+
+	edge := func(source, target *ServiceNode, protocol, url string) *ConnectionEdge {
+		return &ConnectionEdge{
+			Call:   NetworkCall{Protocol: protocol, URL: url, Locations: []string{source.ServiceName + "/main.go:1"}},
+			Source: source,
+			Target: target,
+		}
+	}
+
+	return NodeGraph{
+		Nodes: []*ServiceNode{nodeA, nodeB, nodeC, nodeD, unknown},
+		Edges: []*ConnectionEdge{
+			edge(nodeA, nodeB, "HTTP", "http://B:80/"),
+			edge(nodeB, nodeA, "HTTP", "http://A:80/"),
+			edge(nodeB, nodeC, "servicecalls", ""),
+			edge(nodeC, nodeA, "HTTP", "http://A:80/c"),
+			edge(nodeC, nodeD, "NATS", "DSubject"),
+			edge(nodeD, nodeC, "NATS", "CSubject"),
+			edge(nodeD, unknown, "HTTP", ""),
+			edge(unknown, nodeD, "HTTP", ""),
+		},
+	}
+}
+
+func TestFindCyclesAllProtocols(t *testing.T) {
+	report := FindCycles(createCyclicTestGraph(), AllProtocols)
+
+	assert.Equal(t, [][]string{{"A", "B", "C", "D"}}, report.Components)
+	assert.Equal(t, 3, len(report.Cycles))
+	assert.Equal(t, []string{"A", "B"}, report.Cycles[0].Services)
+	assert.Equal(t, []string{"A", "B", "C"}, report.Cycles[1].Services)
+	assert.Equal(t, []string{"C", "D"}, report.Cycles[2].Services)
+	assert.False(t, report.Truncated)
+}
+
+func TestFindCyclesSyncProtocols(t *testing.T) {
+	report := FindCycles(createCyclicTestGraph(), SyncProtocols)
+
+	assert.Equal(t, [][]string{{"A", "B", "C"}}, report.Components)
+	assert.Equal(t, 2, len(report.Cycles))
+
+	// each hop holds the calls forming it
+	hops := report.Cycles[1].Hops
+	assert.Equal(t, 3, len(hops))
+	assert.Equal(t, "B", hops[1].Source)
+	assert.Equal(t, "C", hops[1].Target)
+	assert.Equal(t, "servicecalls", hops[1].Calls[0].Protocol)
+	assert.Equal(t, "C", hops[2].Source)
+	assert.Equal(t, "A", hops[2].Target)
+	assert.Equal(t, []string{"C/main.go:1"}, hops[2].Calls[0].Locations)
+}
+
+func TestFindCyclesAsyncProtocols(t *testing.T) {
+	report := FindCycles(createCyclicTestGraph(), AsyncProtocols)
+
+	assert.Equal(t, [][]string{{"C", "D"}}, report.Components)
+	assert.Equal(t, 1, len(report.Cycles))
+	assert.Equal(t, "NATS", report.Cycles[0].Hops[0].Calls[0].Protocol)
+}
+
+func TestFindCyclesAcyclic(t *testing.T) {
+	report := FindCycles(createSmallTestGraph(), AllProtocols)
+
+	assert.Empty(t, report.Components)
+	assert.Empty(t, report.Cycles)
+	PrintCycles(report)
+}
+
+func TestIsValidProtocolSelection(t *testing.T) {
+	assert.True(t, IsValidProtocolSelection(SyncProtocols))
+	assert.False(t, IsValidProtocolSelection("grpc"))
+}
+
+// TestPrintCycles runs the printing method so the coverage isn't affected
+func TestPrintCycles(t *testing.T) {
+	PrintCycles(FindCycles(createCyclicTestGraph(), AllProtocols))
+}
@@ -0,0 +1,361 @@
+// Package output defines the different ways of output in the tool
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DiffEdge identifies a dependency independently of the order in which its calls were discovered.
+// For calls without a URL (e.g. servicecalls) the method name is used in place of the URL.
+type DiffEdge struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Protocol string `json:"protocol"`
+	URL      string `json:"url"`
+}
+
+// ChangedEdge holds a dependency between the same two services of which the URL or the protocol changed
+type ChangedEdge struct {
+	Old DiffEdge `json:"old"`
+	New DiffEdge `json:"new"`
+}
+
+// GraphDiff describes the changes between two dependency graphs
+type GraphDiff struct {
+	AddedServices   []string      `json:"addedServices"`
+	RemovedServices []string      `json:"removedServices"`
+	AddedEdges      []DiffEdge    `json:"addedEdges"`
+	RemovedEdges    []DiffEdge    `json:"removedEdges"`
+	ChangedEdges    []ChangedEdge `json:"changedEdges"`
+	// AddedCycles and RemovedCycles are the circular dependencies that were introduced and resolved, as "a -> b -> a"
+	AddedCycles   []string `json:"addedCycles"`
+	RemovedCycles []string `json:"removedCycles"`
+}
+
+// IsEmpty returns whether the two compared graphs are equivalent
+func (d *GraphDiff) IsEmpty() bool {
+	return len(d.AddedServices) == 0 && len(d.RemovedServices) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0 && len(d.ChangedEdges) == 0 &&
+		len(d.AddedCycles) == 0 && len(d.RemovedCycles) == 0
+}
+
+// String formats an edge as "source -> target [protocol] url"
+func (e DiffEdge) String() string {
+	return fmt.Sprintf("%s -> %s [%s] %s", e.Source, e.Target, e.Protocol, e.URL)
+}
+
+// ParseAdjacencyList deserialises the dependencies from the JSON output of a previous analysis.
+// Both a bare AdjacencyList and a Document (as written with --report) are accepted.
+func ParseAdjacencyList(data []byte) (AdjacencyList, error) {
+	document := Document{}
+	if err := json.Unmarshal(data, &document); err == nil && document.Dependencies != nil {
+		return document.Dependencies, nil
+	}
+
+	adjacencyList := make(AdjacencyList)
+
+	err := json.Unmarshal(data, &adjacencyList)
+	if err != nil {
+		return nil, fmt.Errorf("the analysis result cannot be parsed: %w", err)
+	}
+
+	return adjacencyList, nil
+}
+
+// edgeSet collects the distinct edges of an adjacency list, as a set
+func edgeSet(adjacencyList AdjacencyList) map[DiffEdge]bool {
+	edges := make(map[DiffEdge]bool)
+
+	for source, targets := range adjacencyList {
+		for _, target := range targets {
+			for _, call := range target.Calls {
+				url := call.URL
+				if url == "" {
+					url = call.MethodName
+				}
+
+				edges[DiffEdge{
+					Source:   source,
+					Target:   target.Service,
+					Protocol: call.Protocol,
+					URL:      url,
+				}] = true
+			}
+		}
+	}
+
+	return edges
+}
+
+// edgeDifference returns the sorted list of edges that are in a but not in b
+func edgeDifference(a, b map[DiffEdge]bool) []DiffEdge {
+	difference := make([]DiffEdge, 0)
+
+	for edge := range a {
+		if !b[edge] {
+			difference = append(difference, edge)
+		}
+	}
+
+	sortDiffEdges(difference)
+
+	return difference
+}
+
+// sortDiffEdges sorts edges on source, target, protocol and URL (to keep the output stable)
+func sortDiffEdges(edges []DiffEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		x, y := edges[i], edges[j]
+		if x.Source != y.Source {
+			return x.Source < y.Source
+		}
+		if x.Target != y.Target {
+			return x.Target < y.Target
+		}
+		if x.Protocol != y.Protocol {
+			return x.Protocol < y.Protocol
+		}
+		return x.URL < y.URL
+	})
+}
+
+// serviceDifference returns the sorted list of services that are in a but not in b
+func serviceDifference(a, b AdjacencyList) []string {
+	difference := make([]string, 0)
+
+	for service := range a {
+		if _, ok := b[service]; !ok {
+			difference = append(difference, service)
+		}
+	}
+
+	sort.Strings(difference)
+
+	return difference
+}
+
+// cycleSet collects the circular dependencies of an adjacency list over all protocols, formatted using Cycle.String
+func cycleSet(adjacencyList AdjacencyList) map[string]bool {
+	nodes := make(map[string]*ServiceNode)
+	node := func(service string) *ServiceNode {
+		if _, ok := nodes[service]; !ok {
+			// services that are only called are not part of the analysis, and thus unknown
+			_, isAnalysed := adjacencyList[service]
+			nodes[service] = &ServiceNode{ServiceName: service, IsUnknown: !isAnalysed}
+		}
+		return nodes[service]
+	}
+
+	graph := NodeGraph{Nodes: make([]*ServiceNode, 0), Edges: make([]*ConnectionEdge, 0)}
+	for source, targets := range adjacencyList {
+		for _, target := range targets {
+			for _, call := range target.Calls {
+				graph.Edges = append(graph.Edges, &ConnectionEdge{Call: call, Source: node(source), Target: node(target.Service)})
+			}
+		}
+	}
+	for _, serviceNode := range nodes {
+		graph.Nodes = append(graph.Nodes, serviceNode)
+	}
+
+	cycles := make(map[string]bool)
+	for _, cycle := range FindCycles(graph, AllProtocols).Cycles {
+		cycles[cycle.String()] = true
+	}
+
+	return cycles
+}
+
+// cycleDifference returns the sorted cycles of a that are not in b
+func cycleDifference(a, b map[string]bool) []string {
+	difference := make([]string, 0)
+
+	for cycle := range a {
+		if !b[cycle] {
+			difference = append(difference, cycle)
+		}
+	}
+
+	sort.Strings(difference)
+
+	return difference
+}
+
+// pairChangedEdges matches removed and added edges between the same two services, which
+// share either their protocol (the URL changed) or their URL (the protocol changed).
+// The edges that could be paired are removed from the added and removed lists.
+func pairChangedEdges(removed, added []DiffEdge) ([]ChangedEdge, []DiffEdge, []DiffEdge) {
+	changed := make([]ChangedEdge, 0)
+	remainingRemoved := make([]DiffEdge, 0)
+	isPaired := make([]bool, len(added))
+
+	for _, oldEdge := range removed {
+		pairIndex := -1
+
+		for i, newEdge := range added {
+			if isPaired[i] || oldEdge.Source != newEdge.Source || oldEdge.Target != newEdge.Target {
+				continue
+			}
+
+			if oldEdge.Protocol == newEdge.Protocol || oldEdge.URL == newEdge.URL {
+				pairIndex = i
+				break
+			}
+		}
+
+		if pairIndex == -1 {
+			remainingRemoved = append(remainingRemoved, oldEdge)
+			continue
+		}
+
+		isPaired[pairIndex] = true
+		changed = append(changed, ChangedEdge{Old: oldEdge, New: added[pairIndex]})
+	}
+
+	remainingAdded := make([]DiffEdge, 0)
+	for i, newEdge := range added {
+		if !isPaired[i] {
+			remainingAdded = append(remainingAdded, newEdge)
+		}
+	}
+
+	return changed, remainingRemoved, remainingAdded
+}
+
+// DiffAdjacencyLists compares two adjacency lists. Edges are matched on (source, target, protocol, URL),
+// so the order in which calls were discovered does not influence the result.
+func DiffAdjacencyLists(oldList, newList AdjacencyList) GraphDiff {
+	oldEdges := edgeSet(oldList)
+	newEdges := edgeSet(newList)
+
+	changed, removed, added := pairChangedEdges(edgeDifference(oldEdges, newEdges), edgeDifference(newEdges, oldEdges))
+	oldCycles := cycleSet(oldList)
+	newCycles := cycleSet(newList)
+
+	return GraphDiff{
+		AddedServices:   serviceDifference(newList, oldList),
+		RemovedServices: serviceDifference(oldList, newList),
+		AddedEdges:      added,
+		RemovedEdges:    removed,
+		ChangedEdges:    changed,
+		AddedCycles:     cycleDifference(newCycles, oldCycles),
+		RemovedCycles:   cycleDifference(oldCycles, newCycles),
+	}
+}
+
+// SerializeDiff serialises a GraphDiff in JSON format
+func SerializeDiff(diff GraphDiff) (string, error) {
+	output, err := json.MarshalIndent(diff, "", "\t")
+	if err != nil {
+		return "null", err
+	}
+
+	return string(output), nil
+}
+
+// FormatDiffText formats a GraphDiff as plain text, suitable for a terminal
+func FormatDiffText(diff GraphDiff) string {
+	if diff.IsEmpty() {
+		return "No changes in the dependency graph.\n"
+	}
+
+	var builder strings.Builder
+
+	writeSection := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		builder.WriteString(title + ":\n")
+		for _, line := range lines {
+			builder.WriteString("\t" + line + "\n")
+		}
+	}
+
+	writeSection("Added services", prefixAll("+ ", diff.AddedServices))
+	writeSection("Removed services", prefixAll("- ", diff.RemovedServices))
+	writeSection("Added dependencies", prefixAll("+ ", edgesToStrings(diff.AddedEdges)))
+	writeSection("Removed dependencies", prefixAll("- ", edgesToStrings(diff.RemovedEdges)))
+
+	changedLines := make([]string, 0, len(diff.ChangedEdges))
+	for _, change := range diff.ChangedEdges {
+		changedLines = append(changedLines, fmt.Sprintf("~ %s -> %s [%s] %s => [%s] %s",
+			change.Old.Source, change.Old.Target, change.Old.Protocol, change.Old.URL, change.New.Protocol, change.New.URL))
+	}
+	writeSection("Changed dependencies", changedLines)
+	writeSection("Added circular dependencies", prefixAll("+ ", diff.AddedCycles))
+	writeSection("Removed circular dependencies", prefixAll("- ", diff.RemovedCycles))
+
+	return builder.String()
+}
+
+// FormatDiffMarkdown formats a GraphDiff as markdown, suitable for e.g. a merge request comment
+func FormatDiffMarkdown(diff GraphDiff) string {
+	var builder strings.Builder
+
+	builder.WriteString("## Dependency graph changes\n\n")
+
+	if diff.IsEmpty() {
+		builder.WriteString("No changes in the dependency graph.\n")
+		return builder.String()
+	}
+
+	if len(diff.AddedServices) > 0 || len(diff.RemovedServices) > 0 {
+		builder.WriteString("### Services\n\n| Change | Service |\n|:-------|:--------|\n")
+		for _, service := range diff.AddedServices {
+			builder.WriteString(fmt.Sprintf("| added | `%s` |\n", service))
+		}
+		for _, service := range diff.RemovedServices {
+			builder.WriteString(fmt.Sprintf("| removed | `%s` |\n", service))
+		}
+		builder.WriteString("\n")
+	}
+
+	if len(diff.AddedEdges) > 0 || len(diff.RemovedEdges) > 0 || len(diff.ChangedEdges) > 0 {
+		builder.WriteString("### Dependencies\n\n| Change | Source | Target | Protocol | URL |\n|:-------|:-------|:-------|:---------|:----|\n")
+		for _, edge := range diff.AddedEdges {
+			builder.WriteString(fmt.Sprintf("| added | `%s` | `%s` | %s | `%s` |\n", edge.Source, edge.Target, edge.Protocol, edge.URL))
+		}
+		for _, edge := range diff.RemovedEdges {
+			builder.WriteString(fmt.Sprintf("| removed | `%s` | `%s` | %s | `%s` |\n", edge.Source, edge.Target, edge.Protocol, edge.URL))
+		}
+		for _, change := range diff.ChangedEdges {
+			builder.WriteString(fmt.Sprintf("| changed | `%s` | `%s` | %s → %s | `%s` → `%s` |\n",
+				change.Old.Source, change.Old.Target, change.Old.Protocol, change.New.Protocol, change.Old.URL, change.New.URL))
+		}
+		builder.WriteString("\n")
+	}
+
+	if len(diff.AddedCycles) > 0 || len(diff.RemovedCycles) > 0 {
+		builder.WriteString("### Circular dependencies\n\n| Change | Cycle |\n|:-------|:------|\n")
+		for _, cycle := range diff.AddedCycles {
+			builder.WriteString(fmt.Sprintf("| added | `%s` |\n", cycle))
+		}
+		for _, cycle := range diff.RemovedCycles {
+			builder.WriteString(fmt.Sprintf("| removed | `%s` |\n", cycle))
+		}
+	}
+
+	return builder.String()
+}
+
+// edgesToStrings formats each of the edges using DiffEdge.String
+func edgesToStrings(edges []DiffEdge) []string {
+	lines := make([]string, 0, len(edges))
+	for _, edge := range edges {
+		lines = append(lines, edge.String())
+	}
+	return lines
+}
+
+// prefixAll returns a copy of lines, with each line prefixed
+func prefixAll(prefix string, lines []string) []string {
+	prefixed := make([]string, 0, len(lines))
+	for _, line := range lines {
+		prefixed = append(prefixed, prefix+line)
+	}
+	return prefixed
+}
@@ -0,0 +1,147 @@
+// Package output
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+
+package output
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createDiffTestLists creates two adjacency lists, where Node3 was removed, Node4 was added,
+// the call from Node1 to Node2 changed its URL and the calls of Node1 were reordered
+func createDiffTestLists() (AdjacencyList, AdjacencyList) {
+	oldList := AdjacencyList{
+		"Node1": {
+			{Service: "Node2", Calls: []NetworkCall{{Protocol: "HTTP", URL: "http://Node2:80/old"}}, NumberOfCalls: 1},
+			{Service: "Node3", Calls: []NetworkCall{{Protocol: "HTTP", URL: "http://Node3:80/"}}, NumberOfCalls: 1},
+		},
+		"Node2": {
+			{Service: "Node1", Calls: []NetworkCall{
+				{Protocol: "HTTP", URL: "http://Node1:80/a"},
+				{Protocol: "servicecalls", MethodName: "GetA"},
+			}, NumberOfCalls: 2},
+		},
+		"Node3": {},
+	}
+
+	newList := AdjacencyList{
+		"Node1": {
+			{Service: "Node2", Calls: []NetworkCall{{Protocol: "HTTP", URL: "http://Node2:80/new"}}, NumberOfCalls: 1},
+			{Service: "Node4", Calls: []NetworkCall{{Protocol: "NATS", URL: "SomeSubject"}}, NumberOfCalls: 1},
+		},
+		"Node2": {
+			{Service: "Node1", Calls: []NetworkCall{
+				{Protocol: "servicecalls", MethodName: "GetA"},
+				{Protocol: "HTTP", URL: "http://Node1:80/a"},
+			}, NumberOfCalls: 2},
+		},
+		"Node4": {},
+	}
+
+	return oldList, newList
+}
+
+func TestDiffAdjacencyLists(t *testing.T) {
+	oldList, newList := createDiffTestLists()
+
+	diff := DiffAdjacencyLists(oldList, newList)
+
+	assert.Equal(t, []string{"Node4"}, diff.AddedServices)
+	assert.Equal(t, []string{"Node3"}, diff.RemovedServices)
+	assert.Equal(t, []DiffEdge{{Source: "Node1", Target: "Node4", Protocol: "NATS", URL: "SomeSubject"}}, diff.AddedEdges)
+	assert.Equal(t, []DiffEdge{{Source: "Node1", Target: "Node3", Protocol: "HTTP", URL: "http://Node3:80/"}}, diff.RemovedEdges)
+	assert.Equal(t, []ChangedEdge{{
+		Old: DiffEdge{Source: "Node1", Target: "Node2", Protocol: "HTTP", URL: "http://Node2:80/old"},
+		New: DiffEdge{Source: "Node1", Target: "Node2", Protocol: "HTTP", URL: "http://Node2:80/new"},
+	}}, diff.ChangedEdges)
+}
+
+func TestDiffAdjacencyListsEqual(t *testing.T) {
+	oldList, _ := createDiffTestLists()
+
+	diff := DiffAdjacencyLists(oldList, oldList)
+
+	assert.True(t, diff.IsEmpty())
+	assert.Equal(t, "No changes in the dependency graph.\n", FormatDiffText(diff))
+}
+
+func TestDiffProtocolChange(t *testing.T) {
+	oldList := AdjacencyList{"A": {{Service: "B", Calls: []NetworkCall{{Protocol: "HTTP", URL: "Subject"}}}}}
+	newList := AdjacencyList{"A": {{Service: "B", Calls: []NetworkCall{{Protocol: "NATS", URL: "Subject"}}}}}
+
+	diff := DiffAdjacencyLists(oldList, newList)
+
+	assert.Empty(t, diff.AddedEdges)
+	assert.Empty(t, diff.RemovedEdges)
+	assert.Equal(t, 1, len(diff.ChangedEdges))
+	assert.Equal(t, "NATS", diff.ChangedEdges[0].New.Protocol)
+}
+
+func TestDiffCycles(t *testing.T) {
+	oldList, newList := createDiffTestLists()
+
+	// Node1 and Node2 call each other in both lists, and Node4 starts calling Node1
+	newList["Node4"] = []ServiceCallList{{Service: "Node1", Calls: []NetworkCall{{Protocol: "HTTP", URL: "http://Node1:80/b"}}, NumberOfCalls: 1}}
+
+	diff := DiffAdjacencyLists(oldList, newList)
+	assert.Equal(t, []string{"Node1 -> Node4 -> Node1"}, diff.AddedCycles)
+	assert.Empty(t, diff.RemovedCycles)
+
+	diff = DiffAdjacencyLists(newList, oldList)
+	assert.Empty(t, diff.AddedCycles)
+	assert.Equal(t, []string{"Node1 -> Node4 -> Node1"}, diff.RemovedCycles)
+
+	assert.True(t, strings.Contains(FormatDiffText(diff), "Removed circular dependencies:\n\t- Node1 -> Node4 -> Node1\n"))
+	assert.True(t, strings.Contains(FormatDiffMarkdown(diff), "| removed | `Node1 -> Node4 -> Node1` |"))
+}
+
+func TestFormatDiff(t *testing.T) {
+	diff := DiffAdjacencyLists(createDiffTestLists())
+
+	text := FormatDiffText(diff)
+	assert.True(t, strings.Contains(text, "+ Node1 -> Node4 [NATS] SomeSubject"))
+	assert.True(t, strings.Contains(text, "- Node1 -> Node3 [HTTP] http://Node3:80/"))
+	assert.True(t, strings.Contains(text, "~ Node1 -> Node2 [HTTP] http://Node2:80/old => [HTTP] http://Node2:80/new"))
+
+	markdown := FormatDiffMarkdown(diff)
+	assert.True(t, strings.Contains(markdown, "| added | `Node4` |"))
+	assert.True(t, strings.Contains(markdown, "| removed | `Node1` | `Node3` | HTTP | `http://Node3:80/` |"))
+
+	jsonString, err := SerializeDiff(diff)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(jsonString, "\"addedServices\": [\n\t\t\"Node4\"\n\t]"))
+}
+
+func TestParseAdjacencyList(t *testing.T) {
+	list, err := ParseAdjacencyList([]byte("{\"Node1\":[{\"service\":\"Node2\",\"calls\":[{\"protocol\":\"HTTP\",\"locations\":null}],\"count\":1}]}"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Node2", list["Node1"][0].Service)
+
+	_, err = ParseAdjacencyList([]byte("not json"))
+	assert.NotNil(t, err)
+}
+
+func TestParseAdjacencyListDocument(t *testing.T) {
+	graph := createCyclicTestGraph()
+	cycles := FindCycles(graph, AllProtocols)
+	document := Document{
+		Dependencies: ConstructAdjacencyList(graph),
+		Cycles:       &cycles,
+		Metrics:      ComputeMetrics(graph),
+	}
+
+	jsonString, err := SerializeDocument(document, true)
+	assert.Nil(t, err)
+
+	list, err := ParseAdjacencyList([]byte(jsonString))
+	assert.Nil(t, err)
+	assert.Equal(t, document.Dependencies, list)
+
+	// a service named after a section of the document is still read as a bare adjacency list
+	list, err = ParseAdjacencyList([]byte("{\"cycles\":[{\"service\":\"Node2\",\"calls\":[],\"count\":0}]}"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Node2", list["cycles"][0].Service)
+}
@@ -0,0 +1,38 @@
+// Package output defines the different ways of output in the tool
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package output
+
+import (
+	"net/url"
+)
+
+// natsProtocol is the protocol of the edges discovered by the NATS analyzer
+const natsProtocol = "NATS"
+
+// IsExternal returns whether the edge is a resolved call to a host that is not one of the analysed services
+func (edge *ConnectionEdge) IsExternal() bool {
+	if edge.Target == nil || !edge.Target.IsUnknown || edge.Call.Protocol == natsProtocol {
+		return false
+	}
+
+	parsedURL, err := url.Parse(edge.Call.URL)
+	if err != nil {
+		return false
+	}
+
+	return parsedURL.Host != ""
+}
+
+// IsUnresolved returns whether the target of a (non-NATS) call could not be determined
+func (edge *ConnectionEdge) IsUnresolved() bool {
+	if edge.Target == nil || !edge.Target.IsUnknown || edge.Call.Protocol == natsProtocol {
+		return false
+	}
+
+	return !edge.IsExternal()
+}
+
+// IsUnconsumedMessage returns whether the edge is a NATS message of which no consumer was found
+func (edge *ConnectionEdge) IsUnconsumedMessage() bool {
+	return edge.Target != nil && edge.Target.IsUnknown && edge.Call.Protocol == natsProtocol
+}
@@ -0,0 +1,238 @@
+// Package output defines the different ways of output in the tool
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// maxChainSearchSteps bounds the search for the longest call chain of a single service,
+// as finding the longest simple path is exponential in graphs with many cycles
+const maxChainSearchSteps = 100000
+
+// ServiceMetrics holds the coupling metrics of a single service. Unknown services are not taken into account.
+type ServiceMetrics struct {
+	Service string `json:"service"`
+	// AfferentCoupling (fan-in) is the number of services that call this service
+	AfferentCoupling int `json:"afferentCoupling"`
+	// EfferentCoupling (fan-out) is the number of services this service calls
+	EfferentCoupling int `json:"efferentCoupling"`
+	// Instability is EfferentCoupling / (AfferentCoupling + EfferentCoupling), or 0 for isolated services
+	Instability float64 `json:"instability"`
+	// TransitiveDependents are the services that (indirectly) depend on this service: its blast radius
+	TransitiveDependents []string `json:"transitiveDependents"`
+	// TransitiveDependencies are the services this service (indirectly) depends on
+	TransitiveDependencies []string `json:"transitiveDependencies"`
+	// LongestSyncChain is the number of hops of the longest chain of synchronous calls starting at this service
+	LongestSyncChain int `json:"longestSyncChain"`
+	// LongestSyncChainTruncated is set when the search for the longest chain was stopped early,
+	// in which case LongestSyncChain is the longest chain that was found rather than the longest one
+	LongestSyncChainTruncated bool `json:"longestSyncChainTruncated,omitempty"`
+}
+
+// reachable returns the sorted list of services reachable from the service in the adjacency map
+func reachable(service string, adjacent map[string][]string) []string {
+	visited := map[string]bool{service: true}
+	queue := []string{service}
+	result := make([]string, 0)
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, next := range adjacent[current] {
+			if !visited[next] {
+				visited[next] = true
+				result = append(result, next)
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// longestChain returns the number of hops of the longest simple path starting at the service, and whether
+// the search was stopped after maxChainSearchSteps, in which case a longer path may exist
+func longestChain(service string, adjacent map[string][]string) (int, bool) {
+	longest := 0
+	steps := 0
+	onPath := map[string]bool{service: true}
+
+	var search func(current string, length int)
+	search = func(current string, length int) {
+		if length > longest {
+			longest = length
+		}
+
+		for _, next := range adjacent[current] {
+			steps++
+			if steps > maxChainSearchSteps {
+				return
+			}
+
+			if !onPath[next] {
+				onPath[next] = true
+				search(next, length+1)
+				onPath[next] = false
+			}
+		}
+	}
+
+	search(service, 0)
+
+	return longest, steps > maxChainSearchSteps
+}
+
+// ComputeMetrics computes the ServiceMetrics of each known service in the graph,
+// stores them in the Metrics field of the ServiceNode and returns them in alphabetical order
+func ComputeMetrics(graph NodeGraph) []ServiceMetrics {
+	allCalls := newCallGraph(graph, AllProtocols)
+	syncCalls := newCallGraph(graph, SyncProtocols)
+
+	// invert the graph to find the callers of each service
+	callers := make(map[string][]string)
+	for _, source := range allCalls.services {
+		for _, target := range allCalls.adjacent[source] {
+			callers[target] = append(callers[target], source)
+		}
+	}
+
+	metrics := make([]ServiceMetrics, 0, len(allCalls.services))
+
+	for _, service := range allCalls.services {
+		afferent := len(callers[service])
+		efferent := len(allCalls.adjacent[service])
+
+		instability := 0.0
+		if afferent+efferent > 0 {
+			instability = float64(efferent) / float64(afferent+efferent)
+		}
+
+		chain, truncated := longestChain(service, syncCalls.adjacent)
+
+		metrics = append(metrics, ServiceMetrics{
+			Service:                   service,
+			AfferentCoupling:          afferent,
+			EfferentCoupling:          efferent,
+			Instability:               instability,
+			TransitiveDependents:      reachable(service, callers),
+			TransitiveDependencies:    reachable(service, allCalls.adjacent),
+			LongestSyncChain:          chain,
+			LongestSyncChainTruncated: truncated,
+		})
+	}
+
+	metricsMap := make(map[string]*ServiceMetrics)
+	for i := range metrics {
+		metricsMap[metrics[i].Service] = &metrics[i]
+	}
+
+	for _, node := range graph.Nodes {
+		if serviceMetrics, ok := metricsMap[node.ServiceName]; ok && !node.IsUnknown {
+			nodeMetrics := *serviceMetrics
+			node.Metrics = &nodeMetrics
+		}
+	}
+
+	return metrics
+}
+
+// metricsHeader holds the column names of the table and CSV formats
+func metricsHeader() []string {
+	return []string{"service", "fan-in", "fan-out", "instability", "dependents", "dependencies", "longest-sync-chain"}
+}
+
+// metricsRow formats the metrics of a service as a row of the table and CSV formats.
+// A longest chain that may be longer than reported is suffixed with a +.
+func metricsRow(metrics *ServiceMetrics) []string {
+	longestSyncChain := strconv.Itoa(metrics.LongestSyncChain)
+	if metrics.LongestSyncChainTruncated {
+		longestSyncChain += "+"
+	}
+
+	return []string{
+		metrics.Service,
+		strconv.Itoa(metrics.AfferentCoupling),
+		strconv.Itoa(metrics.EfferentCoupling),
+		strconv.FormatFloat(metrics.Instability, 'f', 2, 64),
+		strconv.Itoa(len(metrics.TransitiveDependents)),
+		strconv.Itoa(len(metrics.TransitiveDependencies)),
+		longestSyncChain,
+	}
+}
+
+// HasTruncatedChains checks whether the longest chain of any of the services may be longer than reported
+func HasTruncatedChains(metrics []ServiceMetrics) bool {
+	for i := range metrics {
+		if metrics[i].LongestSyncChainTruncated {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FormatMetricsTable formats the metrics as an aligned plain text table
+func FormatMetricsTable(metrics []ServiceMetrics) string {
+	var buffer bytes.Buffer
+
+	const padding = 2
+	writer := tabwriter.NewWriter(&buffer, 0, 0, padding, ' ', 0)
+
+	for _, column := range metricsHeader() {
+		_, _ = fmt.Fprintf(writer, "%s\t", column)
+	}
+	_, _ = fmt.Fprintln(writer)
+
+	for i := range metrics {
+		for _, cell := range metricsRow(&metrics[i]) {
+			_, _ = fmt.Fprintf(writer, "%s\t", cell)
+		}
+		_, _ = fmt.Fprintln(writer)
+	}
+
+	_ = writer.Flush()
+
+	return buffer.String()
+}
+
+// FormatMetricsCSV formats the metrics as comma-separated values, including a header
+func FormatMetricsCSV(metrics []ServiceMetrics) (string, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+
+	err := writer.Write(metricsHeader())
+	if err != nil {
+		return "", err
+	}
+
+	for i := range metrics {
+		err = writer.Write(metricsRow(&metrics[i]))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	writer.Flush()
+
+	return buffer.String(), writer.Error()
+}
+
+// SerializeMetrics serialises the metrics in JSON format
+func SerializeMetrics(metrics []ServiceMetrics) (string, error) {
+	output, err := json.MarshalIndent(metrics, "", "\t")
+	if err != nil {
+		return "null", err
+	}
+
+	return string(output), nil
+}
@@ -0,0 +1,102 @@
+// Package output
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+
+package output
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeMetrics(t *testing.T) {
+	graph := createCyclicTestGraph()
+	metrics := ComputeMetrics(graph)
+
+	assert.Equal(t, 4, len(metrics))
+
+	a := metrics[0]
+	assert.Equal(t, "A", a.Service)
+	assert.Equal(t, 2, a.AfferentCoupling)
+	assert.Equal(t, 1, a.EfferentCoupling)
+	assert.InDelta(t, 1.0/3.0, a.Instability, 0.0001)
+	assert.Equal(t, []string{"B", "C", "D"}, a.TransitiveDependents)
+	assert.Equal(t, []string{"B", "C", "D"}, a.TransitiveDependencies)
+	assert.Equal(t, 2, a.LongestSyncChain)
+
+	// D only communicates through NATS and with an unknown service
+	d := metrics[3]
+	assert.Equal(t, "D", d.Service)
+	assert.Equal(t, 1, d.AfferentCoupling)
+	assert.Equal(t, 1, d.EfferentCoupling)
+	assert.Equal(t, 0, d.LongestSyncChain)
+	assert.False(t, HasTruncatedChains(metrics))
+
+	assert.Equal(t, a, *graph.Nodes[0].Metrics)
+	assert.Nil(t, graph.Nodes[4].Metrics)
+}
+
+// TestComputeMetricsTruncatedChain checks that a longest chain is reported as truncated when the graph has too many
+// simple paths to search them all
+func TestComputeMetricsTruncatedChain(t *testing.T) {
+	graph := NodeGraph{Nodes: make([]*ServiceNode, 0), Edges: make([]*ConnectionEdge, 0)}
+	for i := 0; i < 10; i++ {
+		graph.Nodes = append(graph.Nodes, &ServiceNode{ServiceName: string(rune('A' + i))})
+	}
+	for _, source := range graph.Nodes {
+		for _, target := range graph.Nodes {
+			if source != target {
+				graph.Edges = append(graph.Edges, &ConnectionEdge{Call: NetworkCall{Protocol: "HTTP"}, Source: source, Target: target})
+			}
+		}
+	}
+
+	metrics := ComputeMetrics(graph)
+
+	assert.True(t, metrics[0].LongestSyncChainTruncated)
+	assert.True(t, HasTruncatedChains(metrics))
+	assert.Equal(t, strconv.Itoa(metrics[0].LongestSyncChain)+"+", metricsRow(&metrics[0])[6])
+}
+
+func TestComputeMetricsIsolatedService(t *testing.T) {
+	graph := NodeGraph{
+		Nodes: []*ServiceNode{{ServiceName: "lonely"}},
+		Edges: []*ConnectionEdge{},
+	}
+
+	metrics := ComputeMetrics(graph)
+
+	assert.Equal(t, []ServiceMetrics{{
+		Service:                "lonely",
+		TransitiveDependents:   []string{},
+		TransitiveDependencies: []string{},
+	}}, metrics)
+}
+
+func TestFormatMetrics(t *testing.T) {
+	metrics := []ServiceMetrics{{
+		Service:                "A",
+		AfferentCoupling:       1,
+		EfferentCoupling:       3,
+		Instability:            0.75,
+		TransitiveDependents:   []string{"B"},
+		TransitiveDependencies: []string{"B", "C", "D"},
+		LongestSyncChain:       2,
+	}}
+
+	table := FormatMetricsTable(metrics)
+	lines := strings.Split(strings.TrimSpace(table), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "service"))
+	assert.Equal(t, []string{"A", "1", "3", "0.75", "1", "3", "2"}, strings.Fields(lines[1]))
+
+	csvString, err := FormatMetricsCSV(metrics)
+	assert.Nil(t, err)
+	assert.Equal(t, "service,fan-in,fan-out,instability,dependents,dependencies,longest-sync-chain\nA,1,3,0.75,1,3,2\n", csvString)
+
+	jsonString, err := SerializeMetrics(metrics)
+	assert.Nil(t, err)
+	assert.Contains(t, jsonString, "\"instability\": 0.75")
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/fatih/color"
 
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
 	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
 )
 
@@ -29,6 +30,7 @@ type NetworkCall struct {
 	MethodName string   `json:"methodName,omitempty"`
 	Arguments  []string `json:"arguments,omitempty"`
 	Locations  []string `json:"locations"`
+	Declared   bool     `json:"declared,omitempty"` // Declared marks a call that is declared rather than discovered in the code
 }
 
 // ServiceNode represents a node in the output graph, which is a Service
@@ -37,6 +39,8 @@ type ServiceNode struct {
 	IsUnknown     bool   `json:"isUnknown"`
 	IsReferenced  bool   `json:"isReferenced"`
 	IsReferencing bool   `json:"isReferencing"`
+	// Metrics are set by ComputeMetrics when the graph is built, and never for unknown services
+	Metrics *ServiceMetrics `json:"metrics,omitempty"`
 	// Hostname    []string `json:"hostname"`
 	// Endpoints   []string `json:"endpoints"`
 }
@@ -60,6 +64,36 @@ type NodeGraph struct {
 	Edges []*ConnectionEdge
 }
 
+// Document is the result of an analysis, as it is written to the output file or console.
+// Sections other than the dependencies are omitted when there is nothing to report.
+type Document struct {
+	Dependencies AdjacencyList `json:"dependencies"`
+	Cycles       *CycleReport  `json:"cycles,omitempty"`
+	// Metrics are the coupling metrics of each known service
+	Metrics []ServiceMetrics `json:"metrics,omitempty"`
+	// UnusedEndpoints maps a service to its endpoints that are not called by any of the analysed services
+	UnusedEndpoints map[string][]UnusedEndpoint `json:"unusedEndpoints,omitempty"`
+	// Suppressed are the calls and endpoints that were left out of the dependencies by an exclusion or an ignore annotation
+	Suppressed []SuppressedCall `json:"suppressed,omitempty"`
+	// Diagnostics are the problems that were encountered during the analysis, which may make the result incomplete
+	Diagnostics []diagnostics.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// SuppressedCall is a call or endpoint that was left out of the dependencies, together with the reason why
+type SuppressedCall struct {
+	Service   string   `json:"service"`
+	Type      string   `json:"type"` // Type is either "client" or "endpoint"
+	URL       string   `json:"url,omitempty"`
+	Locations []string `json:"locations"`
+	Reason    string   `json:"reason"`
+}
+
+// UnusedEndpoint is an endpoint (e.g. a route) of a service that no analysed service calls
+type UnusedEndpoint struct {
+	Route     string   `json:"route"`
+	Locations []string `json:"locations"`
+}
+
 type (
 	AdjacencyList  map[string][]ServiceCallList
 	GroupedEdgeMap map[*ServiceNode]map[*ServiceNode][]*ConnectionEdge
@@ -153,6 +187,24 @@ func SerializeAdjacencyList(adjacencyList AdjacencyList, pretty bool) (string, e
 	return string(output), err
 }
 
+// SerializeDocument serialises a given Document in JSON format
+func SerializeDocument(document Document, pretty bool) (string, error) {
+	var output []byte
+	var err error
+
+	if pretty {
+		output, err = json.MarshalIndent(document, "", "\t")
+	} else {
+		output, err = json.Marshal(document)
+	}
+
+	if err != nil {
+		return "null", err
+	}
+
+	return string(output), err
+}
+
 // PrintAnnotationSuggestions prints suggestions to add annotations for the list of callanalyzer.CallTarget it's provided.
 // Intended to be used for unresolved targets.
 func PrintAnnotationSuggestions(targets []*callanalyzer.CallTarget) {
@@ -162,6 +214,17 @@ func PrintAnnotationSuggestions(targets []*callanalyzer.CallTarget) {
 	}
 }
 
+// PrintDiagnostics prints the problems that were encountered during the analysis, errors in red and warnings in yellow
+func PrintDiagnostics(diagnosticList []diagnostics.Diagnostic) {
+	for _, diagnostic := range diagnosticList {
+		if diagnostic.Severity == diagnostics.Error {
+			color.Red(diagnostic.String())
+		} else {
+			color.Yellow(diagnostic.String())
+		}
+	}
+}
+
 func contains(s []string, searchterm string) bool {
 	i := sort.SearchStrings(s, searchterm)
 	return i < len(s) && s[i] == searchterm
@@ -212,6 +275,68 @@ func PrintUnusedServices(noReferenceToServices []string, noReferenceToAndFromSer
 	}
 }
 
+// PrintUnusedEndpoints prints the endpoints that are not called by any of the analysed services, grouped by service
+func PrintUnusedEndpoints(unusedEndpoints map[string][]UnusedEndpoint) {
+	if len(unusedEndpoints) == 0 {
+		return
+	}
+
+	services := make([]string, 0, len(unusedEndpoints))
+	for service := range unusedEndpoints {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	color.HiCyan("Endpoints that are not called by any service: ")
+	for _, service := range services {
+		color.HiWhite("\t%s\n", service)
+		for _, endpoint := range unusedEndpoints[service] {
+			color.HiWhite("\t\t%s %s\n", endpoint.Route, strings.Join(endpoint.Locations, ", "))
+		}
+	}
+	color.HiCyan("Mark endpoints that are called from outside the project with \"//netdep:public\"")
+}
+
+// ConstructSuppressedList lists the suppressed calls and endpoints, ordered by service and location
+func ConstructSuppressedList(calls, endpoints []*callanalyzer.CallTarget) []SuppressedCall {
+	suppressed := make([]SuppressedCall, 0, len(calls)+len(endpoints))
+	for _, targets := range []struct {
+		targetType string
+		targets    []*callanalyzer.CallTarget
+	}{{"client", calls}, {"endpoint", endpoints}} {
+		for _, target := range targets.targets {
+			suppressed = append(suppressed, SuppressedCall{
+				Service:   target.ServiceName,
+				Type:      targets.targetType,
+				URL:       target.RequestLocation,
+				Locations: target.TraceAsStringArray(),
+				Reason:    target.Suppressed,
+			})
+		}
+	}
+
+	sort.SliceStable(suppressed, func(i, j int) bool {
+		if suppressed[i].Service != suppressed[j].Service {
+			return suppressed[i].Service < suppressed[j].Service
+		}
+		return strings.Join(suppressed[i].Locations, ",") < strings.Join(suppressed[j].Locations, ",")
+	})
+
+	return suppressed
+}
+
+// PrintSuppressed prints the calls and endpoints that were left out of the dependencies, with the reason why
+func PrintSuppressed(suppressed []SuppressedCall) {
+	if len(suppressed) == 0 {
+		return
+	}
+
+	color.HiCyan("Calls and endpoints that were left out of the dependencies: ")
+	for _, call := range suppressed {
+		color.HiWhite("\t%s %s %s %s (%s)\n", call.Service, call.Type, call.URL, strings.Join(call.Locations, ", "), call.Reason)
+	}
+}
+
 // PrintDiscoveredAnnotations prints all the discovered annotations if the tool was run with the verbose flag.
 func PrintDiscoveredAnnotations(annotations map[string]map[callanalyzer.Position]string) string {
 	type Annotation struct {
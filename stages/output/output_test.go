@@ -186,3 +186,20 @@ func TestPrintMethods(t *testing.T) {
 	targets = append(targets, &callTarget)
 	PrintAnnotationSuggestions(targets)
 }
+
+// TestSerializeDocument checks that empty sections are omitted, and that the diff reads the bare adjacency list
+func TestSerializeDocument(t *testing.T) {
+	list := ConstructAdjacencyList(createSmallTestGraph())
+	str, err := SerializeDocument(Document{Dependencies: list}, false)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(str, `{"dependencies":`))
+	assert.False(t, strings.Contains(str, "cycles"))
+
+	str, err = SerializeAdjacencyList(list, false)
+	assert.Nil(t, err)
+
+	parsed, err := ParseAdjacencyList([]byte(str))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(parsed))
+	assert.Equal(t, "Node2", parsed["Node1"][0].Service)
+}
@@ -0,0 +1,235 @@
+// Package policy defines architecture rules that are evaluated against the dependency graph
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+)
+
+// The supported rule types
+const (
+	// ForbiddenCall forbids calls from the source service(s) to the target service(s)
+	ForbiddenCall = "forbidden-call"
+	// ExternalCalls only allows the listed services to call external hosts
+	ExternalCalls = "external-calls"
+	// UnconsumedSubject forbids NATS subjects that have no consumer
+	UnconsumedSubject = "unconsumed-subject"
+	// MaxUnresolved limits the number of calls of which the target could not be resolved
+	MaxUnresolved = "max-unresolved"
+)
+
+// Rule is a single rule of a policy file. Which of the fields are used depends on the Type.
+// Source and Target may contain wildcards, as supported by path.Match (e.g. "billing-*").
+type Rule struct {
+	Name     string   `yaml:"name"`     // Name is an optional description, used when reporting violations
+	Type     string   `yaml:"type"`     // Type is one of the supported rule types
+	Source   string   `yaml:"source"`   // Source is the calling service (forbidden-call)
+	Target   string   `yaml:"target"`   // Target is the called service (forbidden-call)
+	Protocol string   `yaml:"protocol"` // Protocol optionally restricts a forbidden-call rule to one protocol
+	Allow    []string `yaml:"allow"`    // Allow lists the services that may call external hosts (external-calls)
+	Max      int      `yaml:"max"`      // Max is the maximum number of unresolved calls (max-unresolved)
+}
+
+// Policy holds the rules that the dependency graph should adhere to
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Violation describes a breach of a rule
+type Violation struct {
+	Rule      string   `json:"rule"`
+	Message   string   `json:"message"`
+	Locations []string `json:"locations,omitempty"`
+}
+
+// LoadPolicy reads and validates a policy file in YAML format
+func LoadPolicy(policyPath string) (*Policy, error) {
+	file, err := ioutil.ReadFile(filepath.Clean(policyPath))
+	if err != nil {
+		return nil, fmt.Errorf("the policy file cannot be read: %s", policyPath)
+	}
+
+	policy := &Policy{}
+
+	err = yaml.Unmarshal(file, policy)
+	if err != nil {
+		return nil, fmt.Errorf("the policy file cannot be parsed: %w", err)
+	}
+
+	for i, rule := range policy.Rules {
+		err = rule.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %d in policy file: %w", i+1, err)
+		}
+	}
+
+	return policy, nil
+}
+
+// validate checks whether the fields required by the rule type are present
+func (rule *Rule) validate() error {
+	switch rule.Type {
+	case ForbiddenCall:
+		if rule.Source == "" || rule.Target == "" {
+			return fmt.Errorf("rule type %s requires a source and a target", rule.Type)
+		}
+	case ExternalCalls, UnconsumedSubject:
+	case MaxUnresolved:
+		if rule.Max < 0 {
+			return fmt.Errorf("rule type %s requires a non-negative max", rule.Type)
+		}
+	default:
+		return fmt.Errorf("unknown rule type: %s", rule.Type)
+	}
+
+	return nil
+}
+
+// description returns the name of the rule, or a generated description if it has none
+func (rule *Rule) description() string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+
+	switch rule.Type {
+	case ForbiddenCall:
+		return fmt.Sprintf("%s must not call %s", rule.Source, rule.Target)
+	case ExternalCalls:
+		if len(rule.Allow) == 0 {
+			return "no service may call external hosts"
+		}
+		return fmt.Sprintf("only %s may call external hosts", strings.Join(rule.Allow, ", "))
+	case UnconsumedSubject:
+		return "every NATS subject must have a consumer"
+	default:
+		return fmt.Sprintf("unresolved calls must not exceed %d", rule.Max)
+	}
+}
+
+// Evaluate checks each of the rules of the policy against the graph and returns all violations
+func (policy *Policy) Evaluate(graph output.NodeGraph) []Violation {
+	violations := make([]Violation, 0)
+
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+
+		switch rule.Type {
+		case ForbiddenCall:
+			violations = append(violations, evaluateForbiddenCall(rule, graph)...)
+		case ExternalCalls:
+			violations = append(violations, evaluateExternalCalls(rule, graph)...)
+		case UnconsumedSubject:
+			violations = append(violations, evaluateUnconsumedSubject(rule, graph)...)
+		case MaxUnresolved:
+			violations = append(violations, evaluateMaxUnresolved(rule, graph)...)
+		}
+	}
+
+	return violations
+}
+
+// matchesService checks whether the service name matches the pattern
+func matchesService(pattern, serviceName string) bool {
+	matched, err := path.Match(pattern, serviceName)
+	return err == nil && matched
+}
+
+// evaluateForbiddenCall reports every edge from a matching source to a matching target
+func evaluateForbiddenCall(rule *Rule, graph output.NodeGraph) []Violation {
+	violations := make([]Violation, 0)
+
+	for _, edge := range graph.Edges {
+		if !matchesService(rule.Source, edge.Source.ServiceName) || !matchesService(rule.Target, edge.Target.ServiceName) {
+			continue
+		}
+
+		if rule.Protocol != "" && !strings.EqualFold(rule.Protocol, edge.Call.Protocol) {
+			continue
+		}
+
+		violations = append(violations, Violation{
+			Rule:      rule.description(),
+			Message:   fmt.Sprintf("%s calls %s (%s %s)", edge.Source.ServiceName, edge.Target.ServiceName, edge.Call.Protocol, edge.Call.URL),
+			Locations: edge.Call.Locations,
+		})
+	}
+
+	return violations
+}
+
+// evaluateExternalCalls reports every call to an external host made by a service that is not allowed to do so
+func evaluateExternalCalls(rule *Rule, graph output.NodeGraph) []Violation {
+	violations := make([]Violation, 0)
+
+	for _, edge := range graph.Edges {
+		if !edge.IsExternal() {
+			continue
+		}
+
+		isAllowed := false
+		for _, allowed := range rule.Allow {
+			if matchesService(allowed, edge.Source.ServiceName) {
+				isAllowed = true
+				break
+			}
+		}
+
+		if !isAllowed {
+			violations = append(violations, Violation{
+				Rule:      rule.description(),
+				Message:   fmt.Sprintf("%s calls external host %s", edge.Source.ServiceName, edge.Call.URL),
+				Locations: edge.Call.Locations,
+			})
+		}
+	}
+
+	return violations
+}
+
+// evaluateUnconsumedSubject reports every NATS message that is published without being consumed
+func evaluateUnconsumedSubject(rule *Rule, graph output.NodeGraph) []Violation {
+	violations := make([]Violation, 0)
+
+	for _, edge := range graph.Edges {
+		if edge.IsUnconsumedMessage() {
+			violations = append(violations, Violation{
+				Rule:      rule.description(),
+				Message:   fmt.Sprintf("subject %s published by %s has no consumers", edge.Call.URL, edge.Source.ServiceName),
+				Locations: edge.Call.Locations,
+			})
+		}
+	}
+
+	return violations
+}
+
+// evaluateMaxUnresolved reports a single violation, listing all unresolved calls, if there are more than allowed
+func evaluateMaxUnresolved(rule *Rule, graph output.NodeGraph) []Violation {
+	locations := make([]string, 0)
+	count := 0
+
+	for _, edge := range graph.Edges {
+		if edge.IsUnresolved() {
+			count++
+			locations = append(locations, edge.Call.Locations...)
+		}
+	}
+
+	if count <= rule.Max {
+		return []Violation{}
+	}
+
+	return []Violation{{
+		Rule:      rule.description(),
+		Message:   fmt.Sprintf("found %d unresolved calls, at most %d are allowed", count, rule.Max),
+		Locations: locations,
+	}}
+}
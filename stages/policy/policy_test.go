@@ -0,0 +1,138 @@
+// Package policy
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/output"
+)
+
+// createPolicyTestGraph creates a graph in which billing calls frontend, billing and gateway call an external host,
+// billing makes an unresolved call and billing publishes a NATS message without consumers
+func createPolicyTestGraph() output.NodeGraph {
+	billing := &output.ServiceNode{ServiceName: "billing"}
+	frontend := &output.ServiceNode{ServiceName: "frontend"}
+	gateway := &output.ServiceNode{ServiceName: "gateway"}
+	unknown := &output.ServiceNode{ServiceName: "UnknownService", IsUnknown: true}
+
+	edges := []*output.ConnectionEdge{
+		{
+			Call:   output.NetworkCall{Protocol: "HTTP", URL: "http://frontend:80/", Locations: []string{"billing/main.go:10"}},
+			Source: billing,
+			Target: frontend,
+		},
+		{
+			Call:   output.NetworkCall{Protocol: "HTTP", URL: "https://example.com/pay", Locations: []string{"billing/main.go:20"}},
+			Source: billing,
+			Target: unknown,
+		},
+		{
+			Call:   output.NetworkCall{Protocol: "HTTP", URL: "https://example.com/login", Locations: []string{"gateway/main.go:5"}},
+			Source: gateway,
+			Target: unknown,
+		},
+		{
+			Call:   output.NetworkCall{Protocol: "HTTP", URL: "", Locations: []string{"billing/main.go:30"}},
+			Source: billing,
+			Target: unknown,
+		},
+		{
+			Call:   output.NetworkCall{Protocol: "NATS", URL: "InvoiceSubject", Locations: []string{"billing/nats.go:3"}},
+			Source: billing,
+			Target: unknown,
+		},
+	}
+
+	return output.NodeGraph{
+		Nodes: []*output.ServiceNode{billing, frontend, gateway, unknown},
+		Edges: edges,
+	}
+}
+
+func TestEvaluateForbiddenCall(t *testing.T) {
+	policy := Policy{Rules: []Rule{
+		{Type: ForbiddenCall, Source: "billing", Target: "front*"},
+		{Type: ForbiddenCall, Source: "billing", Target: "frontend", Protocol: "NATS"},
+		{Type: ForbiddenCall, Source: "frontend", Target: "billing"},
+	}}
+
+	violations := policy.Evaluate(createPolicyTestGraph())
+
+	assert.Equal(t, []Violation{{
+		Rule:      "billing must not call front*",
+		Message:   "billing calls frontend (HTTP http://frontend:80/)",
+		Locations: []string{"billing/main.go:10"},
+	}}, violations)
+}
+
+func TestEvaluateExternalCalls(t *testing.T) {
+	policy := Policy{Rules: []Rule{{Name: "gateway only", Type: ExternalCalls, Allow: []string{"gateway"}}}}
+
+	violations := policy.Evaluate(createPolicyTestGraph())
+
+	assert.Equal(t, 1, len(violations))
+	assert.Equal(t, "gateway only", violations[0].Rule)
+	assert.Equal(t, "billing calls external host https://example.com/pay", violations[0].Message)
+	assert.Equal(t, []string{"billing/main.go:20"}, violations[0].Locations)
+}
+
+func TestEvaluateUnconsumedSubject(t *testing.T) {
+	policy := Policy{Rules: []Rule{{Type: UnconsumedSubject}}}
+
+	violations := policy.Evaluate(createPolicyTestGraph())
+
+	assert.Equal(t, 1, len(violations))
+	assert.Equal(t, "subject InvoiceSubject published by billing has no consumers", violations[0].Message)
+}
+
+func TestEvaluateMaxUnresolved(t *testing.T) {
+	graph := createPolicyTestGraph()
+
+	satisfied := Policy{Rules: []Rule{{Type: MaxUnresolved, Max: 1}}}
+	assert.Empty(t, satisfied.Evaluate(graph))
+
+	violated := Policy{Rules: []Rule{{Type: MaxUnresolved, Max: 0}}}
+	violations := violated.Evaluate(graph)
+	assert.Equal(t, 1, len(violations))
+	assert.Equal(t, "found 1 unresolved calls, at most 0 are allowed", violations[0].Message)
+	assert.Equal(t, []string{"billing/main.go:30"}, violations[0].Locations)
+}
+
+func TestLoadPolicy(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	content := `rules:
+  - type: forbidden-call
+    source: billing
+    target: frontend
+  - type: max-unresolved
+    max: 3
+`
+	assert.Nil(t, os.WriteFile(policyFile, []byte(content), 0o600))
+
+	policy, err := LoadPolicy(policyFile)
+	assert.Nil(t, err)
+	assert.Equal(t, []Rule{
+		{Type: ForbiddenCall, Source: "billing", Target: "frontend"},
+		{Type: MaxUnresolved, Max: 3},
+	}, policy.Rules)
+}
+
+func TestLoadPolicyInvalid(t *testing.T) {
+	_, err := LoadPolicy("invalid")
+	assert.Equal(t, "the policy file cannot be read: invalid", err.Error())
+
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.Nil(t, os.WriteFile(policyFile, []byte("rules:\n  - type: forbidden-call\n    source: a\n"), 0o600))
+	_, err = LoadPolicy(policyFile)
+	assert.Equal(t, "invalid rule 1 in policy file: rule type forbidden-call requires a source and a target", err.Error())
+
+	assert.Nil(t, os.WriteFile(policyFile, []byte("rules:\n  - type: something\n"), 0o600))
+	_, err = LoadPolicy(policyFile)
+	assert.Equal(t, "invalid rule 1 in policy file: unknown rule type: something", err.Error())
+}
@@ -0,0 +1,295 @@
+// Package preprocessing defines preprocessing of a given Go project directory
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package preprocessing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeFileName matches the names of Docker Compose files, such as docker-compose.yml and compose.prod.yaml
+var composeFileName = regexp.MustCompile(`^(docker-)?compose(\.[\w-]+)?\.ya?ml$`)
+
+// IsComposeFile checks whether the file is a Docker Compose file, based on its name
+func IsComposeFile(path string) bool {
+	return composeFileName.MatchString(filepath.Base(path))
+}
+
+// composeFile is the part of a Docker Compose file that holds the environment and network of the services
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+// composeService is a service of a Docker Compose file
+type composeService struct {
+	Build         composeBuild       `yaml:"build"`
+	Environment   composeEnvironment `yaml:"environment"`
+	EnvFile       composeEnvFiles    `yaml:"env_file"`
+	Hostname      string             `yaml:"hostname"`
+	ContainerName string             `yaml:"container_name"`
+	Networks      composeNetworks    `yaml:"networks"`
+	Ports         []composePort      `yaml:"ports"`
+}
+
+// composeBuild is the build section of a service, which is either the context or a mapping holding it
+type composeBuild struct {
+	Context    string `yaml:"context"`
+	Dockerfile string `yaml:"dockerfile"`
+}
+
+// UnmarshalYAML accepts both the short (context only) and the long syntax of the build section
+func (build *composeBuild) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		build.Context = node.Value
+		return nil
+	}
+
+	type plain composeBuild
+	return node.Decode((*plain)(build))
+}
+
+// composeEnvironment maps the names of environment variables to their values
+type composeEnvironment map[string]string
+
+// UnmarshalYAML accepts both a list of NAME=value entries and a mapping. Variables without a value
+// are taken from the shell that runs Docker Compose, so they are left out.
+func (environment *composeEnvironment) UnmarshalYAML(node *yaml.Node) error {
+	*environment = make(composeEnvironment)
+
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, entry := range node.Content {
+			parts := strings.SplitN(entry.Value, "=", 2) //nolint:gomnd
+			if len(parts) == 2 {
+				(*environment)[parts[0]] = parts[1]
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i], node.Content[i+1]
+			if value.Tag != "!!null" {
+				(*environment)[name.Value] = value.Value
+			}
+		}
+	default:
+		return fmt.Errorf("line %d: the environment must be a list or a mapping", node.Line)
+	}
+
+	return nil
+}
+
+// composeEnvFiles are the paths of the env files of a service
+type composeEnvFiles []string
+
+// UnmarshalYAML accepts a single path, a list of paths and a list of mappings holding a path
+func (envFiles *composeEnvFiles) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*envFiles = composeEnvFiles{node.Value}
+		return nil
+	}
+
+	for _, entry := range node.Content {
+		if entry.Kind == yaml.ScalarNode {
+			*envFiles = append(*envFiles, entry.Value)
+			continue
+		}
+
+		var envFile struct {
+			Path string `yaml:"path"`
+		}
+		if err := entry.Decode(&envFile); err != nil {
+			return err
+		}
+		*envFiles = append(*envFiles, envFile.Path)
+	}
+
+	return nil
+}
+
+// composeNetworks holds the aliases of a service in its networks
+type composeNetworks []string
+
+// UnmarshalYAML accepts both a list of networks, which have no aliases, and a mapping of networks
+func (aliases *composeNetworks) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var networks map[string]struct {
+		Aliases []string `yaml:"aliases"`
+	}
+	if err := node.Decode(&networks); err != nil {
+		return err
+	}
+
+	for _, network := range networks {
+		*aliases = append(*aliases, network.Aliases...)
+	}
+
+	return nil
+}
+
+// composePort is a port of a service that is published on the host
+type composePort struct {
+	HostIP    string
+	Published string
+	Target    string
+}
+
+// UnmarshalYAML accepts both the short syntax, such as 127.0.0.1:8080:80/tcp, and the long syntax
+func (port *composePort) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		var long struct {
+			HostIP    string `yaml:"host_ip"`
+			Published string `yaml:"published"`
+			Target    string `yaml:"target"`
+		}
+		if err := node.Decode(&long); err != nil {
+			return err
+		}
+
+		*port = composePort{HostIP: long.HostIP, Published: long.Published, Target: long.Target}
+		return nil
+	}
+
+	parts := strings.Split(strings.SplitN(node.Value, "/", 2)[0], ":") //nolint:gomnd
+	switch len(parts) {
+	case 1:
+		*port = composePort{Target: parts[0]}
+	case 2: //nolint:gomnd
+		*port = composePort{Published: parts[0], Target: parts[1]}
+	default:
+		last := len(parts) - 1
+		*port = composePort{HostIP: strings.Join(parts[:last-1], ":"), Published: parts[last-1], Target: parts[last]}
+	}
+
+	return nil
+}
+
+// IndexComposeFile reads the environment variables and the host names of the services in the Docker Compose file.
+// Compose services are matched to the given services by their build context, or else by their name. The environment
+// variables are mapped by service name, as IndexEnvironmentVariables does. The hosts map the compose service names,
+// host names, container names, network aliases and published ports (e.g. localhost:8080) to the service names.
+func IndexComposeFile(path string, services []Service) (map[string]map[string]string, map[string]string, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("the compose file cannot be read: %w", err)
+	}
+
+	var file composeFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("the compose file cannot be parsed: %w", err)
+	}
+
+	// build contexts are compared to the (absolute) directories of the services
+	composeDir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	envVars := make(map[string]map[string]string)
+	hosts := make(map[string]string)
+
+	for composeName, composeService := range file.Services {
+		serviceName := matchComposeService(composeName, composeService, composeDir, services)
+
+		environment, err := composeService.environment(composeDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("the environment of %s cannot be read: %w", composeName, err)
+		}
+		if envVars[serviceName] == nil {
+			envVars[serviceName] = make(map[string]string)
+		}
+		for name, value := range environment {
+			envVars[serviceName][name] = value
+		}
+
+		for _, host := range composeService.hosts(composeName) {
+			hosts[host] = serviceName
+		}
+	}
+
+	return envVars, hosts, nil
+}
+
+// environment combines the variables of the env files of the service with its environment, which takes precedence
+func (service composeService) environment(composeDir string) (map[string]string, error) {
+	environment := make(map[string]string)
+
+	for _, envFile := range service.EnvFile {
+		if !filepath.IsAbs(envFile) {
+			envFile = filepath.Join(composeDir, envFile)
+		}
+
+		variables, err := readEnvFile(envFile)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range variables {
+			environment[name] = value
+		}
+	}
+
+	for name, value := range service.Environment {
+		environment[name] = value
+	}
+
+	return environment, nil
+}
+
+// hosts returns the host names, and the hosts with a port, under which the service can be reached
+func (service composeService) hosts(composeName string) []string {
+	hosts := []string{composeName}
+	for _, host := range append([]string{service.Hostname, service.ContainerName}, service.Networks...) {
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	for _, port := range service.Ports {
+		if port.Published == "" || strings.Contains(port.Published, "-") {
+			// ports that are not published, or published on a range, cannot be called on a known port
+			continue
+		}
+
+		hostIPs := []string{"localhost", "127.0.0.1"}
+		if port.HostIP != "" && port.HostIP != "0.0.0.0" {
+			hostIPs = []string{port.HostIP}
+		}
+		for _, hostIP := range hostIPs {
+			hosts = append(hosts, hostIP+":"+port.Published)
+		}
+	}
+
+	return hosts
+}
+
+// matchComposeService returns the name of the service that the compose service is built from. A compose service
+// without a matching build context is matched on its name, and keeps its name if no service has that name.
+func matchComposeService(composeName string, composeService composeService, composeDir string, services []Service) string {
+	if composeService.Build.Context != "" {
+		contextDir := composeService.Build.Context
+		if !filepath.IsAbs(contextDir) {
+			contextDir = filepath.Join(composeDir, contextDir)
+		}
+
+		buildDirs := []string{contextDir}
+		if composeService.Build.Dockerfile != "" {
+			buildDirs = append(buildDirs, filepath.Dir(filepath.Join(contextDir, composeService.Build.Dockerfile)))
+		}
+
+		// prefer the directory of the Dockerfile, as a shared build context may hold several services
+		for i := len(buildDirs) - 1; i >= 0; i-- {
+			if service, ok := findServiceOfDir(buildDirs[i], services); ok {
+				return service.Name
+			}
+		}
+	}
+
+	return composeName
+}
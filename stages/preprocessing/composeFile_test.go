@@ -0,0 +1,88 @@
+// Package preprocessing defines preprocessing of a given Go project directory
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package preprocessing
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsComposeFile(t *testing.T) {
+	assert.True(t, IsComposeFile("deploy/docker-compose.yml"))
+	assert.True(t, IsComposeFile("compose.yaml"))
+	assert.True(t, IsComposeFile("docker-compose.prod.yaml"))
+	assert.False(t, IsComposeFile("env.yaml"))
+	assert.False(t, IsComposeFile("docker-compose.json"))
+}
+
+func TestIndexComposeFile(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"docker-compose.yml": `
+services:
+  user-api:
+    build: ./svc/users
+    environment:
+      PORT: 8080
+      DEBUG:
+    networks:
+      backend:
+        aliases: [accounts]
+    ports:
+      - "8081:8080"
+  orders:
+    build:
+      context: .
+      dockerfile: svc/orders/Dockerfile
+    env_file: orders.env
+    environment:
+      - USERS_URL=http://user-api:8080
+      - LOG_LEVEL
+    hostname: orders-host
+    ports:
+      - target: 9000
+        published: 9001
+        host_ip: 10.0.0.1
+  nats:
+    image: nats
+    ports: ["4222"]
+`,
+		"orders.env": "# the orders service\nexport USERS_URL=http://localhost:8081\nQUEUE='orders'\n",
+	})
+	services := []Service{
+		{Name: "users", Dir: filepath.Join(projectDir, "svc", "users")},
+		{Name: "orders", Dir: filepath.Join(projectDir, "svc", "orders")},
+	}
+
+	envVars, hosts, err := IndexComposeFile(filepath.Join(projectDir, "docker-compose.yml"), services)
+	assert.Nil(t, err)
+
+	// compose services are mapped to the services they are built from, and the environment takes precedence over env files
+	assert.Equal(t, map[string]map[string]string{
+		"users":  {"PORT": "8080"},
+		"orders": {"USERS_URL": "http://user-api:8080", "QUEUE": "orders"},
+		"nats":   {},
+	}, envVars)
+	assert.Equal(t, map[string]string{
+		"user-api":       "users",
+		"accounts":       "users",
+		"localhost:8081": "users",
+		"127.0.0.1:8081": "users",
+		"orders":         "orders",
+		"orders-host":    "orders",
+		"10.0.0.1:9001":  "orders",
+		"nats":           "nats",
+	}, hosts)
+}
+
+func TestIndexComposeFileMissingEnvFile(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"compose.yaml": "services:\n  users:\n    env_file: [users.env]\n",
+	})
+
+	_, _, err := IndexComposeFile(filepath.Join(projectDir, "compose.yaml"), nil)
+	assert.NotNil(t, err)
+}
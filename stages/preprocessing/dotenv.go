@@ -0,0 +1,105 @@
+// Package preprocessing defines preprocessing of a given Go project directory
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package preprocessing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DotenvFileName is the name of the dotenv file that is read from the directory of each service
+const DotenvFileName = ".env"
+
+// IndexDotenvFiles reads the dotenv files of the services, and maps their variables by service name,
+// as IndexEnvironmentVariables does. For each service, the .env file in its directory is read first,
+// followed by the .env.<profile> file if a profile is given, and then the files given for its name.
+// Later files take precedence. The files in the service directories are optional, the given files are not.
+func IndexDotenvFiles(services []Service, profile string, files map[string][]string) (map[string]map[string]string, error) {
+	envVars := make(map[string]map[string]string)
+	addFile := func(serviceName, path string, isOptional bool) error {
+		variables, err := readEnvFile(path)
+		if isOptional && errors.Is(err, os.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("the dotenv file of %s cannot be read: %w", serviceName, err)
+		}
+
+		if envVars[serviceName] == nil {
+			envVars[serviceName] = make(map[string]string)
+		}
+		for name, value := range variables {
+			envVars[serviceName][name] = value
+		}
+
+		return nil
+	}
+
+	for _, service := range services {
+		names := []string{DotenvFileName}
+		if profile != "" {
+			names = append(names, DotenvFileName+"."+profile)
+		}
+
+		for _, name := range names {
+			if err := addFile(service.Name, filepath.Join(service.Dir, name), true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for serviceName, paths := range files {
+		for _, path := range paths {
+			if err := addFile(serviceName, path, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return envVars, nil
+}
+
+// readEnvFile reads the NAME=value lines of a dotenv file, skipping empty lines and comments.
+// Values may be quoted, and unquoted values may be followed by a comment.
+func readEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	variables := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2) //nolint:gomnd
+		if len(parts) != 2 {
+			continue
+		}
+
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch {
+		case strings.HasPrefix(value, `"`):
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+		variables[name] = value
+	}
+
+	return variables, scanner.Err()
+}
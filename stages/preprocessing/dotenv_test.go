@@ -0,0 +1,44 @@
+// Package preprocessing defines preprocessing of a given Go project directory
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package preprocessing
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexDotenvFiles(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"svc/orders/.env":         "# local development\nUSERS_URL=http://localhost:8081 # the users service\nexport QUEUE=\"orders\"\nTIMEOUT='5s'\n",
+		"svc/orders/.env.staging": "USERS_URL=http://users.staging:8080\n",
+		"svc/users/main.go":       "package main\n",
+		"deploy/orders.env":       "QUEUE=orders-prod\n",
+	})
+	services := []Service{
+		{Name: "orders", Dir: filepath.Join(projectDir, "svc", "orders")},
+		{Name: "users", Dir: filepath.Join(projectDir, "svc", "users")},
+	}
+
+	envVars, err := IndexDotenvFiles(services, "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]map[string]string{
+		"orders": {"USERS_URL": "http://localhost:8081", "QUEUE": "orders", "TIMEOUT": "5s"},
+	}, envVars)
+
+	// the profile and the given files take precedence over the .env file
+	envVars, err = IndexDotenvFiles(services, "staging", map[string][]string{
+		"orders": {filepath.Join(projectDir, "deploy", "orders.env")},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]map[string]string{
+		"orders": {"USERS_URL": "http://users.staging:8080", "QUEUE": "orders-prod", "TIMEOUT": "5s"},
+	}, envVars)
+}
+
+func TestIndexDotenvFilesMissingFile(t *testing.T) {
+	_, err := IndexDotenvFiles(nil, "", map[string][]string{"orders": {filepath.Join(t.TempDir(), "orders.env")}})
+	assert.NotNil(t, err)
+}
@@ -9,28 +9,36 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/fatih/color"
-
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
 	"lab.weave.nl/internships/tud-2022/netDep/stages/discovery/callanalyzer"
 )
 
 // LoadAnnotations scans all the files of a given service directory and returns a list of
 // Annotation from the comments in the format "//netdep: ..." that it discovers.
-func LoadAnnotations(servicePath string, serviceName string, annotations map[string]map[callanalyzer.Position]string) error {
-	files, err := os.ReadDir(servicePath)
+// Files that cannot be parsed are recorded in the collector and skipped.
+func LoadAnnotations(servicePath string, serviceName string, annotations map[string]map[callanalyzer.Position]string, collector *diagnostics.Collector) error {
+	annotations[serviceName] = make(map[callanalyzer.Position]string)
+
+	return loadAnnotationsInDir(servicePath, servicePath, serviceName, annotations, collector)
+}
+
+// loadAnnotationsInDir adds the annotations of the files in the directory and its subdirectories
+func loadAnnotationsInDir(dir, servicePath, serviceName string, annotations map[string]map[callanalyzer.Position]string, collector *diagnostics.Collector) error {
+	files, err := os.ReadDir(dir)
 	if err != nil {
 		return err
 	}
 
-	annotations[serviceName] = make(map[callanalyzer.Position]string)
-
 	for _, file := range files {
 		if filepath.Ext(file.Name()) == ".go" && !strings.HasSuffix(file.Name(), "_test.go") && !strings.HasSuffix(file.Name(), "pb.go") {
 			// If the file is a .go file - parse it
-			parseComments(filepath.Join(servicePath, file.Name()), serviceName, annotations)
+			path := filepath.Join(dir, file.Name())
+			if err := parseComments(path, servicePath, serviceName, annotations); err != nil {
+				collector.FileError(diagnostics.StagePreprocessing, serviceName, path, err)
+			}
 		} else if file.IsDir() {
 			// If the file is a directory - recursively look for .go files inside it
-			err := LoadAnnotations(filepath.Join(servicePath, file.Name()), serviceName, annotations)
+			err := loadAnnotationsInDir(filepath.Join(dir, file.Name()), servicePath, serviceName, annotations, collector)
 			if err != nil {
 				return err
 			}
@@ -42,13 +50,12 @@ func LoadAnnotations(servicePath string, serviceName string, annotations map[str
 
 // parseComments parses the given file with a parser.ParseComments mode, filters out
 // the comments which don't contain a substring "netdep:client" or "netdep:endpoint", generates an Annotation for
-// every remaining comment and returns a list of them.
-
-func parseComments(path string, serviceName string, annotations map[string]map[callanalyzer.Position]string) {
+// every remaining comment and returns a list of them. Returns an error if the file cannot be parsed.
+func parseComments(path, servicePath, serviceName string, annotations map[string]map[callanalyzer.Position]string) error {
 	fs := token.NewFileSet()
 	f, err := parser.ParseFile(fs, path, nil, parser.ParseComments)
 	if err != nil {
-		color.Yellow("Error parsing comments for annotations: %s", err)
+		return err
 	}
 
 	for _, commentGroup := range f.Comments {
@@ -56,13 +63,15 @@ func parseComments(path string, serviceName string, annotations map[string]map[c
 			if strings.HasPrefix(comment.Text, "//netdep:") {
 				tokenPos := fs.Position(comment.Slash)
 				pos := callanalyzer.Position{
-					Filename: tokenPos.Filename[strings.LastIndex(tokenPos.Filename, string(os.PathSeparator)+serviceName+string(os.PathSeparator))+1:],
+					Filename: callanalyzer.ServiceFileName(tokenPos.Filename, servicePath, serviceName),
 					Line:     tokenPos.Line,
 				}
-				value := strings.Join(strings.Split(comment.Text, "netdep:")[1:], "")
+				value := strings.TrimPrefix(comment.Text, "//netdep:")
 
 				annotations[serviceName][pos] = value
 			}
 		}
 	}
+
+	return nil
 }
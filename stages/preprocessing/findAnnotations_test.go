@@ -3,6 +3,7 @@
 package preprocessing
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -16,7 +17,7 @@ import (
 func TestLoadAnnotations(t *testing.T) {
 	svcDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "object_call")
 	ann := make(map[string]map[callanalyzer.Position]string)
-	LoadAnnotations(svcDir, "object_call", ann)
+	LoadAnnotations(svcDir, "object_call", ann, nil)
 	expected := make(map[string]map[callanalyzer.Position]string)
 	expected["object_call"] = make(map[callanalyzer.Position]string)
 	pos := callanalyzer.Position{
@@ -30,14 +31,14 @@ func TestLoadAnnotations(t *testing.T) {
 
 func TestLoadAnnotationsInvalidPath(t *testing.T) {
 	m := make(map[string]map[callanalyzer.Position]string)
-	err := LoadAnnotations("invalidPath", "serviceName", m)
+	err := LoadAnnotations("invalidPath", "serviceName", m, nil)
 	assert.NotNil(t, err)
 }
 
 func TestLoadHostAnnotations(t *testing.T) {
 	svcDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "basic_handle")
 	ann := make(map[string]map[callanalyzer.Position]string)
-	LoadAnnotations(svcDir, "basic_handle", ann)
+	LoadAnnotations(svcDir, "basic_handle", ann, nil)
 	expected := make(map[string]map[callanalyzer.Position]string)
 	expected["basic_handle"] = make(map[callanalyzer.Position]string)
 	pos := callanalyzer.Position{
@@ -48,3 +49,19 @@ func TestLoadHostAnnotations(t *testing.T) {
 
 	assert.Equal(t, expected, ann)
 }
+
+func TestLoadAnnotationsInSubdirectories(t *testing.T) {
+	svcDir := filepath.Join(t.TempDir(), "orders")
+	assert.Nil(t, os.MkdirAll(filepath.Join(svcDir, "client"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(svcDir, "main.go"), []byte("package main\n\n//netdep:depends target=users\n"), 0o600))
+	assert.Nil(t, os.WriteFile(filepath.Join(svcDir, "client", "client.go"), []byte("package client\n\n//netdep:client url=/users\n"), 0o600))
+
+	ann := make(map[string]map[callanalyzer.Position]string)
+	assert.Nil(t, LoadAnnotations(svcDir, "orders", ann, nil))
+
+	// the annotations of the subdirectory are added to those of the service
+	assert.Equal(t, map[callanalyzer.Position]string{
+		{Filename: filepath.Join("orders", "main.go"), Line: 3}:             "depends target=users",
+		{Filename: filepath.Join("orders", "client", "client.go"), Line: 3}: "client url=/users",
+	}, ann["orders"])
+}
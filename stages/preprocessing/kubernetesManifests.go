@@ -0,0 +1,353 @@
+// Package preprocessing defines preprocessing of a given Go project directory
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package preprocessing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultNamespace is the namespace of resources that do not specify one
+const defaultNamespace = "default"
+
+// dependentVariable matches a reference to another environment variable of the container, such as $(USERS_HOST)
+var dependentVariable = regexp.MustCompile(`\$\(([A-Za-z_][A-Za-z0-9_]*)\)`)
+
+// manifest is the part of a Kubernetes resource that holds the environment and network of a service
+type manifest struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string            `yaml:"name"`
+		Namespace string            `yaml:"namespace"`
+		Labels    map[string]string `yaml:"labels"`
+	} `yaml:"metadata"`
+	Data map[string]string `yaml:"data"` // Data is set for ConfigMaps
+	Spec struct {
+		// Selector is set for Services, and holds the labels of the pods it selects
+		Selector selector `yaml:"selector"`
+		Ports    []struct {
+			Port int `yaml:"port"`
+		} `yaml:"ports"`
+		// Template is set for Deployments, StatefulSets, DaemonSets and Jobs
+		Template podTemplate `yaml:"template"`
+		// JobTemplate is set for CronJobs
+		JobTemplate struct {
+			Spec struct {
+				Template podTemplate `yaml:"template"`
+			} `yaml:"spec"`
+		} `yaml:"jobTemplate"`
+		// Containers are set for Pods
+		Containers []container `yaml:"containers"`
+	} `yaml:"spec"`
+}
+
+// selector holds the labels of the pods that a Service selects
+type selector map[string]string
+
+// UnmarshalYAML leaves out the matchLabels and matchExpressions of the selectors of workloads,
+// which are not used as the labels of their pods are known
+func (labels *selector) UnmarshalYAML(node *yaml.Node) error {
+	*labels = make(selector)
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i+1].Kind == yaml.ScalarNode {
+			(*labels)[node.Content[i].Value] = node.Content[i+1].Value
+		}
+	}
+
+	return nil
+}
+
+// podTemplate is the template of the pods of a workload
+type podTemplate struct {
+	Metadata struct {
+		Labels map[string]string `yaml:"labels"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Containers []container `yaml:"containers"`
+	} `yaml:"spec"`
+}
+
+// container holds the environment of a container
+type container struct {
+	Name string `yaml:"name"`
+	Env  []struct {
+		Name      string `yaml:"name"`
+		Value     string `yaml:"value"`
+		ValueFrom struct {
+			ConfigMapKeyRef *struct {
+				Name string `yaml:"name"`
+				Key  string `yaml:"key"`
+			} `yaml:"configMapKeyRef"`
+		} `yaml:"valueFrom"`
+	} `yaml:"env"`
+	EnvFrom []struct {
+		Prefix       string `yaml:"prefix"`
+		ConfigMapRef *struct {
+			Name string `yaml:"name"`
+		} `yaml:"configMapRef"`
+	} `yaml:"envFrom"`
+}
+
+// workload is a resource that runs the containers of a service
+type workload struct {
+	name      string
+	namespace string
+	labels    map[string]string // labels are the labels of the pods of the workload
+	service   string            // service is the name of the service the workload belongs to
+}
+
+// IndexKubernetesManifests reads the environment variables and the host names of the services in the Kubernetes
+// manifests, such as the output of helm template. The paths may be files or directories holding YAML files.
+// Workloads (Deployments, StatefulSets, DaemonSets, Jobs, CronJobs and Pods) are matched to the given services by
+// their app.kubernetes.io/name or app label, their name or the name of their container. The environment variables
+// of their containers, including those taken from ConfigMaps, are mapped by service name, as IndexEnvironmentVariables
+// does. The hosts map the DNS names of the Kubernetes Services, with and without their ports, to the service names.
+func IndexKubernetesManifests(paths []string, services []Service) (map[string]map[string]string, map[string]string, error) {
+	manifests, err := readManifests(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configMaps := make(map[string]map[string]string)
+	for _, resource := range manifests {
+		if resource.Kind == "ConfigMap" {
+			configMaps[resource.namespace()+"/"+resource.Metadata.Name] = resource.Data
+		}
+	}
+
+	envVars := make(map[string]map[string]string)
+	workloads := make([]workload, 0)
+
+	for _, resource := range manifests {
+		template, ok := resource.podTemplate()
+		if !ok {
+			continue
+		}
+
+		current := workload{name: resource.Metadata.Name, namespace: resource.namespace(), labels: template.Metadata.Labels}
+		current.service = matchWorkload(current, template.Spec.Containers, services)
+		workloads = append(workloads, current)
+
+		if envVars[current.service] == nil {
+			envVars[current.service] = make(map[string]string)
+		}
+		for _, podContainer := range template.Spec.Containers {
+			for name, value := range podContainer.environment(current.namespace, configMaps) {
+				envVars[current.service][name] = value
+			}
+		}
+	}
+
+	hosts := make(map[string]string)
+	for _, resource := range manifests {
+		if resource.Kind != "Service" {
+			continue
+		}
+
+		serviceName := matchKubernetesService(resource, workloads, services)
+		for _, host := range resource.hosts() {
+			hosts[host] = serviceName
+		}
+	}
+
+	return envVars, hosts, nil
+}
+
+// readManifests reads the resources of all YAML documents in the files, and in the YAML files in the directories
+func readManifests(paths []string) ([]manifest, error) {
+	files := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("the manifests cannot be read: %w", err)
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(filePath string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !entry.IsDir() && (filepath.Ext(filePath) == ".yaml" || filepath.Ext(filePath) == ".yml") {
+				files = append(files, filePath)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("the manifests cannot be read: %w", err)
+		}
+	}
+	sort.Strings(files)
+
+	manifests := make([]manifest, 0)
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return nil, fmt.Errorf("the manifests cannot be read: %w", err)
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var resource manifest
+			err := decoder.Decode(&resource)
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("the manifest %s cannot be parsed: %w", file, err)
+			}
+
+			if resource.Kind != "" {
+				manifests = append(manifests, resource)
+			}
+		}
+	}
+
+	return manifests, nil
+}
+
+// namespace returns the namespace of the resource
+func (resource manifest) namespace() string {
+	if resource.Metadata.Namespace == "" {
+		return defaultNamespace
+	}
+	return resource.Metadata.Namespace
+}
+
+// podTemplate returns the template of the pods that the resource runs, if it is a workload
+func (resource manifest) podTemplate() (podTemplate, bool) {
+	switch resource.Kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		return resource.Spec.Template, true
+	case "CronJob":
+		return resource.Spec.JobTemplate.Spec.Template, true
+	case "Pod":
+		template := podTemplate{}
+		template.Metadata.Labels = resource.Metadata.Labels
+		template.Spec.Containers = resource.Spec.Containers
+		return template, true
+	default:
+		return podTemplate{}, false
+	}
+}
+
+// hosts returns the DNS names of a Kubernetes Service, such as users.default.svc.cluster.local, with and without its ports
+func (resource manifest) hosts() []string {
+	name := resource.Metadata.Name
+	namespace := resource.namespace()
+	names := []string{
+		name,
+		name + "." + namespace,
+		name + "." + namespace + ".svc",
+		name + "." + namespace + ".svc.cluster.local",
+	}
+
+	hosts := append([]string{}, names...)
+	for _, port := range resource.Spec.Ports {
+		for _, host := range names {
+			hosts = append(hosts, host+":"+strconv.Itoa(port.Port))
+		}
+	}
+
+	return hosts
+}
+
+// environment returns the environment variables of the container, taking the values that refer
+// to ConfigMaps from the ConfigMaps in the namespace. Variables that are set with env take precedence
+// over those of envFrom, and references to other variables, such as $(USERS_HOST), are expanded.
+func (podContainer container) environment(namespace string, configMaps map[string]map[string]string) map[string]string {
+	environment := make(map[string]string)
+
+	for _, source := range podContainer.EnvFrom {
+		if source.ConfigMapRef == nil {
+			continue
+		}
+		for key, value := range configMaps[namespace+"/"+source.ConfigMapRef.Name] {
+			environment[source.Prefix+key] = value
+		}
+	}
+
+	for _, variable := range podContainer.Env {
+		switch {
+		case variable.ValueFrom.ConfigMapKeyRef != nil:
+			ref := variable.ValueFrom.ConfigMapKeyRef
+			if value, ok := configMaps[namespace+"/"+ref.Name][ref.Key]; ok {
+				environment[variable.Name] = value
+			}
+		case variable.Value != "":
+			// variables can only refer to variables that are defined before them
+			environment[variable.Name] = dependentVariable.ReplaceAllStringFunc(variable.Value, func(reference string) string {
+				if value, ok := environment[reference[2:len(reference)-1]]; ok {
+					return value
+				}
+				return reference
+			})
+		}
+	}
+
+	return environment
+}
+
+// matchWorkload returns the name of the service that the workload runs. A workload that does not match any
+// of the services is named after its first label, or else its own name.
+func matchWorkload(current workload, containers []container, services []Service) string {
+	candidates := make([]string, 0)
+	for _, label := range kubernetesLabels {
+		if name := current.labels[label]; name != "" {
+			candidates = append(candidates, name)
+		}
+	}
+	candidates = append(candidates, current.name)
+	for _, podContainer := range containers {
+		candidates = append(candidates, podContainer.Name)
+	}
+
+	for _, candidate := range candidates {
+		for _, service := range services {
+			if service.Name == candidate {
+				return service.Name
+			}
+		}
+	}
+
+	return candidates[0]
+}
+
+// matchKubernetesService returns the name of the service that the Kubernetes Service routes to: the service
+// of the first workload in its namespace of which the pods are selected, or else its own name
+func matchKubernetesService(resource manifest, workloads []workload, services []Service) string {
+	if len(resource.Spec.Selector) > 0 {
+		for _, current := range workloads {
+			if current.namespace == resource.namespace() && selects(resource.Spec.Selector, current.labels) {
+				return current.service
+			}
+		}
+	}
+
+	return matchWorkload(workload{name: resource.Metadata.Name, labels: resource.Metadata.Labels}, nil, services)
+}
+
+// selects checks whether the labels hold all labels of the selector
+func selects(podSelector selector, labels map[string]string) bool {
+	for key, value := range podSelector {
+		if labels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,134 @@
+// Package preprocessing defines preprocessing of a given Go project directory
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package preprocessing
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// helmOutput resembles the output of helm template for two services
+const helmOutput = `---
+# Source: shop/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shop-config
+  namespace: shop
+data:
+  USERS_URL: http://users.shop.svc.cluster.local:8080
+  LOG_LEVEL: debug
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: users
+  namespace: shop
+spec:
+  selector:
+    app.kubernetes.io/name: user-api
+  ports:
+    - port: 8080
+      targetPort: http
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: shop-users
+  namespace: shop
+spec:
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: user-api
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: user-api
+    spec:
+      containers:
+        - name: users
+          env:
+            - name: PORT
+              value: "8080"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: shop-orders
+  namespace: shop
+spec:
+  template:
+    metadata:
+      labels:
+        app: orders
+    spec:
+      containers:
+        - name: orders
+          envFrom:
+            - configMapRef:
+                name: shop-config
+          env:
+            - name: USERS_HOST
+              valueFrom:
+                configMapKeyRef:
+                  name: shop-config
+                  key: USERS_URL
+            - name: USERS_ENDPOINT
+              value: $(USERS_HOST)/users
+            - name: LOG_LEVEL
+              value: info
+`
+
+func TestIndexKubernetesManifests(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"templates/shop.yaml": helmOutput, "templates/NOTES.txt": "not a manifest"})
+	services := []Service{{Name: "users"}, {Name: "orders"}}
+
+	envVars, hosts, err := IndexKubernetesManifests([]string{dir}, services)
+	assert.Nil(t, err)
+
+	// the workloads are matched to the services by their container name or app label
+	assert.Equal(t, map[string]map[string]string{
+		"users": {"PORT": "8080"},
+		"orders": {
+			"USERS_URL":      "http://users.shop.svc.cluster.local:8080",
+			"USERS_HOST":     "http://users.shop.svc.cluster.local:8080",
+			"USERS_ENDPOINT": "http://users.shop.svc.cluster.local:8080/users",
+			"LOG_LEVEL":      "info",
+		},
+	}, envVars)
+
+	// the Kubernetes Service selects the pods of the users workload
+	assert.Equal(t, map[string]string{
+		"users":                             "users",
+		"users.shop":                        "users",
+		"users.shop.svc":                    "users",
+		"users.shop.svc.cluster.local":      "users",
+		"users:8080":                        "users",
+		"users.shop:8080":                   "users",
+		"users.shop.svc:8080":               "users",
+		"users.shop.svc.cluster.local:8080": "users",
+	}, hosts)
+}
+
+func TestIndexKubernetesManifestsUnknownService(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"service.yml": "kind: Service\nmetadata:\n  name: payments\n  labels:\n    app: payment-api\n"})
+
+	_, hosts, err := IndexKubernetesManifests([]string{filepath.Join(dir, "service.yml")}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "payment-api", hosts["payments.default.svc.cluster.local"])
+}
+
+func TestIndexKubernetesManifestsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"service.yaml": "kind: [Service\n"})
+
+	_, _, err := IndexKubernetesManifests([]string{dir}, nil)
+	assert.NotNil(t, err)
+
+	_, _, err = IndexKubernetesManifests([]string{filepath.Join(dir, "missing.yaml")}, nil)
+	assert.NotNil(t, err)
+}
@@ -27,7 +27,7 @@ func FindServices(servicesDir string) ([]string, error) {
 	}
 
 	if len(packagesToAnalyze) == 0 {
-		return nil, fmt.Errorf("no service to analyse were found")
+		return nil, fmt.Errorf("no services to analyse were found")
 	}
 
 	return packagesToAnalyze, err
@@ -14,7 +14,7 @@ import (
 func TestLoadServicesEmpty(t *testing.T) {
 	svcDir := filepath.Join(helpers.RootDir, "test", "empty", "empty")
 	_, err := FindServices(svcDir)
-	assert.Equal(t, "no service to analyse were found", err.Error())
+	assert.Equal(t, "no services to analyse were found", err.Error())
 }
 
 func TestLoadServices(t *testing.T) {
@@ -22,10 +22,12 @@ func TestLoadServices(t *testing.T) {
 
 	services, _ := FindServices(svcDir)
 
-	assert.Equal(t, 4, len(services))
+	assert.Equal(t, 6, len(services))
 
-	assert.Equal(t, filepath.Join(helpers.RootDir, "stages", "discovery"), services[0])
-	assert.Equal(t, filepath.Join(helpers.RootDir, "stages", "matching"), services[1])
-	assert.Equal(t, filepath.Join(helpers.RootDir, "stages", "output"), services[2])
-	assert.Equal(t, filepath.Join(helpers.RootDir, "stages", "preprocessing"), services[3])
+	assert.Equal(t, filepath.Join(helpers.RootDir, "stages", "diagnostics"), services[0])
+	assert.Equal(t, filepath.Join(helpers.RootDir, "stages", "discovery"), services[1])
+	assert.Equal(t, filepath.Join(helpers.RootDir, "stages", "matching"), services[2])
+	assert.Equal(t, filepath.Join(helpers.RootDir, "stages", "output"), services[3])
+	assert.Equal(t, filepath.Join(helpers.RootDir, "stages", "policy"), services[4])
+	assert.Equal(t, filepath.Join(helpers.RootDir, "stages", "preprocessing"), services[5])
 }
@@ -0,0 +1,344 @@
+// Package preprocessing defines preprocessing of a given Go project directory
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package preprocessing
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"gopkg.in/yaml.v3"
+)
+
+// The ways in which the services of a project can be discovered
+const (
+	DiscoverDirectories  = "directories"   // DiscoverDirectories treats each subdirectory of the service directory as a service
+	DiscoverMainPackages = "main-packages" // DiscoverMainPackages treats each main package of the project as a service
+	DiscoverWorkspace    = "workspace"     // DiscoverWorkspace treats each module of a go.work file with a main package as a service
+	DiscoverConfig       = "config"        // DiscoverConfig takes the services from a list of name-to-path patterns
+)
+
+// IsValidDiscovery checks whether the way of discovering services is known
+func IsValidDiscovery(discovery string) bool {
+	switch discovery {
+	case DiscoverDirectories, DiscoverMainPackages, DiscoverWorkspace, DiscoverConfig:
+		return true
+	default:
+		return false
+	}
+}
+
+// Service is a service of the project
+type Service struct {
+	Name      string   // Name identifies the service in the dependency graph, and is the host name under which it is called
+	Dir       string   // Dir is the directory holding the sources of the service
+	ModuleDir string   // ModuleDir is the directory of the Go module from which the service is built
+	Packages  []string // Packages are the directories of the main packages of the service
+}
+
+// ServiceFinder finds the services of a project. The name and module directory of the services
+// it returns may be left empty, these are filled in by ResolveServices.
+type ServiceFinder interface {
+	FindServices() ([]Service, error)
+}
+
+// ServicePattern maps the name of a service to the directory holding it. The path is relative to the project
+// directory and may be a glob, in which case the name must be empty so it is derived for every matching directory.
+type ServicePattern struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
+// servicesFile is the format of a file that lists the services of a project
+type servicesFile struct {
+	Services []ServicePattern `yaml:"services"`
+}
+
+// LoadServicePatterns reads the services from the YAML file, which lists the name and path of each service:
+//
+//	services:
+//	  - name: billing
+//	    path: billing/cmd/server
+//	  - path: services/*
+func LoadServicePatterns(path string) ([]ServicePattern, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("the services file cannot be read: %w", err)
+	}
+
+	var file servicesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("the services file cannot be parsed: %w", err)
+	}
+
+	for _, pattern := range file.Services {
+		if pattern.Path == "" {
+			return nil, fmt.Errorf("the service %s in the services file has no path", pattern.Name)
+		}
+	}
+
+	return file.Services, nil
+}
+
+// DirectoryFinder treats each subdirectory of ServicesDir as a service, see FindServices
+type DirectoryFinder struct {
+	ServicesDir string
+}
+
+// FindServices returns a service for each subdirectory of the services directory
+func (finder DirectoryFinder) FindServices() ([]Service, error) {
+	serviceDirs, err := FindServices(finder.ServicesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]Service, 0, len(serviceDirs))
+	for _, serviceDir := range serviceDirs {
+		services = append(services, Service{Dir: serviceDir, Packages: []string{serviceDir}})
+	}
+
+	return services, nil
+}
+
+// MainPackageFinder treats each main package of the module in ProjectDir as a service, such as cmd/<service>
+type MainPackageFinder struct {
+	ProjectDir string
+}
+
+// FindServices returns a service for each directory of the module that holds a main package
+func (finder MainPackageFinder) FindServices() ([]Service, error) {
+	mainPackages, err := findMainPackages(finder.ProjectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]Service, 0, len(mainPackages))
+	for _, mainPackage := range mainPackages {
+		services = append(services, Service{Dir: mainPackage, Packages: []string{mainPackage}})
+	}
+
+	return nonEmpty(services)
+}
+
+// WorkspaceFinder treats each module of the go.work file at WorkFile that holds a main package as a service
+type WorkspaceFinder struct {
+	WorkFile string
+}
+
+// FindServices returns a service for each module of the workspace with at least one main package
+func (finder WorkspaceFinder) FindServices() ([]Service, error) {
+	data, err := os.ReadFile(filepath.Clean(finder.WorkFile))
+	if err != nil {
+		return nil, err
+	}
+
+	workFile, err := modfile.ParseWork(finder.WorkFile, data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]Service, 0, len(workFile.Use))
+	for _, use := range workFile.Use {
+		moduleDir := use.Path
+		if !filepath.IsAbs(moduleDir) {
+			moduleDir = filepath.Join(filepath.Dir(finder.WorkFile), moduleDir)
+		}
+
+		mainPackages, err := findMainPackages(moduleDir)
+		if err != nil {
+			return nil, err
+		}
+
+		// modules without a main package are libraries
+		if len(mainPackages) > 0 {
+			services = append(services, Service{Dir: moduleDir, ModuleDir: moduleDir, Packages: mainPackages})
+		}
+	}
+
+	return nonEmpty(services)
+}
+
+// PatternFinder takes the services from the patterns, which are relative to ProjectDir
+type PatternFinder struct {
+	ProjectDir string
+	Patterns   []ServicePattern
+}
+
+// FindServices returns a service for each directory that matches a pattern. The main packages of a service are
+// those in its directory or any of its subdirectories.
+func (finder PatternFinder) FindServices() ([]Service, error) {
+	services := make([]Service, 0, len(finder.Patterns))
+	knownDirs := make(map[string]bool)
+
+	for _, pattern := range finder.Patterns {
+		matches, err := filepath.Glob(filepath.Join(finder.ProjectDir, pattern.Path))
+		if err != nil {
+			return nil, fmt.Errorf("invalid service path %s: %w", pattern.Path, err)
+		}
+
+		serviceDirs := make([]string, 0, len(matches))
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				serviceDirs = append(serviceDirs, match)
+			}
+		}
+
+		if len(serviceDirs) == 0 {
+			return nil, fmt.Errorf("no directory matches the service path %s", pattern.Path)
+		}
+		if pattern.Name != "" && len(serviceDirs) > 1 {
+			return nil, fmt.Errorf("the service path %s of %s matches several directories", pattern.Path, pattern.Name)
+		}
+
+		for _, serviceDir := range serviceDirs {
+			if knownDirs[serviceDir] {
+				continue
+			}
+			knownDirs[serviceDir] = true
+
+			mainPackages, err := findMainPackages(serviceDir)
+			if err != nil {
+				return nil, err
+			}
+			if len(mainPackages) == 0 {
+				mainPackages = []string{serviceDir}
+			}
+
+			services = append(services, Service{Name: pattern.Name, Dir: serviceDir, Packages: mainPackages})
+		}
+	}
+
+	return nonEmpty(services)
+}
+
+// ResolveServices names the services that do not have a name yet using the name sources (see NameService),
+// determines the module directory of each service and sorts the services by their directory.
+// Returns an error if several services have the same name.
+func ResolveServices(projectDir string, services []Service, nameSources []string) error {
+	names := make(map[string]string)
+
+	for i := range services {
+		service := &services[i]
+
+		if service.Name == "" {
+			name, err := NameService(service.Dir, nameSources)
+			if err != nil {
+				return err
+			}
+			service.Name = name
+		}
+
+		if service.ModuleDir == "" {
+			service.ModuleDir = findModuleDir(projectDir, service.Dir)
+		}
+
+		if otherDir, ok := names[service.Name]; ok {
+			return fmt.Errorf("the services in %s and %s are both named %s", otherDir, service.Dir, service.Name)
+		}
+		names[service.Name] = service.Dir
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Dir < services[j].Dir
+	})
+
+	return nil
+}
+
+// findModuleDir returns the closest directory holding a go.mod file, from the service directory up to
+// the project directory. Returns the project directory if there is none.
+func findModuleDir(projectDir, serviceDir string) string {
+	for dir := serviceDir; isWithin(dir, projectDir); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+
+		if dir == projectDir || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	return projectDir
+}
+
+// isWithin checks whether the path is the directory or is in it
+func isWithin(path, dir string) bool {
+	relativePath, err := filepath.Rel(dir, path)
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
+}
+
+// findMainPackages returns the sorted directories within the root directory that hold a main package.
+// Hidden directories, vendor and testdata directories and nested modules are skipped.
+func findMainPackages(rootDir string) ([]string, error) {
+	mainPackages := make([]string, 0)
+
+	err := filepath.WalkDir(rootDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if path != rootDir {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+
+		isMain, err := isMainPackage(path)
+		if err != nil {
+			return err
+		}
+		if isMain {
+			mainPackages = append(mainPackages, path)
+		}
+
+		return nil
+	})
+
+	sort.Strings(mainPackages)
+
+	return mainPackages, err
+}
+
+// isMainPackage checks whether the Go files in the directory, leaving out tests, belong to the main package
+func isMainPackage(dir string) (bool, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".go" || strings.HasSuffix(file.Name(), "_test.go") {
+			continue
+		}
+
+		// files that cannot be parsed are reported once the service is analysed
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, file.Name()), nil, parser.PackageClauseOnly)
+		if err == nil {
+			return f.Name.Name == "main", nil
+		}
+	}
+
+	return false, nil
+}
+
+// nonEmpty returns an error if no services were found
+func nonEmpty(services []Service) ([]Service, error) {
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services to analyse were found")
+	}
+
+	return services, nil
+}
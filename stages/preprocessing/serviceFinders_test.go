@@ -0,0 +1,199 @@
+// Package preprocessing defines preprocessing of a given Go project directory
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package preprocessing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"lab.weave.nl/internships/tud-2022/netDep/helpers"
+)
+
+// writeFiles creates the files, of which the paths are relative to the directory, with their content
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for path, content := range files {
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0o700))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, path), []byte(content), 0o600))
+	}
+}
+
+func TestDirectoryFinder(t *testing.T) {
+	serviceDir := filepath.Join(helpers.RootDir, "test", "example", "svc")
+
+	services, err := DirectoryFinder{ServicesDir: serviceDir}.FindServices()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(services))
+	assert.Equal(t, Service{
+		Dir:      filepath.Join(serviceDir, "node-basic-http"),
+		Packages: []string{filepath.Join(serviceDir, "node-basic-http")},
+	}, services[0])
+}
+
+func TestMainPackageFinder(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"go.mod":                     "module example.com/project\n",
+		"cmd/billing/main.go":        "package main\n",
+		"cmd/billing/main_test.go":   "package main_test\n",
+		"cmd/users/main.go":          "// Users serves the users\npackage main\n",
+		"internal/store/store.go":    "package store\n",
+		"tools/generator/go.mod":     "module example.com/generator\n",
+		"tools/generator/main.go":    "package main\n",
+		"vendor/example.com/x/x.go":  "package main\n",
+		".github/scripts/release.go": "package main\n",
+	})
+
+	services, err := MainPackageFinder{ProjectDir: projectDir}.FindServices()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Service{
+		{Dir: filepath.Join(projectDir, "cmd", "billing"), Packages: []string{filepath.Join(projectDir, "cmd", "billing")}},
+		{Dir: filepath.Join(projectDir, "cmd", "users"), Packages: []string{filepath.Join(projectDir, "cmd", "users")}},
+	}, services)
+}
+
+func TestMainPackageFinderNoServices(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{"lib/lib.go": "package lib\n"})
+
+	_, err := MainPackageFinder{ProjectDir: projectDir}.FindServices()
+
+	assert.EqualError(t, err, "no services to analyse were found")
+}
+
+func TestFindModuleDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"services/go.mod":             "module example.com/services\n",
+		"services/users/go.mod":       "module example.com/users\n",
+		"services/users/main.go":      "package main\n",
+		"services/orders/main.go":     "package main\n",
+		"services-old/go.mod":         "module example.com/old\n",
+		"services-old/orders/main.go": "package main\n",
+	})
+	projectDir := filepath.Join(dir, "services")
+
+	assert.Equal(t, filepath.Join(projectDir, "users"), findModuleDir(projectDir, filepath.Join(projectDir, "users")))
+	assert.Equal(t, projectDir, findModuleDir(projectDir, filepath.Join(projectDir, "orders")))
+	// a directory that merely starts with the path of the project directory is not inside it
+	assert.Equal(t, projectDir, findModuleDir(projectDir, filepath.Join(dir, "services-old", "orders")))
+}
+
+func TestWorkspaceFinder(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"go.work":                    "go 1.18\n\nuse (\n\t./billing\n\t./shared\n)\n\nuse ./users\n",
+		"billing/go.mod":             "module example.com/billing\n",
+		"billing/cmd/server/main.go": "package main\n",
+		"billing/cmd/worker/main.go": "package main\n",
+		"shared/go.mod":              "module example.com/shared\n",
+		"shared/shared.go":           "package shared\n",
+		"users/go.mod":               "module example.com/users/v2\n",
+		"users/main.go":              "package main\n",
+	})
+
+	services, err := WorkspaceFinder{WorkFile: filepath.Join(projectDir, "go.work")}.FindServices()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Service{
+		{
+			Dir:       filepath.Join(projectDir, "billing"),
+			ModuleDir: filepath.Join(projectDir, "billing"),
+			Packages:  []string{filepath.Join(projectDir, "billing", "cmd", "server"), filepath.Join(projectDir, "billing", "cmd", "worker")},
+		},
+		{
+			Dir:       filepath.Join(projectDir, "users"),
+			ModuleDir: filepath.Join(projectDir, "users"),
+			Packages:  []string{filepath.Join(projectDir, "users")},
+		},
+	}, services)
+}
+
+func TestPatternFinder(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"billing/cmd/server/main.go": "package main\n",
+		"services/users/main.go":     "package main\n",
+		"services/orders/main.go":    "package main\n",
+		"services/README.md":         "# Services\n",
+	})
+
+	services, err := PatternFinder{ProjectDir: projectDir, Patterns: []ServicePattern{
+		{Name: "billing", Path: "billing"},
+		{Path: "services/*"},
+		{Path: "services/users"},
+	}}.FindServices()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Service{
+		{Name: "billing", Dir: filepath.Join(projectDir, "billing"), Packages: []string{filepath.Join(projectDir, "billing", "cmd", "server")}},
+		{Dir: filepath.Join(projectDir, "services", "orders"), Packages: []string{filepath.Join(projectDir, "services", "orders")}},
+		{Dir: filepath.Join(projectDir, "services", "users"), Packages: []string{filepath.Join(projectDir, "services", "users")}},
+	}, services)
+}
+
+func TestPatternFinderErrors(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"services/users/main.go":  "package main\n",
+		"services/orders/main.go": "package main\n",
+	})
+
+	_, err := PatternFinder{ProjectDir: projectDir, Patterns: []ServicePattern{{Path: "billing"}}}.FindServices()
+	assert.EqualError(t, err, "no directory matches the service path billing")
+
+	_, err = PatternFinder{ProjectDir: projectDir, Patterns: []ServicePattern{{Name: "users", Path: "services/*"}}}.FindServices()
+	assert.EqualError(t, err, "the service path services/* of users matches several directories")
+}
+
+func TestLoadServicePatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"services.yaml": "services:\n  - name: billing\n    path: billing/cmd/server\n  - path: services/*\n",
+		"invalid.yaml":  "services:\n  - name: billing\n",
+	})
+
+	patterns, err := LoadServicePatterns(filepath.Join(dir, "services.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, []ServicePattern{{Name: "billing", Path: "billing/cmd/server"}, {Path: "services/*"}}, patterns)
+
+	_, err = LoadServicePatterns(filepath.Join(dir, "invalid.yaml"))
+	assert.EqualError(t, err, "the service billing in the services file has no path")
+}
+
+func TestResolveServices(t *testing.T) {
+	projectDir := t.TempDir()
+	writeFiles(t, projectDir, map[string]string{
+		"go.mod":               "module example.com/project\n",
+		"svc/users/main.go":    "package main\n",
+		"svc/billing/go.mod":   "module example.com/billing-service\n",
+		"svc/billing/main.go":  "package main\n",
+		"svc/orders/main.go":   "package main\n",
+		"other/orders/main.go": "package main\n",
+	})
+
+	services := []Service{
+		{Dir: filepath.Join(projectDir, "svc", "users")},
+		{Name: "payments", Dir: filepath.Join(projectDir, "svc", "billing")},
+	}
+	err := ResolveServices(projectDir, services, []string{NameFromGoMod})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Service{
+		{Name: "payments", Dir: filepath.Join(projectDir, "svc", "billing"), ModuleDir: filepath.Join(projectDir, "svc", "billing")},
+		{Name: "users", Dir: filepath.Join(projectDir, "svc", "users"), ModuleDir: projectDir},
+	}, services)
+
+	err = ResolveServices(projectDir, []Service{
+		{Dir: filepath.Join(projectDir, "svc", "orders")},
+		{Dir: filepath.Join(projectDir, "other", "orders")},
+	}, nil)
+	assert.EqualError(t, err, "the services in "+filepath.Join(projectDir, "svc", "orders")+" and "+
+		filepath.Join(projectDir, "other", "orders")+" are both named orders")
+}
@@ -0,0 +1,232 @@
+// Package preprocessing defines preprocessing of a given Go project directory
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package preprocessing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"gopkg.in/yaml.v3"
+)
+
+// The sources from which the name of a service can be derived
+const (
+	NameFromDirectory  = "directory"  // NameFromDirectory names a service after its directory
+	NameFromGoMod      = "gomod"      // NameFromGoMod names a service after the last element of the module path in its go.mod
+	NameFromDockerfile = "dockerfile" // NameFromDockerfile names a service after a label of its Dockerfile
+	NameFromKubernetes = "k8s"        // NameFromKubernetes names a service after a label of its Kubernetes manifests
+)
+
+// dockerfileLabels are the labels of a Dockerfile that hold the name of a service, in order of preference
+var dockerfileLabels = []string{"org.opencontainers.image.title", "service"}
+
+// kubernetesLabels are the labels of a Kubernetes resource that hold the name of a service, in order of preference
+var kubernetesLabels = []string{"app.kubernetes.io/name", "app"}
+
+// majorVersionSuffix matches the major version at the end of a module path, such as /v2
+var majorVersionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// IsValidNameSource checks whether the source of service names is known
+func IsValidNameSource(source string) bool {
+	switch source {
+	case NameFromDirectory, NameFromGoMod, NameFromDockerfile, NameFromKubernetes:
+		return true
+	default:
+		return false
+	}
+}
+
+// NameService derives the name of the service in the directory from the first of the sources that names it.
+// Falls back to the name of the directory if none of the sources do.
+func NameService(serviceDir string, sources []string) (string, error) {
+	for _, source := range sources {
+		name, err := nameFromSource(serviceDir, source)
+		if err != nil {
+			return "", err
+		}
+
+		if name != "" {
+			return name, nil
+		}
+	}
+
+	return filepath.Base(serviceDir), nil
+}
+
+// nameFromSource derives the name of the service from a single source, or returns "" if the source does not name it
+func nameFromSource(serviceDir, source string) (string, error) {
+	switch source {
+	case NameFromDirectory:
+		return filepath.Base(serviceDir), nil
+	case NameFromGoMod:
+		return nameFromGoMod(serviceDir)
+	case NameFromDockerfile:
+		return nameFromDockerfile(serviceDir)
+	case NameFromKubernetes:
+		return nameFromKubernetes(serviceDir)
+	default:
+		return "", fmt.Errorf("unknown service name source: %s", source)
+	}
+}
+
+// nameFromGoMod returns the last element of the module path in the go.mod file of the service, leaving out
+// the major version, or "" if the service does not have a go.mod file
+func nameFromGoMod(serviceDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(serviceDir, "go.mod"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	elements := strings.Split(modfile.ModulePath(data), "/")
+	if len(elements) > 1 && majorVersionSuffix.MatchString(elements[len(elements)-1]) {
+		elements = elements[:len(elements)-1]
+	}
+
+	return elements[len(elements)-1], nil
+}
+
+// nameFromDockerfile returns the value of the first of the dockerfileLabels in the Dockerfile of the service,
+// or "" if it does not have a Dockerfile or none of the labels are set
+func nameFromDockerfile(serviceDir string) (string, error) {
+	file, err := os.Open(filepath.Join(serviceDir, "Dockerfile"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	labels := make(map[string]string)
+
+	scanner := bufio.NewScanner(file)
+	instruction := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// instructions can be continued on the next line
+		if strings.HasSuffix(line, "\\") {
+			instruction += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		instruction += line
+
+		fields := strings.Fields(instruction)
+		if len(fields) > 1 && strings.EqualFold(fields[0], "LABEL") {
+			parseDockerfileLabels(strings.TrimSpace(instruction[len(fields[0]):]), labels)
+		}
+		instruction = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	for _, label := range dockerfileLabels {
+		if name := labels[label]; name != "" {
+			return name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// parseDockerfileLabels adds the key=value pairs of a LABEL instruction, of which the values may be quoted, to the labels
+func parseDockerfileLabels(pairs string, labels map[string]string) {
+	for pairs != "" {
+		separator := strings.Index(pairs, "=")
+		if separator < 0 {
+			return
+		}
+		key := strings.Trim(strings.TrimSpace(pairs[:separator]), `"`)
+		pairs = pairs[separator+1:]
+
+		value := ""
+		if strings.HasPrefix(pairs, `"`) {
+			end := strings.Index(pairs[1:], `"`)
+			if end < 0 {
+				return
+			}
+			value, pairs = pairs[1:end+1], pairs[end+2:]
+		} else if end := strings.IndexAny(pairs, " \t"); end >= 0 {
+			value, pairs = pairs[:end], pairs[end:]
+		} else {
+			value, pairs = pairs, ""
+		}
+
+		labels[key] = value
+		pairs = strings.TrimSpace(pairs)
+	}
+}
+
+// kubernetesResource holds the part of a Kubernetes resource that holds its labels
+type kubernetesResource struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Labels map[string]string `yaml:"labels"`
+	} `yaml:"metadata"`
+}
+
+// nameFromKubernetes returns the value of the first of the kubernetesLabels of the first resource that has one,
+// in the (sorted) YAML files in the directory of the service and its subdirectories, or "" if there is none
+func nameFromKubernetes(serviceDir string) (string, error) {
+	manifests := make([]string, 0)
+	err := filepath.WalkDir(serviceDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() && path != serviceDir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		if !entry.IsDir() && (filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml") {
+			manifests = append(manifests, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(manifests)
+
+	for _, manifest := range manifests {
+		data, err := os.ReadFile(filepath.Clean(manifest))
+		if err != nil {
+			return "", err
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var resource kubernetesResource
+			if err := decoder.Decode(&resource); err != nil {
+				// the end of the file, or a YAML file that is not a Kubernetes manifest
+				break
+			}
+
+			if resource.Kind == "" {
+				continue
+			}
+
+			for _, label := range kubernetesLabels {
+				if name := resource.Metadata.Labels[label]; name != "" {
+					return name, nil
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
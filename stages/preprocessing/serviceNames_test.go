@@ -0,0 +1,58 @@
+// Package preprocessing defines preprocessing of a given Go project directory
+// Copyright © 2022 TW Group 13C, Weave BV, TU Delft
+package preprocessing
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameService(t *testing.T) {
+	serviceDir := filepath.Join(t.TempDir(), "svc-billing")
+	writeFiles(t, serviceDir, map[string]string{
+		"go.mod": "module example.com/billing/v3\n\ngo 1.17\n",
+		"Dockerfile": "FROM golang:1.17\n# LABEL service=commented-out\n" +
+			"LABEL maintainer=\"team@example.com\" \\\n  org.opencontainers.image.title=\"billing-api\"\n",
+		"deploy/config.yaml": "replicas: 3\n",
+		"deploy/k8s.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: billing\n---\n" +
+			"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  labels:\n    app: billing-app\n",
+	})
+
+	tests := []struct {
+		sources []string
+		name    string
+	}{
+		{sources: nil, name: "svc-billing"},
+		{sources: []string{NameFromDirectory}, name: "svc-billing"},
+		{sources: []string{NameFromGoMod}, name: "billing"},
+		{sources: []string{NameFromDockerfile}, name: "billing-api"},
+		{sources: []string{NameFromKubernetes, NameFromGoMod}, name: "billing-app"},
+	}
+
+	for _, test := range tests {
+		name, err := NameService(serviceDir, test.sources)
+		assert.Nil(t, err)
+		assert.Equal(t, test.name, name, test.sources)
+	}
+}
+
+func TestNameServiceFallback(t *testing.T) {
+	serviceDir := filepath.Join(t.TempDir(), "users")
+	writeFiles(t, serviceDir, map[string]string{"main.go": "package main\n"})
+
+	name, err := NameService(serviceDir, []string{NameFromKubernetes, NameFromDockerfile, NameFromGoMod})
+	assert.Nil(t, err)
+	assert.Equal(t, "users", name)
+
+	_, err = NameService(serviceDir, []string{"helm"})
+	assert.EqualError(t, err, "unknown service name source: helm")
+}
+
+func TestParseDockerfileLabels(t *testing.T) {
+	labels := make(map[string]string)
+	parseDockerfileLabels(`"service"=orders version=1.2 description="Handles the orders"`, labels)
+
+	assert.Equal(t, map[string]string{"service": "orders", "version": "1.2", "description": "Handles the orders"}, labels)
+}
@@ -4,18 +4,36 @@ package preprocessing
 
 import (
 	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/go/ssa"
 	"golang.org/x/tools/go/ssa/ssautil"
+
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
 )
 
 // LoadAndBuildPackages takes in project root directory path and the path
 // of one service and returns the SSA representation of the service.
-func LoadAndBuildPackages(projectRootDir string, svcPath string) ([]*ssa.Package, error) {
+// Packages that cannot be type-checked are left out, and are recorded in the collector together with their errors.
+func LoadAndBuildPackages(projectRootDir string, svcPath string, collector *diagnostics.Collector) ([]*ssa.Package, error) {
+	return LoadAndBuildService(Service{
+		Name:      filepath.Base(svcPath),
+		Dir:       svcPath,
+		ModuleDir: projectRootDir,
+		Packages:  []string{svcPath},
+	}, collector)
+}
+
+// LoadAndBuildService loads the main packages of the service from its module directory,
+// and returns their SSA representation.
+// Packages that cannot be type-checked are left out, and are recorded in the collector together with their errors.
+func LoadAndBuildService(service Service, collector *diagnostics.Collector) ([]*ssa.Package, error) {
 	// setup build buildConfig
 	buildConfig := &packages.Config{
-		Dir: projectRootDir,
+		Dir: service.ModuleDir,
 		//nolint // We are using this, as cmd/callgraph is using it.
 		Mode:  packages.LoadAllSyntax,
 		Tests: false,
@@ -23,8 +41,8 @@ func LoadAndBuildPackages(projectRootDir string, svcPath string) ([]*ssa.Package
 
 	builderMode := ssa.BuilderMode(0)
 
-	// load all packages in the service directory
-	loadedPackages, err := packages.Load(buildConfig, svcPath)
+	// load all main packages of the service
+	loadedPackages, err := packages.Load(buildConfig, service.Packages...)
 	if err != nil {
 		return nil, err
 	}
@@ -33,7 +51,7 @@ func LoadAndBuildPackages(projectRootDir string, svcPath string) ([]*ssa.Package
 		return nil, fmt.Errorf("no packages")
 	}
 
-	nonErroredPackages, count := filterOutErroredPackages(loadedPackages)
+	nonErroredPackages, count := filterOutErroredPackages(loadedPackages, []Service{service}, collector)
 
 	if count < 1 {
 		return nil, fmt.Errorf("no usable packages found")
@@ -48,15 +66,115 @@ func LoadAndBuildPackages(projectRootDir string, svcPath string) ([]*ssa.Package
 	return processedPackages, nil
 }
 
-// filterOutErroredPackages removes errored packages from the list of analyzable packages
-func filterOutErroredPackages(loadedPackages []*packages.Package) ([]*packages.Package, int) {
+// LoadAndBuildProgram takes in project root directory path and the services, loads their main packages
+// using a single packages.Load call and builds a single SSA program, so that packages shared by the services
+// are only type-checked and built once. Returns the SSA packages of each service, keyed by the service directory.
+// All services must be part of the module of the project root directory.
+// Packages that cannot be type-checked are left out, and are recorded in the collector together with their errors.
+func LoadAndBuildProgram(projectRootDir string, services []Service, collector *diagnostics.Collector) (map[string][]*ssa.Package, error) {
+	buildConfig := &packages.Config{
+		Dir: projectRootDir,
+		//nolint // We are using this, as cmd/callgraph is using it.
+		Mode:  packages.LoadAllSyntax,
+		Tests: false,
+	}
+
+	patterns := make([]string, 0, len(services))
+	for _, service := range services {
+		patterns = append(patterns, service.Packages...)
+	}
+
+	loadedPackages, err := packages.Load(buildConfig, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	nonErroredPackages, count := filterOutErroredPackages(loadedPackages, services, collector)
+
+	if count < 1 {
+		return nil, fmt.Errorf("no usable packages found")
+	}
+
+	program, processedPackages := ssautil.AllPackages(nonErroredPackages, ssa.BuilderMode(0))
+	program.Build()
+
+	packagesByService := make(map[string][]*ssa.Package)
+	for i, loadedPackage := range nonErroredPackages {
+		if service, ok := findServiceOfPackage(loadedPackage, services); ok && processedPackages[i] != nil {
+			packagesByService[service.Dir] = append(packagesByService[service.Dir], processedPackages[i])
+		}
+	}
+
+	return packagesByService, nil
+}
+
+// findServiceOfPackage returns the service whose directory contains the files of the package.
+// When the directories of several services contain them, the innermost one is returned.
+func findServiceOfPackage(loadedPackage *packages.Package, services []Service) (Service, bool) {
+	if len(loadedPackage.GoFiles) == 0 {
+		return Service{}, false
+	}
+
+	return findServiceOfDir(filepath.Dir(loadedPackage.GoFiles[0]), services)
+}
+
+// findServiceOfDir returns the innermost service of which the directory holds the given directory
+func findServiceOfDir(dir string, services []Service) (Service, bool) {
+	found, ok := Service{}, false
+	for _, service := range services {
+		cleanPath := filepath.Clean(service.Dir)
+		isInService := dir == cleanPath || strings.HasPrefix(dir, cleanPath+string(filepath.Separator))
+		if isInService && len(cleanPath) > len(filepath.Clean(found.Dir)) {
+			found, ok = service, true
+		}
+	}
+
+	return found, ok
+}
+
+// filterOutErroredPackages removes errored packages from the list of analyzable packages,
+// and records the errors of each removed package in the collector
+func filterOutErroredPackages(loadedPackages []*packages.Package, services []Service, collector *diagnostics.Collector) ([]*packages.Package, int) {
 	nonErroredPackages := make([]*packages.Package, 0)
 	validPackageCount := 0
 	for _, loadedPackage := range loadedPackages {
 		if len(loadedPackage.Errors) == 0 {
 			nonErroredPackages = append(nonErroredPackages, loadedPackage)
 			validPackageCount++
+			continue
+		}
+
+		serviceName := ""
+		if service, ok := findServiceOfPackage(loadedPackage, services); ok {
+			serviceName = service.Name
+		}
+
+		for _, packageError := range loadedPackage.Errors {
+			collector.Errorf(diagnostics.StagePreprocessing, serviceName, positionOfPackageError(packageError),
+				"package %s is not analysed: %s", loadedPackage.PkgPath, packageError.Msg)
 		}
 	}
 	return nonErroredPackages, validPackageCount
 }
+
+// positionOfPackageError returns the file:line of the error, leaving out the column, or "" if the position is unknown
+func positionOfPackageError(packageError packages.Error) string {
+	if packageError.Pos == "" || packageError.Pos == "-" {
+		return ""
+	}
+
+	// the position is formatted as file:line:column or file:line
+	parts := strings.Split(packageError.Pos, ":")
+	const partsWithColumn = 3
+	if len(parts) >= partsWithColumn && isNumber(parts[len(parts)-1]) && isNumber(parts[len(parts)-2]) {
+		return strings.Join(parts[:len(parts)-1], ":")
+	}
+
+	return packageError.Pos
+}
+
+// isNumber checks whether the text is a non-negative integer
+func isNumber(text string) bool {
+	_, err := strconv.ParseUint(text, 10, 64)
+	return err == nil
+}
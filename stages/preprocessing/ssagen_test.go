@@ -7,21 +7,83 @@ import (
 	"path/filepath"
 	"testing"
 
+	"golang.org/x/tools/go/packages"
+
 	"lab.weave.nl/internships/tud-2022/netDep/helpers"
+	"lab.weave.nl/internships/tud-2022/netDep/stages/diagnostics"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestLoadPackages(t *testing.T) {
 	svcDir := filepath.Join(helpers.RootDir, "test", "sample", "http", "basic_call")
-	initial, _ := LoadAndBuildPackages(svcDir, svcDir)
+	initial, _ := LoadAndBuildPackages(svcDir, svcDir, nil)
 
 	assert.Equal(t, "main", initial[0].Pkg.Name())
 }
 
 func TestLoadPackagesError(t *testing.T) {
 	projDir := filepath.Join(helpers.RootDir, "test", "example", "svc")
-	_, err := LoadAndBuildPackages(projDir, projDir)
+	_, err := LoadAndBuildPackages(projDir, projDir, nil)
+
+	assert.Equal(t, "no usable packages found", err.Error())
+}
+
+func TestLoadAndBuildProgram(t *testing.T) {
+	projDir := filepath.Join(helpers.RootDir, "test", "example")
+	basicHTTP := filepath.Join(projDir, "svc", "node-basic-http")
+	ginHTTP := filepath.Join(projDir, "svc", "node-gin-http")
+
+	packagesByService, err := LoadAndBuildProgram(projDir, []Service{
+		{Name: "node-basic-http", Dir: basicHTTP, Packages: []string{basicHTTP}},
+		{Name: "node-gin-http", Dir: ginHTTP, Packages: []string{ginHTTP}},
+	}, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(packagesByService))
+	assert.Equal(t, "main", packagesByService[basicHTTP][0].Pkg.Name())
+	assert.Equal(t, "main", packagesByService[ginHTTP][0].Pkg.Name())
+	// both services are part of the same program
+	assert.Same(t, packagesByService[basicHTTP][0].Prog, packagesByService[ginHTTP][0].Prog)
+}
+
+func TestLoadAndBuildProgramError(t *testing.T) {
+	projDir := filepath.Join(helpers.RootDir, "test", "example", "svc")
+	_, err := LoadAndBuildProgram(projDir, []Service{{Name: "svc", Dir: projDir, Packages: []string{projDir}}}, nil)
 
 	assert.Equal(t, "no usable packages found", err.Error())
 }
+
+func TestFilterOutErroredPackages(t *testing.T) {
+	svcPath := filepath.Join("project", "svc", "service-1")
+	valid := &packages.Package{PkgPath: "example.com/service-1"}
+	errored := &packages.Package{
+		PkgPath: "example.com/service-1/handlers",
+		GoFiles: []string{filepath.Join(svcPath, "handlers", "users.go")},
+		Errors: []packages.Error{
+			{Pos: "/project/svc/service-1/handlers/users.go:12:5", Msg: "undefined: userStore"},
+			{Pos: "-", Msg: "could not import example.com/store"},
+		},
+	}
+
+	collector := diagnostics.NewCollector()
+	nonErroredPackages, count := filterOutErroredPackages([]*packages.Package{valid, errored}, []Service{{Name: "service-1", Dir: svcPath}}, collector)
+
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []*packages.Package{valid}, nonErroredPackages)
+	assert.Equal(t, []diagnostics.Diagnostic{
+		{
+			Severity: diagnostics.Error,
+			Stage:    diagnostics.StagePreprocessing,
+			Service:  "service-1",
+			Position: "/project/svc/service-1/handlers/users.go:12",
+			Message:  "package example.com/service-1/handlers is not analysed: undefined: userStore",
+		},
+		{
+			Severity: diagnostics.Error,
+			Stage:    diagnostics.StagePreprocessing,
+			Service:  "service-1",
+			Message:  "package example.com/service-1/handlers is not analysed: could not import example.com/store",
+		},
+	}, collector.Diagnostics())
+}
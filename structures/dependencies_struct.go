@@ -16,4 +16,8 @@ type Dependencies struct {
 	// stores dependencies for nats analyzer
 	Consumers []*natsanalyzer.NatsCall
 	Producers []*natsanalyzer.NatsCall
+
+	// Hosts maps hosts, optionally with their port, to the services they belong to,
+	// for calls that do not use the name of the service they target
+	Hosts map[string]string
 }